@@ -1,12 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg/config"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg/load"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/policy"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg/sync"
-	"github.com/sirupsen/logrus"
-	easy "github.com/t-tomalak/logrus-easy-formatter"
+	"github.com/spf13/viper"
 	"github.com/urfave/cli/v2"
 	"log"
 	"os"
@@ -35,9 +36,10 @@ func main() {
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:     "registry",
+						Aliases:  []string{"job"},
 						Value:    "",
 						Required: false,
-						Usage:    "the hostname of the registry you want to load",
+						Usage:    "the name of the job, or hostname of the registry, you want to load",
 					},
 					&cli.BoolFlag{
 						Name:     "all",
@@ -47,6 +49,96 @@ func main() {
 				},
 				Description: "load a set of images into a repository using the script configured in config.yaml",
 				Action:      load.Load,
+			},
+			{
+				Name: "export",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "registry",
+						Aliases:  []string{"job"},
+						Required: true,
+						Usage:    "the name of the job, or hostname of the registry, whose syncer script lists the images to export",
+					},
+					&cli.StringFlag{
+						Name:     "out",
+						Required: true,
+						Usage:    "the bundle to create, either a tar archive or an existing directory",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "oci",
+						Usage: "oci, an OCI image layout copied directly from the source registries, or docker-archive, created using docker save",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "a previous bundle, its picture-book.json, or a registry inventory. Blobs it lists are left out, creating a delta bundle",
+					},
+				},
+				Description: "write the images listed by a registries syncer script into a bundle, for registries without access to the source registries",
+				Action:      load.Export,
+			},
+			{
+				Name: "import",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "bundle",
+						Required: true,
+						Usage:    "the bundle created by the export command",
+					},
+					&cli.StringFlag{
+						Name:     "registry",
+						Aliases:  []string{"job"},
+						Required: true,
+						Usage:    "the name of the job, or hostname of the registry, the images are pushed to",
+					},
+				},
+				Description: "push the images of a bundle into a registry, retagging them as synchronization does",
+				Action:      load.Import,
+			},
+			{
+				Name: "inventory",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "registry",
+						Aliases:  []string{"job"},
+						Required: true,
+						Usage:    "the name of the job, or hostname of the registry, to list",
+					},
+					&cli.StringFlag{
+						Name:     "out",
+						Required: true,
+						Usage:    "the JSON file to write, for use with export --since",
+					},
+				},
+				Description: "list the blobs held by a registry, so export can leave them out of delta bundles",
+				Action:      load.Inventory,
+			},
+			{
+				Name:        "policy",
+				Description: "work with the image policy configured in config.yaml",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "test",
+						ArgsUsage: "<image> [image...]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "registry",
+								Aliases:  []string{"job"},
+								Value:    "",
+								Required: false,
+								Usage:    "the name of the job, or hostname of the registry, whose policy is used, defaults to the top level policy",
+							},
+							&cli.BoolFlag{
+								Name:     "inspect",
+								Value:    false,
+								Required: false,
+								Usage:    "also evaluate the size, platform, and label rules, which read the image from its registry",
+							},
+						},
+						Description: "check if images are allowed by the policy, without synchronizing them",
+						Action:      policyTest,
+					},
+				},
 			}},
 		Flags:                     []cli.Flag{},
 		EnableBashCompletion:      false,
@@ -77,25 +169,67 @@ func main() {
 		AllowExtFlags:             false,
 		SkipFlagParsing:           false,
 	}
-	pkg.Logger = &logrus.Logger{
-		Out:   os.Stderr,
-		Level: logrus.InfoLevel,
-		Formatter: &easy.Formatter{
-			TimestampFormat: pkg.TimeFormat,
-			LogFormat:       "[%time%] %msg%\n",
-		},
-	}
-
-	pkg.ErrLogger = &logrus.Logger{
-		Out:   os.Stderr,
-		Level: logrus.InfoLevel,
-		Formatter: &easy.Formatter{
-			TimestampFormat: pkg.TimeFormat,
-			LogFormat:       "[%lvl%][%time%] %msg%\n",
-		},
-	}
 	config.Setup()
+	if err := config.SetupLogging(); err != nil {
+		log.Fatal(err)
+	}
 	if err := app.Run(os.Args); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// policyTest evaluates the policy against the images given as arguments, without synchronizing them.
+// The policy of the registry given by the --registry flag is used, or the top level policy otherwise.
+// Only the rules about image names are evaluated, unless --inspect allows contacting registries.
+func policyTest(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("at least one image must be provided")
+	}
+
+	var conf *pkg.PolicyConfig
+	var auth string
+	if host := c.String("registry"); host != "" {
+		registry, err := config.ConfiguredRegistries.GetRegistry(host)
+		if err != nil {
+			return err
+		}
+		conf, auth = registry.Policy, registry.PullAuthConfig
+	} else if viper.IsSet("policy") {
+		conf = &pkg.PolicyConfig{}
+		if err := viper.UnmarshalKey("policy", conf); err != nil {
+			return fmt.Errorf("could not unmarshal policy in config.yaml file: %w", err)
+		}
+	}
+	if conf == nil {
+		return fmt.Errorf("no policy is configured")
+	}
+
+	p, err := policy.New(conf, auth)
+	if err != nil {
+		return err
+	}
+	offline := !c.Bool("inspect")
+	if offline && p.Inspects() {
+		fmt.Fprintln(c.App.ErrWriter, "size, platform, and label rules are not evaluated, pass --inspect to read the images from their registries")
+	}
+	violations := 0
+	for _, image := range c.Args().Slice() {
+		result, err := p.Evaluate(c.Context, image, offline)
+		if err != nil {
+			return err
+		}
+		if result.Passed() {
+			fmt.Fprintf(c.App.Writer, "%s: allowed\n", image)
+			continue
+		}
+		violations++
+		fmt.Fprintf(c.App.Writer, "%s: denied\n", image)
+		for _, v := range result.Violations {
+			fmt.Fprintf(c.App.Writer, "  - %s\n", v)
+		}
+	}
+	if violations > 0 {
+		return cli.Exit(fmt.Sprintf("%d of %d images violate the policy", violations, c.NArg()), 1)
+	}
+	return nil
+}
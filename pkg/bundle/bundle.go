@@ -0,0 +1,476 @@
+// Package bundle reads and writes image bundles, which carry images into air-gapped
+// environments. A bundle is an OCI image layout, either as a directory or a tar
+// archive, or a docker-archive as written by docker save. Both list their images in
+// a picture-book.json file at their root.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	mutex "sync"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+)
+
+const (
+	FormatOCI           = "oci"
+	FormatDockerArchive = "docker-archive"
+	// FormatInventory lists the blobs held by a registry, without any images
+	FormatInventory = "inventory"
+
+	// ContentsFile lists the images held by a bundle
+	ContentsFile = "picture-book.json"
+	// ImageNameAnnotation holds the full name of an image in index.json, as used by containerd
+	ImageNameAnnotation = "io.containerd.image.name"
+	// RefNameAnnotation holds the tag of an image in index.json
+	RefNameAnnotation = "org.opencontainers.image.ref.name"
+
+	layoutFile    = "oci-layout"
+	indexFile     = "index.json"
+	layoutVersion = `{"imageLayoutVersion":"1.0.0"}`
+)
+
+// Contents describes the images held by a bundle.
+type Contents struct {
+	Format  string
+	Created time.Time
+	// Registry is the registry the images were exported for
+	Registry string `json:",omitempty"`
+	Images   []Image
+	// Blobs lists the digest of every config and layer referenced by the images, including
+	// those left out of delta bundles, so the contents can be the base of the next delta.
+	Blobs []string `json:",omitempty"`
+	// Base names what a delta bundle is based on. Blobs provided by the base are left out
+	// of the bundle, and must already exist on the target registry when it is imported.
+	Base string `json:",omitempty"`
+	// BaseImages names the images of the bundles a delta is based on, whose repositories on the
+	// target registry hold the blobs left out.
+	BaseImages []string `json:",omitempty"`
+	// Repositories maps blobs to a repository of Registry holding them. Inventories record it for
+	// every blob, delta bundles for the blobs left out, so they can be mounted from there on import.
+	Repositories map[string]string `json:",omitempty"`
+}
+
+type Image struct {
+	// Image is the name of the image as listed by the syncer script
+	Image string
+	// Digest of the image manifest, for OCI layouts
+	Digest string `json:",omitempty"`
+	// ID of the image in the docker daemon, for docker-archives
+	ID string `json:",omitempty"`
+}
+
+func blobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// fileWriter stores the files of an image layout.
+type fileWriter interface {
+	// WriteFile stores exactly size bytes read from r under name
+	WriteFile(name string, size int64, r io.Reader) error
+	// Has reports if name was already stored
+	Has(name string) bool
+	Close() error
+}
+
+// copyFile copies exactly size bytes of r to dst. Unlike io.CopyN, errors returned along with the
+// last bytes, e.g. by a verifier, are reported.
+func copyFile(dst io.Writer, r io.Reader, size int64) error {
+	n, err := io.Copy(dst, io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+	if n < size {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+type tarWriter struct {
+	f     *os.File
+	tw    *tar.Writer
+	files map[string]bool
+}
+
+func newTarWriter(dst string) (*tarWriter, error) {
+	f, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	return &tarWriter{f: f, tw: tar.NewWriter(f), files: make(map[string]bool)}, nil
+}
+
+func (t *tarWriter) WriteFile(name string, size int64, r io.Reader) error {
+	// parent directories are added first, as some tools expect them
+	if dir := path.Dir(name); dir != "." && !t.files[dir+"/"] {
+		if err := t.writeDirs(dir); err != nil {
+			return err
+		}
+	}
+	err := t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := copyFile(t.tw, r, size); err != nil {
+		return fmt.Errorf("could not write %s: %w", name, err)
+	}
+	t.files[name] = true
+	return nil
+}
+
+// writeDirs adds dir and its missing parents to the archive, outermost first.
+func (t *tarWriter) writeDirs(dir string) error {
+	if parent := path.Dir(dir); parent != "." && !t.files[parent+"/"] {
+		if err := t.writeDirs(parent); err != nil {
+			return err
+		}
+	}
+	t.files[dir+"/"] = true
+	return t.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0755, ModTime: time.Now()})
+}
+
+func (t *tarWriter) Has(name string) bool {
+	return t.files[name]
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
+
+type dirWriter struct {
+	dir string
+}
+
+func (d *dirWriter) WriteFile(name string, size int64, r io.Reader) error {
+	dst := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	// files are written under a temporary name, so an interrupted write never leaves a partial blob behind
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := copyFile(tmp, r, size); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (d *dirWriter) Has(name string) bool {
+	_, err := os.Stat(filepath.Join(d.dir, filepath.FromSlash(name)))
+	return err == nil
+}
+
+func (d *dirWriter) Close() error {
+	return nil
+}
+
+// Writer writes images into an OCI image layout. It is safe for concurrent use.
+type Writer struct {
+	Contents Contents
+	files    fileWriter
+	index    registry.Manifest
+	// blobs holds the configs and layers referenced so far
+	blobs   map[string]bool
+	exclude map[string]bool
+	// baseRepositories are the repositories of the base holding the excluded blobs
+	baseRepositories map[string]string
+	omitted          int
+	mu               mutex.Mutex
+}
+
+func newWriter() *Writer {
+	return &Writer{
+		Contents: Contents{Format: FormatOCI, Created: time.Now().UTC()},
+		index:    registry.Manifest{SchemaVersion: 2, MediaType: registry.MediaTypeOCIIndex, Manifests: []registry.Descriptor{}},
+		blobs:    make(map[string]bool),
+		exclude:  make(map[string]bool),
+	}
+}
+
+// Create creates an OCI layout bundle at dst. If dst is an existing directory
+// the layout is written into it, otherwise a tar archive is created.
+func Create(dst string) (*Writer, error) {
+	w := newWriter()
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		w.files = &dirWriter{dir: dst}
+		return w, nil
+	}
+	tw, err := newTarWriter(dst)
+	if err != nil {
+		return nil, fmt.Errorf("could not create bundle: %w", err)
+	}
+	w.files = tw
+	return w, nil
+}
+
+// OpenLayout opens the OCI layout in dir for writing, creating it if needed. Unlike Create,
+// the images already held by the layout are kept, and images added under an existing name
+// replace it. Save persists the layout after each change.
+func OpenLayout(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create layout: %w", err)
+	}
+	w := newWriter()
+	w.files = &dirWriter{dir: dir}
+	r := &Reader{files: &dirReader{dir: dir}}
+	if err := r.readJSON(indexFile, &w.index); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := r.readJSON(ContentsFile, &w.Contents); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, digest := range w.Contents.Blobs {
+		w.blobs[digest] = true
+	}
+	return w, nil
+}
+
+// Exclude makes the bundle a delta of base: the blobs base lists are left out of the bundle.
+// name describes base, e.g. the path of the previous bundle.
+func (w *Writer) Exclude(base Contents, name string) {
+	for _, digest := range base.Blobs {
+		w.exclude[digest] = true
+	}
+	w.baseRepositories = base.Repositories
+	w.Contents.Base = name
+	for _, image := range base.Images {
+		w.Contents.BaseImages = append(w.Contents.BaseImages, image.Image)
+	}
+	w.Contents.BaseImages = append(w.Contents.BaseImages, base.BaseImages...)
+}
+
+// Omitted is the number of blobs left out of the bundle because the base provides them.
+func (w *Writer) Omitted() int {
+	return w.omitted
+}
+
+// Add copies image from src into the layout, along with every platform and blob it references.
+func (w *Writer) Add(ctx context.Context, src *registry.Client, image string) (registry.Descriptor, error) {
+	return w.AddAs(ctx, src, image, image)
+}
+
+// AddAs copies image from src into the layout, naming it name. An image
+// already held under name is replaced.
+func (w *Writer) AddAs(ctx context.Context, src *registry.Client, image, name string) (registry.Descriptor, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return registry.Descriptor{}, err
+	}
+	nameRef, err := registry.ParseReference(name)
+	if err != nil {
+		return registry.Descriptor{}, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	desc, err := w.copyManifest(ctx, src, ref.Repository, ref.Reference())
+	if err != nil {
+		return registry.Descriptor{}, err
+	}
+	desc.Annotations = map[string]string{ImageNameAnnotation: name}
+	if nameRef.Tag != "" {
+		desc.Annotations[RefNameAnnotation] = nameRef.Tag
+	}
+
+	manifests := w.index.Manifests[:0]
+	for _, m := range w.index.Manifests {
+		if m.Annotations[ImageNameAnnotation] != name {
+			manifests = append(manifests, m)
+		}
+	}
+	w.index.Manifests = append(manifests, desc)
+	images := w.Contents.Images[:0]
+	for _, i := range w.Contents.Images {
+		if i.Image != name {
+			images = append(images, i)
+		}
+	}
+	w.Contents.Images = append(images, Image{Image: name, Digest: desc.Digest})
+	return desc, nil
+}
+
+// Lookup returns the descriptor of the image held under name.
+func (w *Writer) Lookup(name string) (registry.Descriptor, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, m := range w.index.Manifests {
+		if m.Annotations[ImageNameAnnotation] == name {
+			return m, true
+		}
+	}
+	return registry.Descriptor{}, false
+}
+
+func (w *Writer) copyManifest(ctx context.Context, src *registry.Client, repo, reference string) (registry.Descriptor, error) {
+	b, desc, err := src.GetManifest(ctx, repo, reference)
+	if err != nil {
+		return registry.Descriptor{}, err
+	}
+	m, err := registry.ParseManifest(b)
+	if err != nil {
+		return registry.Descriptor{}, fmt.Errorf("could not parse manifest %s/%s:%s: %w", src.Host, repo, reference, err)
+	}
+
+	if registry.IsIndex(desc.MediaType) {
+		for _, child := range m.Manifests {
+			if _, err := w.copyManifest(ctx, src, repo, child.Digest); err != nil {
+				return registry.Descriptor{}, err
+			}
+		}
+	} else {
+		for _, blob := range m.Blobs() {
+			if err := w.copyBlob(ctx, src, repo, blob); err != nil {
+				return registry.Descriptor{}, err
+			}
+		}
+	}
+	return desc, w.writeBlob(desc.Digest, desc.Size, bytes.NewReader(b))
+}
+
+func (w *Writer) copyBlob(ctx context.Context, src *registry.Client, repo string, blob registry.Descriptor) error {
+	if !w.blobs[blob.Digest] {
+		w.blobs[blob.Digest] = true
+		w.Contents.Blobs = append(w.Contents.Blobs, blob.Digest)
+		if w.exclude[blob.Digest] {
+			w.omitted++
+			if repo, ok := w.baseRepositories[blob.Digest]; ok {
+				if w.Contents.Repositories == nil {
+					w.Contents.Repositories = make(map[string]string)
+				}
+				w.Contents.Repositories[blob.Digest] = repo
+			}
+		}
+	}
+	if w.exclude[blob.Digest] || w.files.Has(blobPath(blob.Digest)) {
+		return nil
+	}
+	r, size, err := src.GetBlob(ctx, repo, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if blob.Size == 0 {
+		blob.Size = size
+	}
+	return w.writeBlob(blob.Digest, blob.Size, r)
+}
+
+func (w *Writer) writeBlob(digest string, size int64, r io.Reader) error {
+	name := blobPath(digest)
+	if w.files.Has(name) {
+		return nil
+	}
+	// the verifier fails the write itself, so a blob not matching its digest is never stored
+	return w.files.WriteFile(name, size, newVerifier(digest, size, r))
+}
+
+// Save writes the index and contents of the layout. It may be called repeatedly
+// for layouts written to a directory, archives are only complete once closed.
+func (w *Writer) Save() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	index, err := json.MarshalIndent(w.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(w.Contents, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name string
+		b    []byte
+	}{
+		{layoutFile, []byte(layoutVersion)},
+		{indexFile, index},
+		{ContentsFile, contents},
+	} {
+		if err := w.files.WriteFile(f.name, int64(len(f.b)), bytes.NewReader(f.b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close saves the layout, completing the bundle.
+func (w *Writer) Close() error {
+	if err := w.Save(); err != nil {
+		w.files.Close()
+		return err
+	}
+	return w.files.Close()
+}
+
+// verifier computes the digest of content as it is read. Once size bytes were read, or the content
+// ended, reading fails unless the content matches the digest.
+type verifier struct {
+	r      io.Reader
+	digest string
+	size   int64
+	read   int64
+	hash   hash.Hash
+}
+
+func newVerifier(digest string, size int64, r io.Reader) *verifier {
+	h := sha256.New()
+	return &verifier{r: io.TeeReader(r, h), digest: digest, size: size, hash: h}
+}
+
+func (v *verifier) Read(p []byte) (int, error) {
+	if v.read >= v.size {
+		return 0, io.EOF
+	}
+	if rest := v.size - v.read; rest < int64(len(p)) {
+		p = p[:rest]
+	}
+	n, err := v.r.Read(p)
+	v.read += int64(n)
+	if v.read == v.size || err == io.EOF {
+		if verr := v.Verify(); verr != nil {
+			return n, verr
+		}
+	}
+	return n, err
+}
+
+func (v *verifier) Verify() error {
+	// only sha256 digests are produced by registries today
+	if !strings.HasPrefix(v.digest, "sha256:") {
+		return nil
+	}
+	if got := fmt.Sprintf("sha256:%x", v.hash.Sum(nil)); got != v.digest {
+		return fmt.Errorf("digest mismatch, expected %s but content has %s", v.digest, got)
+	}
+	return nil
+}
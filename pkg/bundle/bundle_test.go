@@ -0,0 +1,230 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+)
+
+// exportAndImport exports images from src into a bundle at path, and imports it into dst under repository.
+func exportAndImport(t *testing.T, src, dst *registrytest.Server, path string, images ...string) []ImportResult {
+	w, err := Create(path)
+	assert.Equal(t, err, nil)
+	for _, image := range images {
+		_, err := w.Add(context.Background(), src.Client(""), image)
+		assert.Equal(t, err, nil)
+	}
+	assert.Equal(t, w.Close(), nil)
+
+	r, err := Open(path)
+	assert.Equal(t, err, nil)
+	defer r.Close()
+	assert.Equal(t, r.Contents.Format, FormatOCI)
+	assert.Equal(t, len(r.Contents.Images), len(images))
+	results, err := r.Import(context.Background(), dst.Client(""), "mirror")
+	assert.Equal(t, err, nil)
+	return results
+}
+
+func TestExportImportArchive(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	dst := registrytest.NewServer()
+	defer dst.Close()
+
+	src.PushImage("rancher/shell", "v0.1.19", "base layer", "shell layer")
+	src.PushImage("rancher/kubectl", "v1.26.1", "base layer", "kubectl layer")
+	amd64 := src.PushImage("rancher/multi", "", "amd64 layer")
+	arm64 := src.PushImage("rancher/multi", "", "arm64 layer")
+	amd64.Platform = &registry.Platform{OS: "linux", Architecture: "amd64"}
+	arm64.Platform = &registry.Platform{OS: "linux", Architecture: "arm64"}
+	index := src.PutManifest("rancher/multi", "v2", registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIIndex,
+		Manifests:     []registry.Descriptor{amd64, arm64},
+	})
+
+	results := exportAndImport(t, src, dst, filepath.Join(t.TempDir(), "bundle.tar"),
+		src.Host+"/rancher/shell:v0.1.19",
+		src.Host+"/rancher/kubectl:v1.26.1",
+		src.Host+"/rancher/multi:v2",
+	)
+	assert.Equal(t, len(results), 3)
+	for _, r := range results {
+		assert.Equal(t, r.Err, nil)
+	}
+	assert.Equal(t, results[0].Target, dst.Host+"/mirror/"+src.Host+"/rancher/shell:v0.1.19")
+	assert.Equal(t, dst.Tags("mirror/"+src.Host+"/rancher/shell"), []string{"v0.1.19"})
+	assert.Equal(t, dst.HasManifest("mirror/"+src.Host+"/rancher/multi", index.Digest), true)
+	assert.Equal(t, dst.HasManifest("mirror/"+src.Host+"/rancher/multi", arm64.Digest), true)
+	// blobs the registry already holds, like the shared base layer, are not pushed again
+	assert.Equal(t, dst.Uploads(), 8)
+}
+
+func TestExportImportDirectory(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	dst := registrytest.NewServer()
+	defer dst.Close()
+	desc := src.PushImage("library/nginx", "1.23", "nginx layer")
+
+	dir := t.TempDir()
+	results := exportAndImport(t, src, dst, dir, src.Host+"/library/nginx@"+desc.Digest)
+	assert.Equal(t, results[0].Err, nil)
+	// images pinned by digest are pushed by digest
+	assert.Equal(t, dst.HasManifest("mirror/"+src.Host+"/library/nginx", desc.Digest), true)
+	assert.Equal(t, len(dst.Tags("mirror/"+src.Host+"/library/nginx")), 0)
+}
+
+func TestDockerArchive(t *testing.T) {
+	var save bytes.Buffer
+	tw := tar.NewWriter(&save)
+	manifest := []byte(`[{"Config":"config.json","RepoTags":["rancher/shell:v0.1.19"],"Layers":[]}]`)
+	tw.WriteHeader(&tar.Header{Name: "manifest.json", Size: int64(len(manifest)), Mode: 0644})
+	tw.Write(manifest)
+	tw.Close()
+
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+	err := WriteDockerArchive(path, &save, Contents{Registry: "my-registry.space", Images: []Image{{Image: "rancher/shell:v0.1.19", ID: "sha256:abc"}}})
+	assert.Equal(t, err, nil)
+
+	r, err := Open(path)
+	assert.Equal(t, err, nil)
+	defer r.Close()
+	assert.Equal(t, r.Contents.Format, FormatDockerArchive)
+	assert.Equal(t, r.Contents.Images, []Image{{Image: "rancher/shell:v0.1.19", ID: "sha256:abc"}})
+	_, err = r.Import(context.Background(), registry.NewClient("my-registry.space", ""), "")
+	assert.Equal(t, err != nil, true)
+}
+
+func TestDeltaBundle(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	dst := registrytest.NewServer()
+	defer dst.Close()
+	src.PushImage("rancher/shell", "v0.1.19", "base layer", "v0.1.19 layer")
+	src.PushImage("rancher/shell", "v0.1.20", "base layer", "v0.1.20 layer")
+
+	dir := t.TempDir()
+	full := filepath.Join(dir, "full.tar")
+	results := exportAndImport(t, src, dst, full, src.Host+"/rancher/shell:v0.1.19")
+	assert.Equal(t, results[0].Err, nil)
+	uploads := dst.Uploads()
+
+	for _, tc := range []struct {
+		name string
+		base func() (Contents, error)
+	}{
+		{"inventory", func() (Contents, error) { return Inventory(context.Background(), dst.Client("")) }},
+		{"bundle", func() (Contents, error) { return ReadContents(full) }},
+	} {
+		name := tc.name
+		contents, err := tc.base()
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(contents.Blobs), 3, name)
+
+		delta := filepath.Join(dir, name+"-delta.tar")
+		w, err := Create(delta)
+		assert.Equal(t, err, nil)
+		w.Exclude(contents, name)
+		_, err = w.Add(context.Background(), src.Client(""), src.Host+"/rancher/shell:v0.1.20")
+		assert.Equal(t, err, nil)
+		// the base layer is left out, the config differs between tags
+		assert.Equal(t, w.Omitted(), 1, name)
+		assert.Equal(t, w.Close(), nil)
+
+		r, err := Open(delta)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, r.Contents.Base, name)
+		assert.Equal(t, len(r.Contents.Blobs), 3, name)
+
+		// a registry without the base is rejected before anything is pushed
+		empty := registrytest.NewServer()
+		_, err = r.Import(context.Background(), empty.Client(""), "mirror")
+		assert.Equal(t, err != nil, true, name)
+		assert.Equal(t, empty.Uploads(), 0, name)
+		empty.Close()
+
+		results, err := r.Import(context.Background(), dst.Client(""), "mirror")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, results[0].Err, nil)
+		r.Close()
+	}
+	assert.Equal(t, dst.Tags("mirror/"+src.Host+"/rancher/shell"), []string{"v0.1.19", "v0.1.20"})
+	// only the new config and layer were pushed, by the first delta
+	assert.Equal(t, dst.Uploads(), uploads+2)
+}
+
+func TestDeltaBundleSharedLayer(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	src.PushImage("rancher/shell", "v0.1.19", "base layer", "shell layer")
+	src.PushImage("rancher/kubectl", "v1.20.2", "base layer", "kubectl layer")
+	dir := t.TempDir()
+
+	for _, tc := range []struct {
+		name string
+		base func(full string, dst *registrytest.Server) (Contents, error)
+	}{
+		{"inventory", func(_ string, dst *registrytest.Server) (Contents, error) {
+			return Inventory(context.Background(), dst.Client(""))
+		}},
+		{"bundle", func(full string, _ *registrytest.Server) (Contents, error) { return ReadContents(full) }},
+	} {
+		name := tc.name
+		dst := registrytest.NewServer()
+		full := filepath.Join(dir, name+".tar")
+		results := exportAndImport(t, src, dst, full, src.Host+"/rancher/shell:v0.1.19")
+		assert.Equal(t, results[0].Err, nil, name)
+		uploads := dst.Uploads()
+		contents, err := tc.base(full, dst)
+		assert.Equal(t, err, nil, name)
+
+		delta := filepath.Join(dir, name+"-delta.tar")
+		w, err := Create(delta)
+		assert.Equal(t, err, nil)
+		w.Exclude(contents, name)
+		_, err = w.Add(context.Background(), src.Client(""), src.Host+"/rancher/kubectl:v1.20.2")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, w.Omitted(), 1, name)
+		assert.Equal(t, w.Close(), nil)
+
+		// the base layer is only held by the repository of rancher/shell, it is mounted from there
+		r, err := Open(delta)
+		assert.Equal(t, err, nil)
+		results, err = r.Import(context.Background(), dst.Client(""), "mirror")
+		assert.Equal(t, err, nil, name)
+		assert.Equal(t, results[0].Err, nil, name)
+		r.Close()
+		assert.Equal(t, dst.Tags("mirror/"+src.Host+"/rancher/kubectl"), []string{"v1.20.2"}, name)
+		assert.Equal(t, dst.Uploads(), uploads+2, name)
+		dst.Close()
+	}
+}
+
+func TestCorruptBlob(t *testing.T) {
+	dir := t.TempDir()
+	w, err := OpenLayout(dir)
+	assert.Equal(t, err, nil)
+	content := []byte("layer")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+
+	// blobs not matching their digest are not kept, so they are fetched again by the next write
+	err = w.writeBlob(digest, int64(len(content)), bytes.NewReader([]byte("lazer")))
+	assert.Equal(t, err != nil, true)
+	assert.Equal(t, w.files.Has(blobPath(digest)), false)
+	entries, _ := os.ReadDir(filepath.Join(dir, "blobs", "sha256"))
+	assert.Equal(t, len(entries), 0)
+
+	assert.Equal(t, w.writeBlob(digest, int64(len(content)), bytes.NewReader(content)), nil)
+	assert.Equal(t, w.files.Has(blobPath(digest)), true)
+}
@@ -0,0 +1,63 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// WriteDockerArchive writes the output of docker save to dst, adding the contents file to it.
+func WriteDockerArchive(dst string, save io.Reader, contents Contents) error {
+	contents.Format = FormatDockerArchive
+	if contents.Created.IsZero() {
+		contents.Created = time.Now().UTC()
+	}
+	b, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("could not create bundle: %w", err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	tr := tar.NewReader(save)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read docker archive: %w", err)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     ContentsFile,
+		Size:     int64(len(b)),
+		Mode:     0644,
+		ModTime:  contents.Created,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, bytes.NewReader(b)); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,95 @@
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+)
+
+// Inventory lists every config and layer held by the registry c talks to, along with a
+// repository holding it, so it can be used as the base of a delta bundle destined for that registry.
+func Inventory(ctx context.Context, c *registry.Client) (Contents, error) {
+	inventory := Contents{Format: FormatInventory, Created: time.Now().UTC(), Registry: c.Host, Repositories: make(map[string]string)}
+	repos, err := c.Catalog(ctx)
+	if err != nil {
+		return inventory, fmt.Errorf("could not list repositories: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, repo := range repos {
+		tags, err := c.Tags(ctx, repo)
+		if err != nil {
+			return inventory, fmt.Errorf("could not list tags of %s: %w", repo, err)
+		}
+		manifests := make(map[string]bool)
+		for _, tag := range tags {
+			if err := inventoryManifest(ctx, c, repo, tag, manifests, seen, &inventory); err != nil {
+				return inventory, err
+			}
+		}
+	}
+	return inventory, nil
+}
+
+func inventoryManifest(ctx context.Context, c *registry.Client, repo, reference string, manifests, seen map[string]bool, inventory *Contents) error {
+	b, desc, err := c.GetManifest(ctx, repo, reference)
+	if err != nil {
+		return err
+	}
+	if manifests[desc.Digest] {
+		return nil
+	}
+	manifests[desc.Digest] = true
+	m, err := registry.ParseManifest(b)
+	if err != nil {
+		return fmt.Errorf("could not parse manifest %s/%s:%s: %w", c.Host, repo, reference, err)
+	}
+	for _, child := range m.Manifests {
+		if err := inventoryManifest(ctx, c, repo, child.Digest, manifests, seen, inventory); err != nil {
+			return err
+		}
+	}
+	for _, blob := range m.Blobs() {
+		if !seen[blob.Digest] {
+			seen[blob.Digest] = true
+			inventory.Blobs = append(inventory.Blobs, blob.Digest)
+			inventory.Repositories[blob.Digest] = repo
+		}
+	}
+	return nil
+}
+
+// WriteContents writes contents as JSON to dst, e.g. to save an inventory.
+func WriteContents(dst string, contents Contents) error {
+	b, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, b, 0644)
+}
+
+// ReadContents reads the contents of a bundle, or of a JSON file written by
+// WriteContents or extracted from a bundle.
+func ReadContents(src string) (Contents, error) {
+	if strings.HasSuffix(src, ".json") {
+		var contents Contents
+		b, err := os.ReadFile(src)
+		if err != nil {
+			return contents, err
+		}
+		if err := json.Unmarshal(b, &contents); err != nil {
+			return contents, fmt.Errorf("could not parse %s: %w", src, err)
+		}
+		return contents, nil
+	}
+	r, err := Open(src)
+	if err != nil {
+		return Contents{}, err
+	}
+	defer r.Close()
+	return r.Contents, nil
+}
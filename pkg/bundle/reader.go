@@ -0,0 +1,406 @@
+package bundle
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+)
+
+// fileReader reads the files of a bundle.
+type fileReader interface {
+	Open(name string) (io.ReadCloser, int64, error)
+	Has(name string) bool
+	Close() error
+}
+
+// tarReader indexes the entries of an archive once, so files can be read
+// in any order without extracting the archive.
+type tarReader struct {
+	f       *os.File
+	entries map[string]tarEntry
+}
+
+type tarEntry struct {
+	offset int64
+	size   int64
+}
+
+func newTarReader(src string) (*tarReader, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	t := &tarReader{f: f, entries: make(map[string]tarEntry)}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not read %s: %w", src, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// the reader is positioned at the start of the entries content
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		t.entries[path.Clean(hdr.Name)] = tarEntry{offset: offset, size: hdr.Size}
+	}
+	return t, nil
+}
+
+func (t *tarReader) Open(name string) (io.ReadCloser, int64, error) {
+	e, ok := t.entries[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	return io.NopCloser(io.NewSectionReader(t.f, e.offset, e.size)), e.size, nil
+}
+
+func (t *tarReader) Has(name string) bool {
+	_, ok := t.entries[name]
+	return ok
+}
+
+func (t *tarReader) Close() error {
+	return t.f.Close()
+}
+
+type dirReader struct {
+	dir string
+}
+
+func (d *dirReader) Open(name string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(filepath.Join(d.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func (d *dirReader) Has(name string) bool {
+	_, err := os.Stat(filepath.Join(d.dir, filepath.FromSlash(name)))
+	return err == nil
+}
+
+func (d *dirReader) Close() error {
+	return nil
+}
+
+// Reader reads a bundle created by Create or WriteDockerArchive. OCI layouts
+// written by other tools are supported as long as their index annotates images
+// with their name.
+type Reader struct {
+	Contents Contents
+	// Index is the index of an OCI layout, it is empty for docker-archives
+	Index registry.Manifest
+	path  string
+	files fileReader
+	// mounts maps the blobs left out of a delta, by repository@digest, to the repository of the target holding them
+	mounts map[string]string
+	// pushed maps the blobs pushed by Import to the repository they were pushed to
+	pushed map[string]string
+}
+
+// Open opens the bundle at src, which is either a directory or a tar archive.
+func Open(src string) (*Reader, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{path: src}
+	if info.IsDir() {
+		r.files = &dirReader{dir: src}
+	} else if r.files, err = newTarReader(src); err != nil {
+		return nil, err
+	}
+
+	if err := r.readJSON(ContentsFile, &r.Contents); err != nil && !errors.Is(err, os.ErrNotExist) {
+		r.Close()
+		return nil, err
+	}
+	if r.Contents.Format == FormatDockerArchive {
+		return r, nil
+	}
+
+	if err := r.readJSON(indexFile, &r.Index); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("%s is neither an OCI layout nor a docker-archive created by picture-book: %w", src, err)
+	}
+	if r.Contents.Format == "" {
+		r.Contents.Format = FormatOCI
+		for _, m := range r.Index.Manifests {
+			r.Contents.Images = append(r.Contents.Images, Image{Image: m.Annotations[ImageNameAnnotation], Digest: m.Digest})
+		}
+	}
+	return r, nil
+}
+
+func (r *Reader) readJSON(name string, v interface{}) error {
+	f, _, err := r.files.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("could not parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// Archive opens the whole bundle for reading, to be passed to docker load.
+func (r *Reader) Archive() (io.ReadCloser, error) {
+	return os.Open(r.path)
+}
+
+// Blob opens a blob of an OCI layout.
+func (r *Reader) Blob(digest string) (io.ReadCloser, int64, error) {
+	return r.files.Open(blobPath(digest))
+}
+
+func (r *Reader) Close() error {
+	return r.files.Close()
+}
+
+// ImportResult is the outcome of pushing a single image of a bundle.
+type ImportResult struct {
+	Image  string
+	Target string
+	Err    error
+}
+
+// Import pushes every image of an OCI layout to dst, retagging them for repository
+// the same way synchronization does. An error is only returned if the import could not
+// start or continue, the outcome of each image is reported in the results. Delta bundles
+// are only imported once every blob they left out has been found on dst, blobs found in
+// another repository are mounted rather than uploaded, as are blobs shared by several images.
+func (r *Reader) Import(ctx context.Context, dst *registry.Client, repository string) ([]ImportResult, error) {
+	if r.Contents.Format != FormatOCI {
+		return nil, fmt.Errorf("bundle is a %s, only OCI layouts can be pushed directly", r.Contents.Format)
+	}
+	var results []ImportResult
+	for _, desc := range r.Index.Manifests {
+		image := desc.Annotations[ImageNameAnnotation]
+		if image == "" {
+			return nil, fmt.Errorf("manifest %s in index.json has no %s annotation", desc.Digest, ImageNameAnnotation)
+		}
+		results = append(results, ImportResult{Image: image, Target: pkg.ReTag(image, dst.Host, repository)})
+	}
+	r.mounts = make(map[string]string)
+	r.pushed = make(map[string]string)
+	if err := r.verifyBase(ctx, dst, repository, results); err != nil {
+		return nil, err
+	}
+
+	for i, desc := range r.Index.Manifests {
+		results[i].Err = r.push(ctx, dst, desc, results[i].Target)
+		if ctx.Err() != nil {
+			return results[:i+1], ctx.Err()
+		}
+	}
+	return results, nil
+}
+
+// verifyBase checks that the blobs left out of a delta bundle exist on dst before anything is pushed,
+// either in the repositories the images are pushed to or in one they can be mounted from.
+func (r *Reader) verifyBase(ctx context.Context, dst *registry.Client, repository string, results []ImportResult) error {
+	var missing []string
+	for i, desc := range r.Index.Manifests {
+		base, err := r.baseBlobs(desc)
+		if err != nil {
+			return err
+		}
+		if len(base) == 0 {
+			continue
+		}
+		ref, err := registry.ParseReference(results[i].Target)
+		if err != nil {
+			return err
+		}
+		for _, digest := range base {
+			from, err := r.locateBase(ctx, dst, repository, ref.Repository, digest)
+			if err != nil {
+				return fmt.Errorf("could not verify base blobs of %s: %w", results[i].Image, err)
+			}
+			if from == "" {
+				missing = append(missing, fmt.Sprintf("%s (%s)", digest, ref.Name()))
+			} else if from != ref.Repository {
+				r.mounts[ref.Repository+"@"+digest] = from
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("bundle is a delta of %s, but %d blobs it relies on are missing from %s, import the base first: %s",
+			r.Contents.Base, len(missing), dst.Host, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// locateBase returns the repository of dst holding a blob left out of the bundle, or an empty string if
+// none does. Besides repo itself, the repository recorded by the bundle and those the base images were
+// imported to are searched.
+func (r *Reader) locateBase(ctx context.Context, dst *registry.Client, repository, repo, digest string) (string, error) {
+	candidates := []string{repo}
+	if from, ok := r.Contents.Repositories[digest]; ok {
+		candidates = append(candidates, from)
+	}
+	for _, image := range r.Contents.BaseImages {
+		ref, err := registry.ParseReference(pkg.ReTag(image, dst.Host, repository))
+		if err != nil {
+			return "", err
+		}
+		candidates = append(candidates, ref.Repository)
+	}
+	searched := make(map[string]bool)
+	for _, from := range candidates {
+		if searched[from] {
+			continue
+		}
+		searched[from] = true
+		exists, err := dst.BlobExists(ctx, from, digest)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return from, nil
+		}
+	}
+	return "", nil
+}
+
+// baseBlobs returns the configs and layers referenced by desc which are not in the bundle.
+func (r *Reader) baseBlobs(desc registry.Descriptor) ([]string, error) {
+	m, _, err := r.manifest(desc)
+	if err != nil {
+		return nil, err
+	}
+	var base []string
+	for _, child := range m.Manifests {
+		childBase, err := r.baseBlobs(child)
+		if err != nil {
+			return nil, err
+		}
+		base = append(base, childBase...)
+	}
+	for _, blob := range m.Blobs() {
+		if !r.files.Has(blobPath(blob.Digest)) {
+			base = append(base, blob.Digest)
+		}
+	}
+	return base, nil
+}
+
+// manifest reads the manifest desc refers to, returning it along with its content.
+func (r *Reader) manifest(desc registry.Descriptor) (registry.Manifest, []byte, error) {
+	f, _, err := r.Blob(desc.Digest)
+	if err != nil {
+		return registry.Manifest{}, nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return registry.Manifest{}, nil, err
+	}
+	m, err := registry.ParseManifest(b)
+	if err != nil {
+		return m, nil, fmt.Errorf("could not parse manifest %s: %w", desc.Digest, err)
+	}
+	return m, b, nil
+}
+
+func (r *Reader) push(ctx context.Context, dst *registry.Client, desc registry.Descriptor, target string) error {
+	ref, err := registry.ParseReference(target)
+	if err != nil {
+		return err
+	}
+	reference := ref.Tag
+	if reference == "" {
+		reference = desc.Digest
+	}
+	return r.pushManifest(ctx, dst, ref.Repository, desc, reference)
+}
+
+func (r *Reader) pushManifest(ctx context.Context, dst *registry.Client, repo string, desc registry.Descriptor, reference string) error {
+	m, b, err := r.manifest(desc)
+	if err != nil {
+		return err
+	}
+	mediaType := desc.MediaType
+	if m.MediaType != "" {
+		mediaType = m.MediaType
+	}
+
+	if registry.IsIndex(mediaType) {
+		for _, child := range m.Manifests {
+			if err := r.pushManifest(ctx, dst, repo, child, child.Digest); err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, blob := range m.Blobs() {
+			if err := r.pushBlob(ctx, dst, repo, blob); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = dst.PutManifest(ctx, repo, reference, mediaType, b)
+	return err
+}
+
+func (r *Reader) pushBlob(ctx context.Context, dst *registry.Client, repo string, blob registry.Descriptor) error {
+	exists, err := dst.BlobExists(ctx, repo, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if from, ok := r.mounts[repo+"@"+blob.Digest]; ok {
+		mounted, err := dst.MountBlob(ctx, repo, blob.Digest, from)
+		if err != nil {
+			return err
+		}
+		if !mounted {
+			return fmt.Errorf("%s could not mount %s from %s into %s", dst.Host, blob.Digest, from, repo)
+		}
+		return nil
+	}
+	// blobs shared with an image pushed before are mounted from its repository, falling back to an upload
+	if from, ok := r.pushed[blob.Digest]; ok {
+		if mounted, err := dst.MountBlob(ctx, repo, blob.Digest, from); err == nil && mounted {
+			return nil
+		}
+	}
+	f, size, err := r.Blob(blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	blob.Size = size
+	if err := dst.PushBlob(ctx, repo, blob, f); err != nil {
+		return err
+	}
+	r.pushed[blob.Digest] = repo
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"github.com/pkg/errors"
 	"os/exec"
 	"strings"
@@ -20,6 +19,9 @@ var Logger *logrus.Logger
 var ErrLogger *logrus.Logger
 
 type Registry struct {
+	// Name uniquely identifies the synchronization job, it defaults to Hostname.
+	// Several jobs may target the same registry, as long as their names differ.
+	Name string `yaml:"name"`
 	// Hostname of the registry, not including https
 	Hostname string `yaml:"hostname"`
 	// Repository is a prefix added to an image which denotes a particular base repository
@@ -31,29 +33,259 @@ type Registry struct {
 	PullAuthConfig string `yaml:"pullAuthConfig"`
 	// SyncPeriod is a cron configuration
 	SyncPeriod string `yaml:"syncPeriod"`
+	// ReconcilePeriod enables change-only runs, e.g. 24h. Runs skip the images which were listed by the previous run and
+	// already mirrored from their current source digest without checking the targets, and only check every image once per period.
+	ReconcilePeriod string `yaml:"reconcilePeriod"`
 	// SyncerScript points to the script that should be
 	// used to get new images for syncing
 	SyncerScript string `yaml:"syncerScript"`
 	// SyncerScriptArgs is a string containing flags and arguments which can be passed to as syncer script
 	SyncerScriptArgs string `yaml:"syncerScriptArgs"`
-	// RegistryProvider is the type of registry (docker / harbor)
+	// Catalog mirrors the repositories of another registry, listed through its catalog API
+	Catalog *CatalogConfig `yaml:"catalog"`
+	// Kubernetes mirrors the images run by a cluster
+	Kubernetes *KubernetesConfig `yaml:"kubernetes"`
+	// Helm mirrors the images referenced by a Helm chart or a directory of manifests
+	Helm *HelmConfig `yaml:"helm"`
+	// Sources are further image sources, whose images are merged with those of SyncerScript, Catalog, Kubernetes, and Helm
+	Sources []SourceConfig `yaml:"sources"`
+	// RegistryProvider is the type of registry (docker / harbor / ecr). Harbor projects and ECR
+	// repositories are created before images are first pushed to them.
 	RegistryProvider string `yaml:"registryProvider"`
+	// Provider configures the projects and repositories created on harbor and ecr registries
+	Provider ProviderConfig `yaml:"provider"`
 	// DeleteLocalImages instructs the syncer to remove locally downloaded images after pushing them to a registry.
 	DeleteLocalImages bool `yaml:"deleteLocalImages"`
+	// DiskBudget is the maximum size of the images picture-book keeps in the local docker storage, e.g. 20GB.
+	// When exceeded, the least recently synchronized images it pulled are removed. Images it did not pull are never removed.
+	DiskBudget string `yaml:"diskBudget"`
+	// Verify configures signature verification of images before they are mirrored
+	Verify VerifyConfig `yaml:"verify"`
+	// CopyArtifacts instructs the syncer to copy signatures, attestations, SBOMs, and other
+	// OCI referrers of each image into the target registry alongside it.
+	CopyArtifacts bool `yaml:"copyArtifacts"`
+	// Scan configures a vulnerability scan of images before they are pushed
+	Scan ScanConfig `yaml:"scan"`
+	// Policy declares the rules images must follow to be mirrored. When not set, the
+	// top level policy of config.yaml applies.
+	Policy *PolicyConfig `yaml:"policy"`
+	// Layout is a directory holding an OCI image layout, which images are written to instead
+	// of being pushed to Hostname. Hostname is still used to name the images within the layout.
+	Layout string `yaml:"layout"`
+	// Prune configures the removal of images which are no longer listed by the image sources
+	Prune PruneConfig `yaml:"prune"`
+	// Targets are further registries the images are pushed to alongside Hostname. The image list
+	// is computed and each image pulled once, then pushed to every target in parallel.
+	Targets []Target `yaml:"targets"`
+	// Webhook lets registries report the images pushed to them, which are then synchronized right away
+	Webhook *WebhookConfig `yaml:"webhook"`
+	// Hooks are commands run around each synchronization
+	Hooks HooksConfig `yaml:"hooks"`
+}
+
+// Target is a registry the images of a job are pushed to.
+type Target struct {
+	Hostname string `yaml:"hostname"`
+	// Repository defaults to the Repository of the job
+	Repository string `yaml:"repository"`
+	// PushAuthConfig defaults to the PushAuthConfig of the job
+	PushAuthConfig string `yaml:"pushAuthConfig" json:"-"`
+	// RegistryProvider defaults to the RegistryProvider of the job
+	RegistryProvider string `yaml:"registryProvider"`
+}
+
+// ProviderConfig configures the projects and repositories registry providers create.
+type ProviderConfig struct {
+	// Endpoint is the URL of the provider API, defaults to https://<hostname> for harbor and the regional endpoint for ecr
+	Endpoint string `yaml:"endpoint"`
+	// Public makes the Harbor projects created public, they are private by default
+	Public bool `yaml:"public"`
+	// ScanOnPush scans the images pushed to the projects and repositories created for vulnerabilities
+	ScanOnPush bool `yaml:"scanOnPush"`
+	// ImmutableTags keeps the tags of the ECR repositories created from being overwritten
+	ImmutableTags bool `yaml:"immutableTags"`
+	// Retention is the number of most recently pushed images kept in each project or repository, every image when 0
+	Retention int `yaml:"retention"`
+	// Region of ECR, defaults to the region of the hostname, e.g. 123456789012.dkr.ecr.us-east-1.amazonaws.com, or $AWS_REGION
+	Region string `yaml:"region"`
+	// AccessKeyID, SecretAccessKey, and SessionToken are the AWS credentials ECR is called with,
+	// default to $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY, and $AWS_SESSION_TOKEN
+	AccessKeyID     string `yaml:"accessKeyID" json:"-"`
+	SecretAccessKey string `yaml:"secretAccessKey" json:"-"`
+	SessionToken    string `yaml:"sessionToken" json:"-"`
+}
+
+// CatalogConfig selects the repositories of a source registry which are mirrored with every tag they hold.
+type CatalogConfig struct {
+	// Registry is the host of the source registry, authenticated with the PullAuthConfig of the job
+	Registry string `yaml:"registry"`
+	// Include are the patterns of the repository names mirrored, every repository when empty
+	Include []string `yaml:"include"`
+	// Exclude are the patterns of the repository names left out, even if included
+	Exclude []string `yaml:"exclude"`
+}
+
+// KubernetesConfig selects the cluster, and its namespaces, whose workloads list the images to mirror.
+type KubernetesConfig struct {
+	// Kubeconfig is the path of the kubeconfig file, defaults to $KUBECONFIG, ~/.kube/config, or the in-cluster configuration
+	Kubeconfig string `yaml:"kubeconfig"`
+	// Context is the kubeconfig context used, defaults to the current context
+	Context string `yaml:"context"`
+	// Namespaces are the namespaces images are discovered in, every namespace when empty
+	Namespaces []string `yaml:"namespaces"`
+}
+
+// HelmConfig selects the chart, or the manifests, whose image references list the images to mirror.
+type HelmConfig struct {
+	// Chart is a chart directory or .tgz archive, rendered with helm template
+	Chart string `yaml:"chart"`
+	// Values are the values files the chart is rendered with
+	Values []string `yaml:"values"`
+	// Manifests is a directory of Kubernetes YAML files, read instead of rendering a chart
+	Manifests string `yaml:"manifests"`
+	// Push pushes the chart to every target registry as an OCI artifact, under the repository of the target
+	Push bool `yaml:"push"`
+	// Output is a directory the manifests are written to after each run, with their images rewritten to the mirror
+	Output string `yaml:"output"`
+}
+
+// HooksConfig lists the commands run around the synchronizations of a job.
+type HooksConfig struct {
+	// PreSync runs before the images are listed, the run fails when it does
+	PreSync *HookConfig `yaml:"preSync"`
+	// PostSync runs once a run is done, whatever its result
+	PostSync *HookConfig `yaml:"postSync"`
+	// OnImagePushed runs after an image was pushed to a target
+	OnImagePushed *HookConfig `yaml:"onImagePushed"`
+	// OnFailure runs after a run which failed, following PostSync
+	OnFailure *HookConfig `yaml:"onFailure"`
+}
+
+// HookConfig is a command run by a hook, with environment variables describing the job and the run.
+type HookConfig struct {
+	Command string `yaml:"command"`
+	// Args are passed to Command, separated by spaces
+	Args string `yaml:"args"`
+	// Timeout is the maximum duration of the command, defaults to 5m
+	Timeout string `yaml:"timeout"`
+}
+
+// WebhookConfig maps the push events registries send to the webhook endpoint of the API to a job.
+type WebhookConfig struct {
+	// Secret is shared with the registries sending events, events sent with any other secret are rejected
+	Secret string `yaml:"secret" json:"-"`
+	// Images are the patterns of the pushed images synchronized by the job, e.g. docker.io/rancher/**, matched
+	// against the registry and repository of each image. Every pushed image is synchronized when empty.
+	Images []string `yaml:"images"`
+}
+
+// PruneConfig configures the deletion of stale images, those picture-book mirrored
+// which have since dropped out of the syncer scripts output.
+type PruneConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Source is where the images considered for pruning come from, either state (default), the images
+	// picture-book recorded pushing, or registry, every tag found under Repository on the registry.
+	Source string `yaml:"source"`
+	// GracePeriod is how long an image must be missing from the syncer scripts output before it is deleted, defaults to 24h
+	GracePeriod string `yaml:"gracePeriod"`
+	// DryRun reports the images which would be deleted, without deleting them
+	DryRun bool `yaml:"dryRun"`
+}
+
+// PolicyConfig declares allow and deny rules which are evaluated for each image before it is pulled.
+type PolicyConfig struct {
+	// AllowedRegistries are patterns of the source registries images may come from, e.g. docker.io or *.gcr.io.
+	// Any registry is allowed when empty.
+	AllowedRegistries []string `yaml:"allowedRegistries"`
+	// DeniedRepositories are patterns of repositories which are never mirrored. They are matched against both
+	// the repository (library/nginx) and the repository including its registry (docker.io/library/nginx).
+	DeniedRepositories []string `yaml:"deniedRepositories"`
+	// RequireDigest requires images to be pinned by digest, e.g. nginx@sha256:...
+	RequireDigest bool `yaml:"requireDigest"`
+	// MaxSize is the maximum compressed size of an image, e.g. 500MB or 2GiB
+	MaxSize string `yaml:"maxSize"`
+	// Platforms are patterns of the allowed platforms, e.g. linux/amd64 or linux/arm*.
+	// An image must be available for at least one of them.
+	Platforms []string `yaml:"platforms"`
+	// Labels are the labels an image must have, either as 'name' or 'name=value', where value may be a pattern
+	Labels []string `yaml:"labels"`
+	// OnFailure is either skip (default) or block, see VerifyConfig.OnFailure
+	OnFailure string `yaml:"onFailure"`
+}
+
+// ScanConfig configures the vulnerability scan gate for a registry.
+type ScanConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Command is the scanner to run, e.g. trivy. It must write its report to stdout.
+	Command string `yaml:"command"`
+	// Args are passed to Command, {image} is replaced with the image being scanned
+	Args string `yaml:"args"`
+	// Report is the path of a pre-generated report, read instead of running Command.
+	// {image} is replaced with the image name, with '/' and ':' replaced by '_'.
+	Report string `yaml:"report"`
+	// Format of the report, one of trivy, grype, or sarif. It is detected when empty.
+	Format string `yaml:"format"`
+	// Severity is the lowest severity which prevents an image from being pushed, defaults to CRITICAL
+	Severity string `yaml:"severity"`
+	// IgnoreUnfixed ignores vulnerabilities which have no fix available
+	IgnoreUnfixed bool `yaml:"ignoreUnfixed"`
+	// OnFailure is either skip (default) or block, see VerifyConfig.OnFailure
+	OnFailure string `yaml:"onFailure"`
+	// Timeout is the maximum duration of a single scan, defaults to 10m
+	Timeout string `yaml:"timeout"`
+}
+
+// VerifyConfig configures signature verification for a registry.
+type VerifyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Tool is the verifier used, either cosign (default) or notation
+	Tool string `yaml:"tool"`
+	// Binary is the path to the verification tool, defaults to Tool found on the PATH
+	Binary string `yaml:"binary"`
+	// Keys are paths to cosign public keys. An image must be signed by at least one of them.
+	Keys []string `yaml:"keys"`
+	// TrustPolicy is the path to a trust policy file which maps image patterns to cosign public keys.
+	// Notation uses its own trust policy, configured through the notation CLI.
+	TrustPolicy string `yaml:"trustPolicy"`
+	// OnFailure is either skip (default), which skips images that fail verification,
+	// or block, which stops the synchronization entirely.
+	OnFailure string `yaml:"onFailure"`
+	// Timeout is the maximum duration of a single verification, defaults to 2m
+	Timeout string `yaml:"timeout"`
 }
 
 type Registries []Registry
 
-var RegistryNotFound = errors.New("could not find provided registry by hostname")
+var RegistryNotFound = errors.New("could not find provided registry by name or hostname")
+var RegistryAmbiguous = errors.New("several jobs synchronize the provided registry, select one by name")
 var ImageNotFound = errors.New("repository does not exist")
 
-func (r Registries) GetRegistry(hostname string) (Registry, error) {
+// JobName returns the name of the synchronization job, which defaults to the hostname of the registry.
+func (r Registry) JobName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Hostname
+}
+
+// GetRegistry looks up a job by name. A hostname may be used instead, as long as a single job targets that registry.
+func (r Registries) GetRegistry(name string) (Registry, error) {
+	var found []Registry
 	for _, registry := range r {
-		if registry.Hostname == hostname {
+		if registry.JobName() == name {
 			return registry, nil
 		}
+		if registry.Hostname == name {
+			found = append(found, registry)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Registry{}, RegistryNotFound
+	case 1:
+		return found[0], nil
 	}
-	return Registry{}, RegistryNotFound
+	return Registry{}, RegistryAmbiguous
 }
 
 type Executor struct {
@@ -70,11 +302,16 @@ type SyncerBase struct {
 	context.Context    `json:"-"`
 	context.CancelFunc `json:"-"`
 	Details            Details
-	Executor           Executor `json:"-"`
+	Name               string
+	Sources            []ImageSource `json:"-"`
 	RegistryHostName   string
 	Repository         string
 	JobTag             string
 	RemoveLocalImages  bool
+	DiskBudget         int64
+	CopyArtifacts      bool
+	Prune              PruneConfig
+	Targets            []Target
 	PullAuth           string `json:"-"`
 	PushAuth           string `json:"-"`
 	Job                *gocron.Job
@@ -82,10 +319,10 @@ type SyncerBase struct {
 
 func (e *Executor) ExecScript() ([]string, error) {
 
-	Logger.Infof("Executing %s", e.File)
+	Logger.WithField("script", e.File).Infof("Executing %s", e.File)
 
 	cmd := exec.Command(e.File, strings.Split(e.Args, " ")...)
-	fmt.Println(cmd.String())
+	Logger.WithField("script", e.File).Debugf("Running %s", cmd.String())
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, err
@@ -164,6 +401,20 @@ func BuildEncodedAuthConfig(config types.AuthConfig) string {
 	return base64.URLEncoding.EncodeToString(authConfigBytes)
 }
 
-func BuildCronJobTag(registryHostName string) string {
-	return registryHostName + "-job"
+func BuildCronJobTag(jobName string) string {
+	return jobName + "-job"
+}
+
+// DockerStatusOutput is a single line of the JSON progress stream
+// returned by the docker daemon when pulling or pushing an image.
+type DockerStatusOutput struct {
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int `json:"current"`
+		Total   int `json:"total"`
+	} `json:"progressDetail"`
+	Progress string `json:"progress"`
+	ID       string `json:"id"`
+	// Error is set when the daemon failed the operation part way through.
+	Error string `json:"error"`
 }
@@ -14,3 +14,23 @@ func TestRetag(t *testing.T) {
 	assert.Equal(t, ReTag(image, host, "test-image"), "my-registry.space/test-image/discovery-server:latest")
 	assert.Equal(t, ReTag(image, host, ""), "my-registry.space/discovery-server:latest")
 }
+
+func TestGetRegistry(t *testing.T) {
+	registries := Registries{
+		{Name: "rancher", Hostname: "my-registry.space", Repository: "rancher"},
+		{Name: "apps", Hostname: "my-registry.space", Repository: "apps"},
+		{Hostname: "edge.local"},
+	}
+
+	r, err := registries.GetRegistry("apps")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, r.Repository, "apps")
+	r, err = registries.GetRegistry("edge.local")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, r.JobName(), "edge.local")
+
+	_, err = registries.GetRegistry("my-registry.space")
+	assert.Equal(t, err, RegistryAmbiguous)
+	_, err = registries.GetRegistry("other.space")
+	assert.Equal(t, err, RegistryNotFound)
+}
@@ -3,11 +3,16 @@ package config
 import (
 	"fmt"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/notify"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/ratelimit"
 	"github.com/spf13/viper"
 )
 
 var ConfiguredRegistries pkg.Registries
 
+// Notifier sends notifications to the sinks configured in the notifications section
+var Notifier *notify.Notifier
+
 func Setup() {
 	viper.SetConfigName("")
 	viper.SetConfigType("yaml")
@@ -20,4 +25,35 @@ func Setup() {
 	if err := viper.UnmarshalKey("registries", &ConfiguredRegistries); err != nil {
 		panic(fmt.Errorf("Could not unmarshal config.yaml file: %w", err))
 	}
+
+	// registries without a policy of their own follow the top level policy
+	if viper.IsSet("policy") {
+		var policy pkg.PolicyConfig
+		if err := viper.UnmarshalKey("policy", &policy); err != nil {
+			panic(fmt.Errorf("Could not unmarshal policy in config.yaml file: %w", err))
+		}
+		for i := range ConfiguredRegistries {
+			if ConfiguredRegistries[i].Policy == nil {
+				ConfiguredRegistries[i].Policy = &policy
+			}
+		}
+	}
+
+	var limits []ratelimit.Config
+	if err := viper.UnmarshalKey("rateLimits", &limits); err != nil {
+		panic(fmt.Errorf("Could not unmarshal rateLimits in config.yaml file: %w", err))
+	}
+	if err := ratelimit.Configure(limits); err != nil {
+		panic(fmt.Errorf("Invalid rateLimits in config.yaml file: %w", err))
+	}
+
+	var sinks []notify.SinkConfig
+	if err := viper.UnmarshalKey("notifications", &sinks); err != nil {
+		panic(fmt.Errorf("Could not unmarshal notifications in config.yaml file: %w", err))
+	}
+	notifier, err := notify.New(sinks)
+	if err != nil {
+		panic(fmt.Errorf("Invalid notifications in config.yaml file: %w", err))
+	}
+	Notifier = notifier
 }
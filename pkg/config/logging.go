@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	easy "github.com/t-tomalak/logrus-easy-formatter"
+)
+
+// Logging is the logging section of config.yaml
+type Logging struct {
+	// Level is any level understood by logrus, defaults to info
+	Level string `yaml:"level"`
+	// Format is either 'json', 'text', or empty. The empty format is a compact
+	// layout intended for terminals which does not include structured fields.
+	Format string `yaml:"format"`
+	// File is a path logs are appended to instead of stderr
+	File string `yaml:"file"`
+}
+
+// SetupLogging builds pkg.Logger and pkg.ErrLogger from the logging section of config.yaml
+func SetupLogging() error {
+	var conf Logging
+	if err := viper.UnmarshalKey("logging", &conf); err != nil {
+		return fmt.Errorf("could not unmarshal logging configuration: %w", err)
+	}
+
+	level := logrus.InfoLevel
+	if conf.Level != "" {
+		l, err := logrus.ParseLevel(conf.Level)
+		if err != nil {
+			return fmt.Errorf("invalid logging level: %w", err)
+		}
+		level = l
+	}
+
+	var out io.Writer = os.Stderr
+	if conf.File != "" {
+		f, err := os.OpenFile(conf.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("could not open log file: %w", err)
+		}
+		out = f
+	}
+
+	var formatter, errFormatter logrus.Formatter
+	switch conf.Format {
+	case "json":
+		formatter = &logrus.JSONFormatter{TimestampFormat: pkg.TimeFormat}
+		errFormatter = formatter
+	case "text":
+		formatter = &logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: pkg.TimeFormat,
+			DisableColors:   conf.File != "",
+		}
+		errFormatter = formatter
+	case "":
+		formatter = &easy.Formatter{
+			TimestampFormat: pkg.TimeFormat,
+			LogFormat:       "[%time%] %msg%\n",
+		}
+		errFormatter = &easy.Formatter{
+			TimestampFormat: pkg.TimeFormat,
+			LogFormat:       "[%lvl%][%time%] %msg%\n",
+		}
+	default:
+		return fmt.Errorf("invalid logging format %q, expected 'json', 'text', or empty", conf.Format)
+	}
+
+	pkg.Logger = &logrus.Logger{
+		Out:       out,
+		Level:     level,
+		Formatter: formatter,
+		Hooks:     make(logrus.LevelHooks),
+	}
+	pkg.ErrLogger = &logrus.Logger{
+		Out:       out,
+		Level:     level,
+		Formatter: errFormatter,
+		Hooks:     make(logrus.LevelHooks),
+	}
+	return nil
+}
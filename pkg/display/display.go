@@ -0,0 +1,87 @@
+package display
+
+import (
+	"fmt"
+	"sort"
+	mutex "sync"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+// Display renders the progress of the operations a Syncer performs.
+// A single Display may be shared by many Syncers running at the same time.
+type Display interface {
+	// Start is called when a Syncer begins an operation (Pulling, Pushing, Retagging...)
+	// on an image. The returned Operation receives all updates for it.
+	Start(registry, op, image string) Operation
+}
+
+// Operation is a single in-flight operation of a Display.
+type Operation interface {
+	// Update is called for every line of status output the docker daemon reports.
+	// Operations which don't talk to the daemon, such as retagging, never receive updates.
+	Update(status pkg.DockerStatusOutput)
+	// Done is called once when the operation finishes, err is nil on success.
+	Done(err error)
+}
+
+// Factory builds a new Display.
+type Factory func() Display
+
+var (
+	factoriesMu mutex.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a Display available under the given name, which
+// can then be selected using the display option in config.yaml.
+func Register(name string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = f
+}
+
+// New builds the Display registered under name.
+// An empty name selects the plain log display.
+func New(name string) (Display, error) {
+	if name == "" {
+		name = "std"
+	}
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	f, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown display %q, valid displays are %v", name, names())
+	}
+	return f(), nil
+}
+
+func names() []string {
+	var n []string
+	for name := range factories {
+		n = append(n, name)
+	}
+	sort.Strings(n)
+	return n
+}
+
+func init() {
+	Register("std", func() Display { return &Logs{} })
+	Register("json", func() Display { return NewJSON(nil) })
+	Register("spinner", func() Display { return &Spinner{} })
+	Register("tui", func() Display { return NewTUI(nil) })
+}
+
+// FormatBytes renders a number of bytes in a human readable form.
+func FormatBytes(b int) string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := unit, 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(b)/float64(div), "kMGTPE"[exp])
+}
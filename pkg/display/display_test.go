@@ -0,0 +1,90 @@
+package display
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestNewUnknownDisplay(t *testing.T) {
+	_, err := New("fireworks")
+	assert.Equal(t, err != nil, true)
+
+	d, err := New("")
+	assert.Equal(t, err, nil)
+	_, ok := d.(*Logs)
+	assert.Equal(t, ok, true)
+}
+
+func TestJSONDisplay(t *testing.T) {
+	var buf bytes.Buffer
+	op := NewJSON(&buf).Start("my-registry.space", "Pulling", "rancher/shell:v0.1.19")
+	status := pkg.DockerStatusOutput{Status: "Downloading", ID: "a1b2c3"}
+	status.ProgressDetail.Current = 10
+	status.ProgressDetail.Total = 20
+	op.Update(status)
+	op.Done(errors.New("boom"))
+
+	var lines []jsonLine
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var l jsonLine
+		assert.Equal(t, dec.Decode(&l), nil)
+		lines = append(lines, l)
+	}
+	assert.Equal(t, len(lines), 3)
+	assert.Equal(t, lines[1].Layer, "a1b2c3")
+	assert.Equal(t, lines[1].Current, 10)
+	assert.Equal(t, lines[2].Done, true)
+	assert.Equal(t, lines[2].Error, "boom")
+}
+
+func TestTUIDisplay(t *testing.T) {
+	var buf bytes.Buffer
+	tui := NewTUI(&buf)
+	// frame renders the operations in flight, the buffer is only used with the lock held since frames are redrawn periodically
+	frame := func() []string {
+		tui.mu.Lock()
+		defer tui.mu.Unlock()
+		buf.Reset()
+		tui.drawn = 0
+		tui.render()
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	}
+
+	op := tui.Start("my-registry.space", "Pulling", "rancher/shell:v0.1.19")
+	assert.Equal(t, frame(), []string{"[my-registry.space] Pulling rancher/shell:v0.1.19"})
+
+	status := pkg.DockerStatusOutput{Status: "Downloading", ID: "a1b2c3"}
+	status.ProgressDetail.Current = 1500
+	status.ProgressDetail.Total = 3000
+	op.Update(status)
+	op.Update(pkg.DockerStatusOutput{Status: "Waiting", ID: "d4e5f6"})
+	assert.Equal(t, frame(), []string{
+		"[my-registry.space] Pulling rancher/shell:v0.1.19 [============>           ] 1.5kB/3.0kB",
+		"    d4e5f6 Waiting",
+		"    a1b2c3 Downloading [============>           ] 1.5kB/3.0kB",
+	})
+
+	// finished operations are printed once, above the block, which no longer holds them
+	tui.mu.Lock()
+	buf.Reset()
+	tui.mu.Unlock()
+	op.Done(errors.New("boom"))
+	tui.mu.Lock()
+	out := buf.String()
+	tui.mu.Unlock()
+	assert.Equal(t, strings.HasPrefix(out, "\x1b[3A\x1b[J✗ [my-registry.space] Pulling rancher/shell:v0.1.19 failed after 0s: boom\n"), true, out)
+	assert.Equal(t, frame(), []string{""})
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, FormatBytes(999), "999B")
+	assert.Equal(t, FormatBytes(1500), "1.5kB")
+	assert.Equal(t, FormatBytes(42_000_000), "42.0MB")
+}
@@ -0,0 +1,78 @@
+package display
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	mutex "sync"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+// JSON writes one JSON object per line for every update, suitable for consumption by other tools.
+type JSON struct {
+	mu  mutex.Mutex
+	enc *json.Encoder
+}
+
+type jsonLine struct {
+	Time     time.Time `json:"time"`
+	Registry string    `json:"registry"`
+	Op       string    `json:"op"`
+	Image    string    `json:"image"`
+	Layer    string    `json:"layer,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Current  int       `json:"current,omitempty"`
+	Total    int       `json:"total,omitempty"`
+	Done     bool      `json:"done,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// NewJSON builds a JSON display writing to w, or to stdout if w is nil.
+func NewJSON(w io.Writer) *JSON {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &JSON{enc: json.NewEncoder(w)}
+}
+
+func (j *JSON) write(line jsonLine) {
+	line.Time = time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.enc.Encode(line)
+}
+
+func (j *JSON) Start(registry, op, image string) Operation {
+	j.write(jsonLine{Registry: registry, Op: op, Image: image, Status: "started"})
+	return &jsonOperation{display: j, registry: registry, op: op, image: image}
+}
+
+type jsonOperation struct {
+	display  *JSON
+	registry string
+	op       string
+	image    string
+}
+
+func (o *jsonOperation) Update(status pkg.DockerStatusOutput) {
+	o.display.write(jsonLine{
+		Registry: o.registry,
+		Op:       o.op,
+		Image:    o.image,
+		Layer:    status.ID,
+		Status:   status.Status,
+		Current:  status.ProgressDetail.Current,
+		Total:    status.ProgressDetail.Total,
+		Error:    status.Error,
+	})
+}
+
+func (o *jsonOperation) Done(err error) {
+	line := jsonLine{Registry: o.registry, Op: o.op, Image: o.image, Done: true}
+	if err != nil {
+		line.Error = err.Error()
+	}
+	o.display.write(line)
+}
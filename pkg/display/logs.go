@@ -0,0 +1,51 @@
+package display
+
+import (
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+// Logs writes each status line reported by the docker daemon to the logger.
+// It is verbose, but remains readable when several registries sync at once.
+type Logs struct{}
+
+func (l *Logs) Start(registry, op, image string) Operation {
+	fields := logrus.Fields{
+		"registry": registry,
+		"image":    image,
+		"stage":    op,
+	}
+	o := &logsOperation{
+		log:    pkg.Logger.WithFields(fields),
+		errLog: pkg.ErrLogger.WithFields(fields),
+		op:     op,
+		image:  image,
+	}
+	o.log.Infof("%s: %s %s", registry, op, image)
+	return o
+}
+
+type logsOperation struct {
+	log    *logrus.Entry
+	errLog *logrus.Entry
+	op     string
+	image  string
+}
+
+func (o *logsOperation) Update(status pkg.DockerStatusOutput) {
+	log := o.log
+	if status.ID != "" {
+		log = log.WithField("layer", status.ID)
+	}
+	if status.Progress == "" {
+		log.Infof("%s: %s: %s", o.image, status.ID, status.Status)
+	} else {
+		log.Infof("%s: %s: %s %s", o.image, status.ID, status.Status, status.Progress)
+	}
+}
+
+func (o *logsOperation) Done(err error) {
+	if err != nil {
+		o.errLog.Errorf("%s %s failed: %v", o.op, o.image, err)
+	}
+}
@@ -0,0 +1,53 @@
+package display
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/theckman/yacspin"
+)
+
+var spinnerConfig = yacspin.Config{
+	Frequency:         100 * time.Millisecond,
+	CharSet:           yacspin.CharSets[59],
+	Suffix:            "",
+	SuffixAutoColon:   true,
+	Message:           "",
+	StopCharacter:     "✓",
+	StopColors:        []string{"fgGreen"},
+	StopFailCharacter: "✗",
+	StopFailColors:    []string{"fgRed"},
+}
+
+// Spinner displays a single spinner for each operation. It looks nice, but
+// garbles the terminal when several registries are synchronized at the same time.
+type Spinner struct{}
+
+func (s *Spinner) Start(_, op, image string) Operation {
+	spinner, _ := yacspin.New(spinnerConfig)
+	spinner.Suffix(fmt.Sprintf("[%s] %s %s", time.Now().Format(pkg.TimeFormat), op, image))
+	spinner.Start()
+	return &spinnerOperation{spinner: spinner, op: op, image: image}
+}
+
+type spinnerOperation struct {
+	spinner *yacspin.Spinner
+	op      string
+	image   string
+}
+
+func (o *spinnerOperation) Update(status pkg.DockerStatusOutput) {
+	o.spinner.Message(fmt.Sprintf("%s %s", status.Status, status.Progress))
+}
+
+func (o *spinnerOperation) Done(err error) {
+	if err != nil {
+		o.spinner.StopFailMessage(err.Error())
+		o.spinner.StopFail()
+		return
+	}
+	o.spinner.Message("")
+	o.spinner.Suffix(fmt.Sprintf("[%s] Done %s %s", time.Now().Format(pkg.TimeFormat), o.op, o.image))
+	o.spinner.Stop()
+}
@@ -0,0 +1,196 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	mutex "sync"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+const (
+	tuiRefresh   = 200 * time.Millisecond
+	tuiBarWidth  = 24
+	tuiMaxLayers = 6
+)
+
+// TUI redraws a block of lines at the bottom of the terminal with one row for every
+// operation in flight, across all registries, and a progress bar for each layer being
+// transferred. Finished operations are printed above the block and scroll away.
+type TUI struct {
+	mu       mutex.Mutex
+	out      io.Writer
+	rows     []*tuiRow
+	finished []string
+	// drawn is the number of lines written by the last frame
+	drawn int
+	once  mutex.Once
+}
+
+type tuiRow struct {
+	tui      *TUI
+	registry string
+	op       string
+	image    string
+	started  time.Time
+	status   string
+	layers   map[string]*tuiLayer
+	order    []string
+}
+
+type tuiLayer struct {
+	status  string
+	current int
+	total   int
+}
+
+// NewTUI builds a TUI display writing to w, or to stderr if w is nil.
+func NewTUI(w io.Writer) *TUI {
+	if w == nil {
+		w = os.Stderr
+	}
+	return &TUI{out: w}
+}
+
+func (t *TUI) Start(registry, op, image string) Operation {
+	t.once.Do(func() {
+		go func() {
+			for range time.Tick(tuiRefresh) {
+				t.mu.Lock()
+				t.render()
+				t.mu.Unlock()
+			}
+		}()
+	})
+
+	row := &tuiRow{
+		tui:      t,
+		registry: registry,
+		op:       op,
+		image:    image,
+		started:  time.Now(),
+		layers:   make(map[string]*tuiLayer),
+	}
+	t.mu.Lock()
+	t.rows = append(t.rows, row)
+	t.mu.Unlock()
+	return row
+}
+
+func (r *tuiRow) Update(status pkg.DockerStatusOutput) {
+	r.tui.mu.Lock()
+	defer r.tui.mu.Unlock()
+	if status.ID == "" {
+		r.status = status.Status
+		return
+	}
+	layer, ok := r.layers[status.ID]
+	if !ok {
+		layer = &tuiLayer{}
+		r.layers[status.ID] = layer
+		r.order = append(r.order, status.ID)
+	}
+	layer.status = status.Status
+	if status.ProgressDetail.Total > 0 {
+		layer.current = status.ProgressDetail.Current
+		layer.total = status.ProgressDetail.Total
+	}
+}
+
+func (r *tuiRow) Done(err error) {
+	t := r.tui
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, row := range t.rows {
+		if row == r {
+			t.rows = append(t.rows[:i], t.rows[i+1:]...)
+			break
+		}
+	}
+
+	took := time.Since(r.started).Round(time.Second)
+	if err != nil {
+		t.finished = append(t.finished, fmt.Sprintf("✗ [%s] %s %s failed after %s: %v", r.registry, r.op, r.image, took, err))
+	} else {
+		t.finished = append(t.finished, fmt.Sprintf("✓ [%s] %s %s (%s)", r.registry, r.op, r.image, took))
+	}
+	t.render()
+}
+
+// render must be called with t.mu held.
+func (t *TUI) render() {
+	var buf bytes.Buffer
+	if t.drawn > 0 {
+		// move to the start of the previous frame and clear it
+		fmt.Fprintf(&buf, "\x1b[%dA\x1b[J", t.drawn)
+	}
+	for _, line := range t.finished {
+		fmt.Fprintln(&buf, line)
+	}
+	t.finished = nil
+
+	lines := 0
+	for _, r := range t.rows {
+		for _, line := range r.lines() {
+			fmt.Fprintln(&buf, line)
+			lines++
+		}
+	}
+	t.drawn = lines
+	t.out.Write(buf.Bytes())
+}
+
+func (r *tuiRow) lines() []string {
+	var current, total int
+	for _, l := range r.layers {
+		current += l.current
+		total += l.total
+	}
+	header := fmt.Sprintf("[%s] %s %s", r.registry, r.op, r.image)
+	if total > 0 {
+		header += fmt.Sprintf(" %s %s/%s", bar(current, total), FormatBytes(current), FormatBytes(total))
+	} else if r.status != "" {
+		header += " " + r.status
+	}
+	lines := []string{header}
+
+	// only show layers which are still transferring, most recent first
+	var active []string
+	for i := len(r.order) - 1; i >= 0; i-- {
+		l := r.layers[r.order[i]]
+		if l.total == 0 || l.current < l.total {
+			active = append(active, r.order[i])
+		}
+	}
+	for i, id := range active {
+		if i == tuiMaxLayers {
+			lines = append(lines, fmt.Sprintf("    ... %d more layers", len(active)-tuiMaxLayers))
+			break
+		}
+		l := r.layers[id]
+		if l.total > 0 {
+			lines = append(lines, fmt.Sprintf("    %s %s %s %s/%s", id, l.status, bar(l.current, l.total), FormatBytes(l.current), FormatBytes(l.total)))
+		} else {
+			lines = append(lines, fmt.Sprintf("    %s %s", id, l.status))
+		}
+	}
+	return lines
+}
+
+func bar(current, total int) string {
+	filled := 0
+	if total > 0 {
+		filled = current * tuiBarWidth / total
+	}
+	if filled > tuiBarWidth {
+		filled = tuiBarWidth
+	}
+	if filled == tuiBarWidth {
+		return "[" + strings.Repeat("=", tuiBarWidth) + "]"
+	}
+	return "[" + strings.Repeat("=", filled) + ">" + strings.Repeat(" ", tuiBarWidth-filled-1) + "]"
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	mutex "sync"
+	"time"
+)
+
+// Event describes the progress of a single sync operation. Events are
+// published for every status line the docker daemon reports while pulling
+// or pushing an image, as well as when a Syncer moves between stages.
+type Event struct {
+	Time     time.Time
+	Registry string
+	// Job is the name of the synchronization job, which differs from Registry when several jobs target it
+	Job   string
+	Image string
+	// Stage is the operation being performed, e.g. Pulling, Pushing, or Retagging
+	Stage   string
+	LayerID string
+	Status  string
+	// Current and Total are the number of bytes transferred for LayerID
+	Current int
+	Total   int
+}
+
+// subscriberBuffer is the number of events which may be queued for a subscriber
+// before new events are dropped for it.
+const subscriberBuffer = 256
+
+type subscriber struct {
+	registry string
+	ch       chan Event
+}
+
+// Bus fans out published events to all subscribers. Publishing never blocks,
+// slow subscribers will miss events rather than stall a sync.
+type Bus struct {
+	mu          mutex.RWMutex
+	next        int
+	subscribers map[int]subscriber
+}
+
+// Default is the Bus used by Syncers and the API server.
+var Default = NewBus()
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[int]subscriber),
+	}
+}
+
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subscribers {
+		if s.registry != "" && s.registry != e.Registry && s.registry != e.Job {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of events for the given registry or job, or for all
+// registries if registry is empty. The returned function must be called to
+// unsubscribe, it closes the channel.
+func (b *Bus) Subscribe(registry string) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	ch := make(chan Event, subscriberBuffer)
+	b.subscribers[id] = subscriber{
+		registry: registry,
+		ch:       ch,
+	}
+
+	var once mutex.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+			close(ch)
+		})
+	}
+}
+
+// Publish publishes an event on the Default bus.
+func Publish(e Event) {
+	Default.Publish(e)
+}
@@ -0,0 +1,36 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+)
+
+func TestBusFiltersByRegistry(t *testing.T) {
+	bus := NewBus()
+	all, cancelAll := bus.Subscribe("")
+	defer cancelAll()
+	one, cancelOne := bus.Subscribe("registry-one.space")
+	defer cancelOne()
+
+	bus.Publish(Event{Registry: "registry-two.space", Image: "rancher/rancher:v2.7.0"})
+	bus.Publish(Event{Registry: "registry-one.space", Image: "rancher/shell:v0.1.19"})
+
+	assert.Equal(t, (<-all).Registry, "registry-two.space")
+	assert.Equal(t, (<-all).Registry, "registry-one.space")
+	assert.Equal(t, (<-one).Image, "rancher/shell:v0.1.19")
+	assert.Equal(t, len(one), 0)
+}
+
+func TestBusDropsEventsForSlowSubscribers(t *testing.T) {
+	bus := NewBus()
+	ch, cancel := bus.Subscribe("")
+	for i := 0; i < subscriberBuffer+10; i++ {
+		bus.Publish(Event{Current: i})
+	}
+	assert.Equal(t, len(ch), subscriberBuffer)
+
+	cancel()
+	// cancelling twice must not panic
+	cancel()
+}
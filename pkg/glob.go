@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MatchGlob reports if s matches the glob pattern. '*' matches any sequence of
+// characters except '/', '**' matches any sequence including '/', and '?' matches
+// a single character. Patterns are typically matched against image repositories.
+func MatchGlob(pattern, s string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	matched, err := regexp.MatchString(b.String(), s)
+	return err == nil && matched
+}
+
+// MatchAnyGlob reports if s matches any of the patterns.
+func MatchAnyGlob(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if MatchGlob(p, s) {
+			return true
+		}
+	}
+	return false
+}
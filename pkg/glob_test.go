@@ -0,0 +1,16 @@
+package pkg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	assert.Equal(t, MatchGlob("rancher/*", "rancher/shell"), true)
+	assert.Equal(t, MatchGlob("rancher/*", "rancher/mirrored/shell"), false)
+	assert.Equal(t, MatchGlob("rancher/**", "rancher/mirrored/shell"), true)
+	assert.Equal(t, MatchGlob("**/shell", "docker.io/rancher/shell"), true)
+	assert.Equal(t, MatchGlob("rancher/shell?", "rancher/shell2"), true)
+	assert.Equal(t, MatchGlob("rancher/shell.io", "rancher/shellxio"), false)
+	assert.Equal(t, MatchAnyGlob([]string{"library/*", "rancher/*"}, "rancher/rancher"), true)
+}
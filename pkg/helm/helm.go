@@ -0,0 +1,254 @@
+// Package helm renders Helm charts, or reads directories of Kubernetes manifests, to find and
+// rewrite the images they reference, and pushes charts to registries as OCI artifacts.
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// Binary is the helm executable charts are rendered and pushed with.
+var Binary = "helm"
+
+// release is the name charts are rendered as, it only shows up in the names of the rendered resources.
+const release = "picture-book"
+
+// rendered is the name the output of a rendered chart is held under.
+const rendered = "manifests.yaml"
+
+// imageLine matches the image field of a container, capturing the text before the image, the image, and its quotes.
+// Only blanks may separate the field from the image, an image field holding a map on the next lines is not an image.
+var imageLine = regexp.MustCompile(`(?m)^([ \t]*(?:-[ \t]+)?image:[ \t]*)(["']?)([^"'\s#]+)(["']?)`)
+
+// Render returns the manifests of conf, keyed by their path relative to the manifests directory. Charts are
+// rendered with helm template using the values files of conf, and are returned as a single manifests.yaml.
+func Render(ctx context.Context, conf pkg.HelmConfig) (map[string][]byte, error) {
+	if conf.Manifests != "" {
+		return readManifests(conf.Manifests)
+	}
+	args := []string{"template", release, conf.Chart}
+	for _, values := range conf.Values {
+		args = append(args, "--values", values)
+	}
+	out, _, err := run(ctx, nil, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not render %s: %w", conf.Chart, err)
+	}
+	return map[string][]byte{rendered: out}, nil
+}
+
+// readManifests reads every YAML file below dir.
+func readManifests(dir string) (map[string][]byte, error) {
+	docs := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		docs[rel] = b
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifests from %s: %w", dir, err)
+	}
+	return docs, nil
+}
+
+// Images lists the images referenced by the image fields of docs, each image once and sorted.
+// Values left to be templated, e.g. '{{ .Values.image }}', are not images and are skipped.
+func Images(docs map[string][]byte) []string {
+	found := make(map[string]bool)
+	for _, doc := range docs {
+		for _, m := range imageLine.FindAllSubmatch(doc, -1) {
+			if image := string(m[3]); !strings.Contains(image, "{{") {
+				found[image] = true
+			}
+		}
+	}
+	images := make([]string, 0, len(found))
+	for image := range found {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// Rewrite replaces the images of docs for which reTag returns a name, leaving the rest of each document untouched.
+func Rewrite(docs map[string][]byte, reTag func(image string) (string, bool)) map[string][]byte {
+	rewritten := make(map[string][]byte, len(docs))
+	for name, doc := range docs {
+		rewritten[name] = imageLine.ReplaceAllFunc(doc, func(line []byte) []byte {
+			m := imageLine.FindSubmatch(line)
+			if strings.Contains(string(m[3]), "{{") {
+				return line
+			}
+			target, ok := reTag(string(m[3]))
+			if !ok {
+				return line
+			}
+			return []byte(string(m[1]) + string(m[2]) + target + string(m[4]))
+		})
+	}
+	return rewritten
+}
+
+// Write writes docs below dir, keeping their relative paths.
+func Write(dir string, docs map[string][]byte) error {
+	for name, doc := range docs {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, doc, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChartName reads the name of chart, a chart directory or .tgz archive, from its Chart.yaml. Charts are pushed
+// to the repository of that name below the repository given to Push.
+func ChartName(chart string) (string, error) {
+	var metadata []byte
+	if !strings.HasSuffix(chart, ".tgz") {
+		b, err := os.ReadFile(filepath.Join(chart, "Chart.yaml"))
+		if err != nil {
+			return "", err
+		}
+		metadata = b
+	} else {
+		f, err := os.Open(chart)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s: %w", chart, err)
+		}
+		archive := tar.NewReader(gz)
+		for metadata == nil {
+			h, err := archive.Next()
+			if errors.Is(err, io.EOF) {
+				return "", fmt.Errorf("%s holds no Chart.yaml", chart)
+			}
+			if err != nil {
+				return "", fmt.Errorf("could not read %s: %w", chart, err)
+			}
+			// archives hold a single directory named after the chart
+			if dir, file := path.Split(h.Name); file == "Chart.yaml" && strings.Count(dir, "/") == 1 {
+				if metadata, err = io.ReadAll(archive); err != nil {
+					return "", fmt.Errorf("could not read %s: %w", chart, err)
+				}
+			}
+		}
+	}
+	var c struct {
+		Name string `yaml:"name"`
+	}
+	if err := yaml.Unmarshal(metadata, &c); err != nil || c.Name == "" {
+		return "", fmt.Errorf("%s has no valid Chart.yaml", chart)
+	}
+	return c.Name, nil
+}
+
+// Push pushes chart, a chart directory or .tgz archive, to oci://host/repository. Directories are packaged first.
+// auth is the username:password used to log in to host, if any. The reference of the pushed chart is returned.
+func Push(ctx context.Context, chart, host, repository, auth string) (string, error) {
+	if !strings.HasSuffix(chart, ".tgz") {
+		dir, err := os.MkdirTemp("", "picture-book-chart")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+		if _, _, err := run(ctx, nil, "package", chart, "--destination", dir); err != nil {
+			return "", fmt.Errorf("could not package %s: %w", chart, err)
+		}
+		packaged, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+		if err != nil || len(packaged) != 1 {
+			return "", fmt.Errorf("could not find the package of %s", chart)
+		}
+		chart = packaged[0]
+	}
+
+	var push []string
+	if auth != "" {
+		auths := strings.SplitN(auth, ":", 2)
+		if len(auths) != 2 {
+			return "", fmt.Errorf("pushAuthConfig for %s is improperly formatted, expected format is 'username:password'", host)
+		}
+		// the credentials are kept in a registry config of their own rather than in the one shared with the user's helm
+		dir, err := os.MkdirTemp("", "picture-book-helm")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+		config := []string{"--registry-config", filepath.Join(dir, "config.json")}
+		login := append([]string{"registry", "login", host, "--username", auths[0], "--password-stdin"}, config...)
+		if _, _, err := run(ctx, strings.NewReader(auths[1]), login...); err != nil {
+			return "", fmt.Errorf("could not log in to %s: %w", host, err)
+		}
+		push = config
+	}
+
+	target := "oci://" + host
+	if repository != "" {
+		target += "/" + repository
+	}
+	stdout, stderr, err := run(ctx, nil, append([]string{"push", chart, target}, push...)...)
+	if err != nil {
+		return "", fmt.Errorf("could not push %s to %s: %w", filepath.Base(chart), target, err)
+	}
+	// helm reports the reference the chart was pushed as, e.g. 'Pushed: my-registry.com/charts/nginx:1.0.0',
+	// on standard error or output depending on its version
+	for _, line := range strings.Split(string(stdout)+"\n"+string(stderr), "\n") {
+		if strings.HasPrefix(line, "Pushed:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Pushed:")), nil
+		}
+	}
+	return strings.TrimPrefix(target, "oci://"), nil
+}
+
+// run runs helm with args, returning its standard output and error. Errors include what helm wrote to standard error.
+func run(ctx context.Context, stdin *strings.Reader, args ...string) ([]byte, []byte, error) {
+	cmd := exec.CommandContext(ctx, Binary, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	pkg.Logger.WithField("command", Binary).Debugf("Running %s", cmd.String())
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, nil, err
+	}
+	return stdout.Bytes(), stderr.Bytes(), nil
+}
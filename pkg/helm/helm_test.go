@@ -0,0 +1,152 @@
+package helm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/magiconair/properties/assert"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	pkg.Logger = logrus.New()
+	pkg.Logger.SetOutput(io.Discard)
+}
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: init
+          image: "busybox:1.36" # waits for the database
+      containers:
+        - image: nginx:1.25
+          name: web
+        - name: sidecar
+          image: '{{ .Values.sidecar }}'
+`
+
+// fakeHelm installs a script in place of helm, which logs its arguments to the returned file
+// and prints output, for the duration of the test.
+func fakeHelm(t *testing.T, output string) string {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "helm")
+	content := "#!/bin/sh\necho \"$@\" >> " + calls + "\ncat <<'EOF'\n" + output + "EOF\n"
+	assert.Equal(t, os.WriteFile(script, []byte(content), 0755), nil)
+	old := Binary
+	Binary = script
+	t.Cleanup(func() { Binary = old })
+	return calls
+}
+
+func TestManifests(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, os.MkdirAll(filepath.Join(dir, "apps"), 0755), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(dir, "apps", "web.yaml"), []byte(deployment), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(dir, "db.yml"), []byte("containers:\n- image: postgres:16\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("image: ignored:v1\n"), 0644), nil)
+
+	docs, err := Render(context.Background(), pkg.HelmConfig{Manifests: dir})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(docs), 2)
+	assert.Equal(t, Images(docs), []string{"busybox:1.36", "nginx:1.25", "postgres:16"})
+
+	rewritten := Rewrite(docs, func(image string) (string, bool) {
+		return pkg.ReTag(image, "my-registry.space", "mirror"), image != "postgres:16"
+	})
+	web := string(rewritten[filepath.Join("apps", "web.yaml")])
+	assert.Equal(t, strings.Contains(web, `image: "my-registry.space/mirror/busybox:1.36" # waits for the database`), true)
+	assert.Equal(t, strings.Contains(web, "- image: my-registry.space/mirror/nginx:1.25\n"), true)
+	assert.Equal(t, strings.Contains(web, `image: '{{ .Values.sidecar }}'`), true)
+	assert.Equal(t, string(rewritten["db.yml"]), "containers:\n- image: postgres:16\n")
+
+	out := t.TempDir()
+	assert.Equal(t, Write(out, rewritten), nil)
+	b, err := os.ReadFile(filepath.Join(out, "apps", "web.yaml"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(b), web)
+}
+
+func TestNestedImage(t *testing.T) {
+	// values files and custom resources may describe images as maps, which aren't rewritten
+	doc := "image:\n  repository: rancher/shell\n  tag: v0.1.19\ncontainers:\n  -\n    image: nginx:1.25\n"
+	docs := map[string][]byte{"values.yaml": []byte(doc)}
+	assert.Equal(t, Images(docs), []string{"nginx:1.25"})
+	rewritten := Rewrite(docs, func(image string) (string, bool) {
+		return pkg.ReTag(image, "my-registry.space", "mirror"), true
+	})
+	assert.Equal(t, string(rewritten["values.yaml"]), strings.Replace(doc, "nginx:1.25", "my-registry.space/mirror/nginx:1.25", 1))
+}
+
+func TestRenderChart(t *testing.T) {
+	calls := fakeHelm(t, deployment)
+	docs, err := Render(context.Background(), pkg.HelmConfig{Chart: "charts/web-1.0.0.tgz", Values: []string{"prod.yaml", "eu.yaml"}})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, Images(docs), []string{"busybox:1.36", "nginx:1.25"})
+	b, _ := os.ReadFile(calls)
+	assert.Equal(t, string(b), "template picture-book charts/web-1.0.0.tgz --values prod.yaml --values eu.yaml\n")
+}
+
+func TestPush(t *testing.T) {
+	calls := fakeHelm(t, "Pushed: my-registry.space/mirror/web:1.0.0\nDigest: sha256:0123\n")
+	ref, err := Push(context.Background(), "charts/web-1.0.0.tgz", "my-registry.space", "mirror", "user:pass:word")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ref, "my-registry.space/mirror/web:1.0.0")
+	b, _ := os.ReadFile(calls)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(t, len(lines), 2)
+	// the password is passed on standard input rather than as an argument, and is stored in a temporary registry config
+	login := strings.Fields(lines[0])
+	assert.Equal(t, strings.Join(login[:6], " "), "registry login my-registry.space --username user --password-stdin")
+	assert.Equal(t, login[6], "--registry-config")
+	config := login[7]
+	assert.Equal(t, lines[1], "push charts/web-1.0.0.tgz oci://my-registry.space/mirror --registry-config "+config)
+	_, err = os.Stat(filepath.Dir(config))
+	assert.Equal(t, os.IsNotExist(err), true)
+}
+
+func TestChartName(t *testing.T) {
+	dir := t.TempDir()
+	metadata := []byte("apiVersion: v2\nname: web\nversion: 1.0.0\n")
+	assert.Equal(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), metadata, 0644), nil)
+	name, err := ChartName(dir)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, name, "web")
+
+	// packaged charts hold their files below a directory named after the chart, along with those of their dependencies
+	archive := filepath.Join(t.TempDir(), "web-1.0.0.tgz")
+	f, err := os.Create(archive)
+	assert.Equal(t, err, nil)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range []string{"web/charts/db/Chart.yaml", "web/Chart.yaml"} {
+		content := metadata
+		if file != "web/Chart.yaml" {
+			content = []byte("name: db\n")
+		}
+		assert.Equal(t, tw.WriteHeader(&tar.Header{Name: file, Mode: 0644, Size: int64(len(content))}), nil)
+		_, err = tw.Write(content)
+		assert.Equal(t, err, nil)
+	}
+	assert.Equal(t, tw.Close(), nil)
+	assert.Equal(t, gz.Close(), nil)
+	assert.Equal(t, f.Close(), nil)
+	name, err = ChartName(archive)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, name, "web")
+
+	_, err = ChartName(t.TempDir())
+	assert.Equal(t, err != nil, true)
+}
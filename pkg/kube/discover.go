@@ -0,0 +1,126 @@
+// Package kube discovers the images run by the workloads of a Kubernetes cluster.
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// NewClient creates a clientset for the cluster conf points to. Without a kubeconfig,
+// $KUBECONFIG, ~/.kube/config, and the in-cluster configuration are tried in that order.
+func NewClient(conf pkg.KubernetesConfig) (kubernetes.Interface, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = conf.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: conf.Context}
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not load kubeconfig: %w", err)
+	}
+	return kubernetes.NewForConfig(restConfig)
+}
+
+// Discover lists the container, init container, and ephemeral container images of the Pods, Deployments,
+// StatefulSets, DaemonSets, CronJobs, and Jobs in namespaces, or in every namespace when none are given.
+// Workloads are listed along with Pods so images of workloads scaled to zero are found as well.
+// The images are deduplicated and sorted.
+func Discover(ctx context.Context, client kubernetes.Interface, namespaces []string) ([]string, error) {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	found := make(map[string]bool)
+	for _, ns := range namespaces {
+		specs, err := podSpecs(ctx, client, ns)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range specs {
+			for _, image := range specImages(spec) {
+				if image != "" {
+					found[image] = true
+				}
+			}
+		}
+	}
+	images := make([]string, 0, len(found))
+	for image := range found {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// podSpecs lists the pod specs of every workload in namespace.
+func podSpecs(ctx context.Context, client kubernetes.Interface, namespace string) ([]corev1.PodSpec, error) {
+	var specs []corev1.PodSpec
+	opts := metav1.ListOptions{}
+	where := namespace
+	if where == metav1.NamespaceAll {
+		where = "all namespaces"
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not list pods in %s: %w", where, err)
+	}
+	for _, p := range pods.Items {
+		specs = append(specs, p.Spec)
+	}
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not list deployments in %s: %w", where, err)
+	}
+	for _, d := range deployments.Items {
+		specs = append(specs, d.Spec.Template.Spec)
+	}
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not list statefulsets in %s: %w", where, err)
+	}
+	for _, s := range statefulSets.Items {
+		specs = append(specs, s.Spec.Template.Spec)
+	}
+	daemonSets, err := client.AppsV1().DaemonSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not list daemonsets in %s: %w", where, err)
+	}
+	for _, d := range daemonSets.Items {
+		specs = append(specs, d.Spec.Template.Spec)
+	}
+	cronJobs, err := client.BatchV1().CronJobs(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not list cronjobs in %s: %w", where, err)
+	}
+	for _, c := range cronJobs.Items {
+		specs = append(specs, c.Spec.JobTemplate.Spec.Template.Spec)
+	}
+	jobs, err := client.BatchV1().Jobs(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not list jobs in %s: %w", where, err)
+	}
+	for _, j := range jobs.Items {
+		specs = append(specs, j.Spec.Template.Spec)
+	}
+	return specs, nil
+}
+
+// specImages returns the images of every container of spec.
+func specImages(spec corev1.PodSpec) []string {
+	var images []string
+	for _, c := range spec.InitContainers {
+		images = append(images, c.Image)
+	}
+	for _, c := range spec.Containers {
+		images = append(images, c.Image)
+	}
+	for _, c := range spec.EphemeralContainers {
+		images = append(images, c.Image)
+	}
+	return images
+}
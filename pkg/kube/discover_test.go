@@ -0,0 +1,58 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func podSpec(images ...string) corev1.PodSpec {
+	spec := corev1.PodSpec{}
+	for _, image := range images {
+		spec.Containers = append(spec.Containers, corev1.Container{Image: image})
+	}
+	return spec
+}
+
+func meta(namespace, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Namespace: namespace, Name: name}
+}
+
+func TestDiscover(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: meta("apps", "web-7d9f"), Spec: podSpec("nginx:1.25")}
+	pod.Spec.InitContainers = []corev1.Container{{Image: "busybox:1.36"}}
+	pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Image: "nicolaka/netshoot:v0.11"}}}
+
+	client := fake.NewSimpleClientset(
+		pod,
+		&appsv1.Deployment{ObjectMeta: meta("apps", "web"), Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: podSpec("nginx:1.25")}}},
+		&appsv1.StatefulSet{ObjectMeta: meta("apps", "db"), Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: podSpec("postgres:16")}}},
+		&appsv1.DaemonSet{ObjectMeta: meta("monitoring", "agent"), Spec: appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{Spec: podSpec("prom/node-exporter:v1.7.0")}}},
+		&batchv1.CronJob{ObjectMeta: meta("apps", "backup"), Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: podSpec("restic/restic:0.16.2")}}}}},
+		&batchv1.Job{ObjectMeta: meta("apps", "migrate"), Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: podSpec("migrate/migrate:v4.17.0")}}},
+		&appsv1.Deployment{ObjectMeta: meta("sandbox", "scratch"), Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: podSpec("alpine:3.19")}}},
+	)
+
+	images, err := Discover(context.Background(), client, []string{"apps", "monitoring"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, images, []string{
+		"busybox:1.36",
+		"migrate/migrate:v4.17.0",
+		"nginx:1.25",
+		"nicolaka/netshoot:v0.11",
+		"postgres:16",
+		"prom/node-exporter:v1.7.0",
+		"restic/restic:0.16.2",
+	})
+
+	// without namespaces every namespace is searched
+	images, err = Discover(context.Background(), client, nil)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(images), 8)
+}
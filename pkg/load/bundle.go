@@ -0,0 +1,284 @@
+package load
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/bundle"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/config"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/sync"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/urfave/cli/v2"
+)
+
+// Export runs the syncer script of a registry and writes the images it lists into a bundle,
+// which can be carried to an environment without access to the source registries.
+func Export(cliCtx *cli.Context) error {
+	hostname := cliCtx.String("registry")
+	out := cliCtx.String("out")
+	reg, err := config.ConfiguredRegistries.GetRegistry(hostname)
+	if err != nil {
+		return fmt.Errorf("could not find provided registry %s: %w", hostname, err)
+	}
+	disp, err := display.New(viper.GetString("display"))
+	if err != nil {
+		return err
+	}
+
+	sources, err := pkg.NewSources(reg)
+	if err != nil {
+		return fmt.Errorf("could not set up registry %s: %w", reg.Hostname, err)
+	}
+	images, err := pkg.ListImages(cliCtx.Context, sources)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	switch format := cliCtx.String("format"); format {
+	case "", bundle.FormatOCI:
+		failed, err = exportOCI(cliCtx.Context, reg, images, out, cliCtx.String("since"), disp)
+	case bundle.FormatDockerArchive:
+		if cliCtx.String("since") != "" {
+			return fmt.Errorf("delta bundles can only be created in the %s format", bundle.FormatOCI)
+		}
+		failed, err = exportDockerArchive(cliCtx.Context, reg, images, out, disp)
+	default:
+		return fmt.Errorf("unknown bundle format %s, expected %s or %s", format, bundle.FormatOCI, bundle.FormatDockerArchive)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images could not be exported", failed, len(images))
+	}
+	pkg.Logger.Infof("Exported %d images to %s", len(images), out)
+	return nil
+}
+
+// exportOCI copies images from their source registries into an OCI layout, without the docker daemon.
+// When since is set, the blobs listed by that bundle or inventory are left out.
+func exportOCI(ctx context.Context, reg pkg.Registry, images []string, out, since string, disp display.Display) (int, error) {
+	var base bundle.Contents
+	if since != "" {
+		var err error
+		if base, err = bundle.ReadContents(since); err != nil {
+			return 0, fmt.Errorf("could not read the base of the delta bundle: %w", err)
+		}
+	}
+	w, err := bundle.Create(out)
+	if err != nil {
+		return 0, err
+	}
+	w.Contents.Registry = reg.Hostname
+	if since != "" {
+		w.Exclude(base, since)
+	}
+
+	failed := 0
+	clients := make(map[string]*registry.Client)
+	for _, image := range images {
+		op := disp.Start(reg.Hostname, "Exporting", image)
+		ref, err := registry.ParseReference(image)
+		if err == nil {
+			src, ok := clients[ref.Registry]
+			if !ok {
+				src = registry.NewClient(ref.Registry, reg.PullAuthConfig)
+				clients[ref.Registry] = src
+			}
+			_, err = w.Add(ctx, src, image)
+		}
+		op.Done(err)
+		if err != nil {
+			failed++
+			exportLogger(reg.Hostname, image).Errorf("Could not export %s: %v", image, err)
+		}
+	}
+	if since != "" {
+		pkg.Logger.WithField("registry", reg.Hostname).Infof("Left %d blobs provided by %s out of the bundle", w.Omitted(), since)
+	}
+	return failed, w.Close()
+}
+
+// exportDockerArchive pulls images through the docker daemon and saves them with docker save.
+func exportDockerArchive(ctx context.Context, reg pkg.Registry, images []string, out string, disp display.Display) (int, error) {
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return 0, fmt.Errorf("could not create docker client: %w", err)
+	}
+
+	failed := 0
+	contents := bundle.Contents{Registry: reg.Hostname}
+	var saved []string
+	// clients are shared by the images of a registry, so tokens are reused
+	clients := make(map[string]*registry.Client)
+	registryClient := func(host string) *registry.Client {
+		if _, ok := clients[host]; !ok {
+			clients[host] = sync.RegistryClients(reg.PullAuthConfig)(host)
+		}
+		return clients[host]
+	}
+	for _, image := range images {
+		err := sync.PullWithDisplay(ctx, dockerClient, registryClient, image, reg.Hostname, reg.PullAuthConfig, disp)
+		if err != nil {
+			failed++
+			exportLogger(reg.Hostname, image).Errorf("Could not pull %s: %v", image, err)
+			continue
+		}
+		// images pulled by digest have no tag in the archive, so they are retagged by ID on import
+		inspect, _, err := dockerClient.ImageInspectWithRaw(ctx, image)
+		if err != nil {
+			failed++
+			exportLogger(reg.Hostname, image).Errorf("Could not inspect %s: %v", image, err)
+			continue
+		}
+		contents.Images = append(contents.Images, bundle.Image{Image: image, ID: inspect.ID})
+		saved = append(saved, image)
+	}
+	if len(saved) == 0 {
+		return failed, errors.New("no images could be exported")
+	}
+
+	r, err := dockerClient.ImageSave(ctx, saved)
+	if err != nil {
+		return failed, fmt.Errorf("could not save images: %w", err)
+	}
+	defer r.Close()
+	return failed, bundle.WriteDockerArchive(out, r, contents)
+}
+
+func exportLogger(hostname, image string) *logrus.Entry {
+	return pkg.ErrLogger.WithFields(logrus.Fields{
+		"registry": hostname,
+		"image":    image,
+		"stage":    "exporting",
+	})
+}
+
+// Inventory lists the blobs held by a registry into a file, which export can use as the
+// base of a delta bundle when the registry can't be reached from where bundles are exported.
+func Inventory(cliCtx *cli.Context) error {
+	hostname := cliCtx.String("registry")
+	reg, err := config.ConfiguredRegistries.GetRegistry(hostname)
+	if err != nil {
+		return fmt.Errorf("could not find provided registry %s: %w", hostname, err)
+	}
+	inventory, err := bundle.Inventory(cliCtx.Context, registry.NewClient(reg.Hostname, reg.PushAuthConfig))
+	if err != nil {
+		return err
+	}
+	if err := bundle.WriteContents(cliCtx.String("out"), inventory); err != nil {
+		return err
+	}
+	pkg.Logger.WithField("registry", hostname).Infof("Wrote the %d blobs held by %s to %s", len(inventory.Blobs), hostname, cliCtx.String("out"))
+	return nil
+}
+
+// Import pushes the images of a bundle into a registry, retagging them the same
+// way synchronization does.
+func Import(cliCtx *cli.Context) error {
+	hostname := cliCtx.String("registry")
+	reg, err := config.ConfiguredRegistries.GetRegistry(hostname)
+	if err != nil {
+		return fmt.Errorf("could not find provided registry %s: %w", hostname, err)
+	}
+	b, err := bundle.Open(cliCtx.String("bundle"))
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	pkg.Logger.WithField("registry", hostname).Infof("Importing %d images from %s bundle created %s",
+		len(b.Contents.Images), b.Contents.Format, b.Contents.Created.Format(pkg.TimeFormat))
+
+	var results []bundle.ImportResult
+	if b.Contents.Format == bundle.FormatDockerArchive {
+		results, err = importDockerArchive(cliCtx.Context, reg, b)
+	} else {
+		results, err = b.Import(cliCtx.Context, registry.NewClient(reg.Hostname, reg.PushAuthConfig), reg.Repository)
+	}
+
+	failed := 0
+	for _, result := range results {
+		fields := logrus.Fields{"registry": hostname, "image": result.Image, "target": result.Target, "stage": "importing"}
+		if result.Err != nil {
+			failed++
+			pkg.ErrLogger.WithFields(fields).Errorf("Could not import %s: %v", result.Image, result.Err)
+			continue
+		}
+		pkg.Logger.WithFields(fields).Infof("Pushed %s", result.Target)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images could not be imported", failed, len(results))
+	}
+	return nil
+}
+
+// importDockerArchive loads the archive into the docker daemon, then retags and pushes each image.
+func importDockerArchive(ctx context.Context, reg pkg.Registry, b *bundle.Reader) ([]bundle.ImportResult, error) {
+	disp, err := display.New(viper.GetString("display"))
+	if err != nil {
+		return nil, err
+	}
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("could not create docker client: %w", err)
+	}
+
+	archive, err := b.Archive()
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	op := disp.Start(reg.Hostname, "Loading", fmt.Sprintf("%d images", len(b.Contents.Images)))
+	resp, err := dockerClient.ImageLoad(ctx, archive, true)
+	if err == nil {
+		err = loadStatus(resp.Body)
+		resp.Body.Close()
+	}
+	op.Done(err)
+	if err != nil {
+		return nil, fmt.Errorf("could not load bundle: %w", err)
+	}
+
+	var results []bundle.ImportResult
+	for _, image := range b.Contents.Images {
+		result := bundle.ImportResult{Image: image.Image, Target: pkg.ReTag(image.Image, reg.Hostname, reg.Repository)}
+		source := image.ID
+		if source == "" {
+			source = image.Image
+		}
+		_, result.Err = sync.Retag(ctx, dockerClient, source, result.Target)
+		if result.Err == nil {
+			result.Err = sync.PushWithDisplay(ctx, dockerClient, result.Target, reg.Hostname, reg.PushAuthConfig, disp)
+		}
+		results = append(results, result)
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+	}
+	return results, nil
+}
+
+// loadStatus reads the output of docker load, returning the error it reports, if any.
+func loadStatus(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var status pkg.DockerStatusOutput
+		if err := json.Unmarshal(scanner.Bytes(), &status); err == nil && status.Error != "" {
+			return errors.New(status.Error)
+		}
+	}
+	return scanner.Err()
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg/config"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg/sync"
+	"github.com/spf13/viper"
 	"github.com/urfave/cli/v2"
 )
 
@@ -26,29 +28,43 @@ func Load(cliCtx *cli.Context) error {
 func loadSingle(hostname string) error {
 	registry, err := config.ConfiguredRegistries.GetRegistry(hostname)
 	if err != nil {
-		return fmt.Errorf("could not find provided registry %s", hostname)
+		return fmt.Errorf("could not find provided registry %s: %w", hostname, err)
+	}
+
+	disp, err := display.New(viper.GetString("display"))
+	if err != nil {
+		return err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	syncer, _, err := sync.BuildRegistrySyncer(ctx, cancel, registry)
+	syncer, _, err := sync.BuildRegistrySyncer(ctx, cancel, registry, disp)
 	if err != nil {
 		return err
 	}
 	syncer.Process()
+	// the notifications of the run are sent in the background
+	config.Notifier.Wait()
 
 	pkg.Logger.Infof("Done!")
 	return nil
 }
 
 func loadAll() error {
+	disp, err := display.New(viper.GetString("display"))
+	if err != nil {
+		return err
+	}
+
 	for _, registry := range config.ConfiguredRegistries {
 		ctx, cancel := context.WithCancel(context.Background())
-		syncer, _, err := sync.BuildRegistrySyncer(ctx, cancel, registry)
+		syncer, _, err := sync.BuildRegistrySyncer(ctx, cancel, registry, disp)
 		if err != nil {
 			return err
 		}
 		syncer.Process()
 	}
+	// the notifications of the runs are sent in the background
+	config.Notifier.Wait()
 	pkg.Logger.Infof("Done!")
 	return nil
 }
@@ -0,0 +1,217 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	mutex "sync"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+const (
+	EventRun     = "run"
+	EventPaused  = "paused"
+	EventResumed = "resumed"
+)
+
+const (
+	// OnAlways sends every notification, including pause and resume events
+	OnAlways = "always"
+	// OnFailure only sends notifications for runs which had a failure
+	OnFailure = "failure"
+	// OnPushed only sends notifications for runs which pushed at least one image
+	OnPushed = "pushed"
+)
+
+// Notification is sent to each configured Sink. Webhook sinks receive it as JSON.
+type Notification struct {
+	Event    string
+	Registry string
+	// Job is the name of the synchronization job, which differs from Registry when several jobs target it
+	Job  string
+	Time time.Time
+	// Report is only set for run events
+	Report *pkg.RunReport `json:",omitempty"`
+}
+
+// name is the job the notification is about, or its registry when no job name is set.
+func (n Notification) name() string {
+	if n.Job != "" {
+		return n.Job
+	}
+	return n.Registry
+}
+
+// Summary is a short human readable description of the notification.
+func (n Notification) Summary() string {
+	switch n.Event {
+	case EventPaused:
+		return fmt.Sprintf("picture-book: synchronization for %s has been paused", n.name())
+	case EventResumed:
+		return fmt.Sprintf("picture-book: synchronization for %s has been resumed", n.name())
+	}
+
+	r := n.Report
+	if r == nil {
+		return fmt.Sprintf("picture-book: %s event for %s", n.Event, n.name())
+	}
+	state := "succeeded"
+	if r.Failed() {
+		state = "failed"
+	} else if r.Canceled {
+		state = "was canceled"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "picture-book: synchronization for %s %s after %s. %d pushed, %d already present, %d failed, %d rejected.",
+		n.name(), state, r.Finished.Sub(r.Started).Round(time.Second), r.Count(pkg.ImagePushed), r.Count(pkg.ImageSkipped)+r.Count(pkg.ImageUnchanged), r.Count(pkg.ImageFailed), r.Count(pkg.ImageRejected))
+	if pruned := r.Count(pkg.ImagePruned); pruned > 0 {
+		fmt.Fprintf(&b, " %d pruned.", pruned)
+	}
+	if r.Error != "" {
+		fmt.Fprintf(&b, "\n%s", r.Error)
+	}
+	for _, i := range r.Images {
+		if i.Status == pkg.ImageFailed || i.Status == pkg.ImageRejected {
+			name := i.Image
+			if name == "" {
+				// images pruned from the registry may not have been listed by this picture-book
+				name = i.Target
+			}
+			fmt.Fprintf(&b, "\n- %s (%s): %s", name, i.Status, i.Error)
+		}
+	}
+	return b.String()
+}
+
+// Sink delivers a notification somewhere.
+type Sink interface {
+	Send(n Notification) error
+}
+
+// SinkConfig is a single entry of the notifications section of config.yaml
+type SinkConfig struct {
+	// Type is one of webhook, slack, or smtp
+	Type string `yaml:"type"`
+	// On is one of always, failure, or pushed. Defaults to always.
+	On string `yaml:"on"`
+	// Registries limits the sink to the given registry hostnames or job names, all registries are included when empty.
+	Registries []string `yaml:"registries"`
+	// URL is the endpoint for webhook and slack sinks
+	URL string `yaml:"url"`
+	// Headers are added to webhook requests, e.g. for authentication
+	Headers map[string]string `yaml:"headers"`
+	SMTP    SMTPConfig        `yaml:"smtp"`
+}
+
+type filteredSink struct {
+	Sink
+	on         string
+	registries []string
+}
+
+func (f filteredSink) wants(n Notification) bool {
+	if len(f.registries) > 0 {
+		found := false
+		for _, r := range f.registries {
+			if r == n.Registry || r == n.Job {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch f.on {
+	case OnFailure:
+		return n.Report != nil && n.Report.Failed()
+	case OnPushed:
+		return n.Report != nil && n.Report.Count(pkg.ImagePushed) > 0
+	default:
+		return true
+	}
+}
+
+// Notifier sends notifications to every configured sink whose filter matches.
+// A nil Notifier discards all notifications.
+type Notifier struct {
+	sinks []filteredSink
+	// pending tracks the notifications sent by NotifyAsync
+	pending mutex.WaitGroup
+}
+
+func New(configs []SinkConfig) (*Notifier, error) {
+	n := &Notifier{}
+	for i, c := range configs {
+		var sink Sink
+		switch c.Type {
+		case "webhook":
+			sink = &Webhook{URL: c.URL, Headers: c.Headers}
+		case "slack":
+			sink = &Slack{URL: c.URL}
+		case "smtp":
+			sink = &SMTP{Config: c.SMTP}
+		default:
+			return nil, fmt.Errorf("notification %d has unknown type %q, expected webhook, slack, or smtp", i, c.Type)
+		}
+		if (c.Type == "webhook" || c.Type == "slack") && c.URL == "" {
+			return nil, fmt.Errorf("notification %d of type %s requires a url", i, c.Type)
+		}
+
+		switch c.On {
+		case "", OnAlways, OnFailure, OnPushed:
+		default:
+			return nil, fmt.Errorf("notification %d has unknown filter %q, expected always, failure, or pushed", i, c.On)
+		}
+		n.sinks = append(n.sinks, filteredSink{Sink: sink, on: c.On, registries: c.Registries})
+	}
+	return n, nil
+}
+
+// Notify sends n to each matching sink in parallel, and waits for them to finish.
+// Failures are logged rather than returned since they should never interrupt a sync.
+func (no *Notifier) Notify(n Notification) {
+	if no == nil {
+		return
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+
+	var wg mutex.WaitGroup
+	for _, s := range no.sinks {
+		if !s.wants(n) {
+			continue
+		}
+		wg.Add(1)
+		go func(s Sink) {
+			defer wg.Done()
+			if err := s.Send(n); err != nil {
+				pkg.ErrLogger.WithField("registry", n.Registry).Errorf("could not send %s notification: %v", n.Event, err)
+			}
+		}(s.Sink)
+	}
+	wg.Wait()
+}
+
+// NotifyAsync sends n like Notify, without waiting for the sinks.
+func (no *Notifier) NotifyAsync(n Notification) {
+	if no == nil {
+		return
+	}
+	no.pending.Add(1)
+	go func() {
+		defer no.pending.Done()
+		no.Notify(n)
+	}()
+}
+
+// Wait blocks until every notification sent through NotifyAsync was delivered, it must be called before exiting.
+func (no *Notifier) Wait() {
+	if no == nil {
+		return
+	}
+	no.pending.Wait()
+}
@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestFilters(t *testing.T) {
+	failed := pkg.NewRunReport("my-registry.space")
+	failed.Add("rancher/shell:v0.1.19", "my-registry.space/rancher/shell:v0.1.19", pkg.ImageFailed, errors.New("denied"))
+	pushed := pkg.NewRunReport("my-registry.space")
+	pushed.Add("rancher/shell:v0.1.19", "my-registry.space/rancher/shell:v0.1.19", pkg.ImagePushed, nil)
+	paused := Notification{Event: EventPaused, Registry: "my-registry.space"}
+
+	onFailure := filteredSink{on: OnFailure}
+	assert.Equal(t, onFailure.wants(Notification{Event: EventRun, Registry: "my-registry.space", Report: failed}), true)
+	assert.Equal(t, onFailure.wants(Notification{Event: EventRun, Registry: "my-registry.space", Report: pushed}), false)
+	assert.Equal(t, onFailure.wants(paused), false)
+
+	onPushed := filteredSink{on: OnPushed}
+	assert.Equal(t, onPushed.wants(Notification{Event: EventRun, Registry: "my-registry.space", Report: pushed}), true)
+	assert.Equal(t, onPushed.wants(Notification{Event: EventRun, Registry: "my-registry.space", Report: failed}), false)
+
+	always := filteredSink{on: OnAlways, registries: []string{"other-registry.space"}}
+	assert.Equal(t, always.wants(paused), false)
+	assert.Equal(t, always.wants(Notification{Event: EventPaused, Registry: "other-registry.space"}), true)
+
+	apps := filteredSink{on: OnAlways, registries: []string{"apps"}}
+	assert.Equal(t, apps.wants(Notification{Event: EventPaused, Registry: "my-registry.space", Job: "rancher"}), false)
+	assert.Equal(t, apps.wants(Notification{Event: EventPaused, Registry: "my-registry.space", Job: "apps"}), true)
+	assert.Equal(t, Notification{Event: EventPaused, Registry: "my-registry.space", Job: "apps"}.Summary(), "picture-book: synchronization for apps has been paused")
+}
+
+func TestWebhookReceivesReport(t *testing.T) {
+	var got Notification
+	var token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Token")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	n, err := New([]SinkConfig{{Type: "webhook", URL: srv.URL, On: OnAlways, Headers: map[string]string{"X-Token": "secret"}}})
+	assert.Equal(t, err, nil)
+
+	report := pkg.NewRunReport("my-registry.space")
+	report.Add("rancher/shell:v0.1.19", "my-registry.space/rancher/shell:v0.1.19", pkg.ImagePushed, nil)
+	n.Notify(Notification{Event: EventRun, Registry: "my-registry.space", Report: report})
+
+	assert.Equal(t, token, "secret")
+	assert.Equal(t, got.Event, EventRun)
+	assert.Equal(t, got.Report.Images[0].Status, pkg.ImagePushed)
+}
+
+func TestNotifyAsync(t *testing.T) {
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		var got Notification
+		json.NewDecoder(r.Body).Decode(&got)
+		received <- got.Event
+	}))
+	defer srv.Close()
+
+	n, err := New([]SinkConfig{{Type: "webhook", URL: srv.URL}})
+	assert.Equal(t, err, nil)
+	n.NotifyAsync(Notification{Event: EventPaused, Registry: "my-registry.space"})
+	// Wait returns once the sink responded
+	n.Wait()
+	select {
+	case event := <-received:
+		assert.Equal(t, event, EventPaused)
+	default:
+		t.Fatal("the notification was not delivered")
+	}
+
+	var none *Notifier
+	none.NotifyAsync(Notification{Event: EventPaused})
+	none.Wait()
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := New([]SinkConfig{{Type: "pager"}})
+	assert.Equal(t, err != nil, true)
+	_, err = New([]SinkConfig{{Type: "slack", On: "sometimes", URL: "http://localhost"}})
+	assert.Equal(t, err != nil, true)
+}
+
+func TestSMTPTimeout(t *testing.T) {
+	// the server accepts connections, but never greets the client
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	defer func(timeout time.Duration) { smtpTimeout = timeout }(smtpTimeout)
+	smtpTimeout = 100 * time.Millisecond
+	addr := l.Addr().(*net.TCPAddr)
+	s := &SMTP{Config: SMTPConfig{Host: addr.IP.String(), Port: addr.Port, From: "picture-book@example.com", To: []string{"ops@example.com"}}}
+	start := time.Now()
+	err = s.Send(Notification{Event: EventPaused, Registry: "my-registry.com"})
+	assert.Equal(t, err != nil, true)
+	assert.Equal(t, time.Since(start) < 5*time.Second, true)
+}
@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// smtpTimeout bounds connecting to, and the whole exchange with, an SMTP server.
+var smtpTimeout = 10 * time.Second
+
+func postJSON(url string, headers map[string]string, body interface{}) error {
+	j, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(j))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	r, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(r.Body, 512))
+		return fmt.Errorf("%s responded with %s: %s", url, r.Status, msg)
+	}
+	return nil
+}
+
+// Webhook posts the notification, including the full run report, as JSON.
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+}
+
+func (w *Webhook) Send(n Notification) error {
+	return postJSON(w.URL, w.Headers, n)
+}
+
+// Slack posts a summary of the notification to a Slack compatible incoming webhook.
+type Slack struct {
+	URL string
+}
+
+func (s *Slack) Send(n Notification) error {
+	return postJSON(s.URL, nil, map[string]string{"text": n.Summary()})
+}
+
+type SMTPConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// SMTP emails a summary of the notification.
+type SMTP struct {
+	Config SMTPConfig
+}
+
+func (s *SMTP) Send(n Notification) error {
+	c := s.Config
+	if c.Host == "" || c.From == "" || len(c.To) == 0 {
+		return fmt.Errorf("smtp notifications require a host, from, and to address")
+	}
+	port := c.Port
+	if port == 0 {
+		port = 25
+	}
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+
+	summary := n.Summary()
+	subject := strings.SplitN(summary, "\n", 2)[0]
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(summary, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	return sendMail(fmt.Sprintf("%s:%d", c.Host, port), c.Host, auth, c.From, c.To, msg.Bytes())
+}
+
+// sendMail sends msg like smtp.SendMail, giving up once smtpTimeout elapsed so a stalled server can't hang the caller.
+func sendMail(addr, host string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("the smtp server doesn't support authentication")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,235 @@
+// Package policy evaluates the declarative allow and deny rules of config.yaml against images.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/docker/go-units"
+)
+
+// Result lists the rules an image violates.
+type Result struct {
+	Violations []string
+}
+
+func (r Result) Passed() bool {
+	return len(r.Violations) == 0
+}
+
+func (r Result) Summary() string {
+	if r.Passed() {
+		return "image complies with policy"
+	}
+	return "policy violated: " + strings.Join(r.Violations, "; ")
+}
+
+// Policy evaluates a PolicyConfig. Rules about the image name are evaluated
+// without contacting any registry, while size, platform, and label rules read the
+// manifest and configuration of the image from its source registry.
+type Policy struct {
+	conf    pkg.PolicyConfig
+	maxSize int64
+	block   bool
+	// Client returns the registry client used to inspect images hosted on host
+	Client func(host string) *registry.Client
+}
+
+// New builds a Policy, auth is used to inspect images on their source registry. A nil
+// Policy is returned when conf is nil.
+func New(conf *pkg.PolicyConfig, auth string) (*Policy, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	p := &Policy{
+		conf: *conf,
+		Client: func(host string) *registry.Client {
+			return registry.NewClient(host, auth)
+		},
+	}
+	if conf.MaxSize != "" {
+		size, err := pkg.ParseSize(conf.MaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy.maxSize: %w", err)
+		}
+		p.maxSize = size
+	}
+	switch conf.OnFailure {
+	case "", "skip":
+	case "block":
+		p.block = true
+	default:
+		return nil, fmt.Errorf("invalid policy.onFailure %q, expected skip or block", conf.OnFailure)
+	}
+	return p, nil
+}
+
+// Blocks reports if a policy violation should stop the synchronization entirely.
+func (p *Policy) Blocks() bool {
+	return p.block
+}
+
+// Inspects reports if evaluating the policy requires reading the image from its registry.
+func (p *Policy) Inspects() bool {
+	return p.maxSize > 0 || len(p.conf.Platforms) > 0 || len(p.conf.Labels) > 0
+}
+
+// Evaluate checks image against every rule. When offline is set, rules which
+// require reading the image from its registry are not evaluated. An error is returned
+// if the image could not be inspected.
+func (p *Policy) Evaluate(ctx context.Context, image string, offline bool) (Result, error) {
+	var result Result
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return result, err
+	}
+
+	if len(p.conf.AllowedRegistries) > 0 && !pkg.MatchAnyGlob(p.conf.AllowedRegistries, ref.Registry) {
+		result.Violations = append(result.Violations, fmt.Sprintf("registry %s is not allowed", ref.Registry))
+	}
+	for _, pattern := range p.conf.DeniedRepositories {
+		if pkg.MatchGlob(pattern, ref.Repository) || pkg.MatchGlob(pattern, ref.Name()) {
+			result.Violations = append(result.Violations, fmt.Sprintf("repository %s is denied by %s", ref.Name(), pattern))
+			break
+		}
+	}
+	if p.conf.RequireDigest && ref.Digest == "" {
+		result.Violations = append(result.Violations, "image is not pinned by digest")
+	}
+
+	if offline || !p.Inspects() {
+		return result, nil
+	}
+	info, err := p.inspect(ctx, ref)
+	if err != nil {
+		return result, fmt.Errorf("could not inspect %s: %w", image, err)
+	}
+
+	if p.maxSize > 0 && info.size > p.maxSize {
+		result.Violations = append(result.Violations, fmt.Sprintf("image size %s exceeds %s", units.HumanSize(float64(info.size)), p.conf.MaxSize))
+	}
+	if len(p.conf.Platforms) > 0 && p.matchPlatform(info.platforms) == "" {
+		result.Violations = append(result.Violations, fmt.Sprintf("image is only available for %s", strings.Join(info.platforms, ", ")))
+	}
+	for _, label := range p.conf.Labels {
+		parts := strings.SplitN(label, "=", 2)
+		name := parts[0]
+		value, ok := info.labels[name]
+		switch {
+		case !ok:
+			result.Violations = append(result.Violations, fmt.Sprintf("label %s is missing", name))
+		case len(parts) == 2 && !pkg.MatchGlob(parts[1], value):
+			result.Violations = append(result.Violations, fmt.Sprintf("label %s=%s does not match %s", name, value, parts[1]))
+		}
+	}
+	return result, nil
+}
+
+// matchPlatform returns the first of platforms which is allowed.
+func (p *Policy) matchPlatform(platforms []string) string {
+	for _, platform := range platforms {
+		if pkg.MatchAnyGlob(p.conf.Platforms, platform) {
+			return platform
+		}
+	}
+	return ""
+}
+
+type imageInfo struct {
+	size      int64
+	platforms []string
+	labels    map[string]string
+}
+
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+func platformString(os, arch, variant string) string {
+	s := os + "/" + arch
+	if variant != "" {
+		s += "/" + variant
+	}
+	return s
+}
+
+// inspect reads the manifest and configuration of ref. For multi-platform images, the
+// size and labels are those of the platform which would be pulled: the first allowed
+// platform, or the platform picture-book runs on.
+func (p *Policy) inspect(ctx context.Context, ref registry.Reference) (imageInfo, error) {
+	var info imageInfo
+	client := p.Client(ref.Registry)
+	b, desc, err := client.GetManifest(ctx, ref.Repository, ref.Reference())
+	if err != nil {
+		return info, err
+	}
+	manifest, err := registry.ParseManifest(b)
+	if err != nil {
+		return info, err
+	}
+
+	if registry.IsIndex(desc.MediaType) {
+		children := make(map[string]registry.Descriptor)
+		for _, m := range manifest.Manifests {
+			// attestation manifests are listed with an unknown platform
+			if m.Platform == nil || m.Platform.OS == "unknown" {
+				continue
+			}
+			platform := platformString(m.Platform.OS, m.Platform.Architecture, m.Platform.Variant)
+			info.platforms = append(info.platforms, platform)
+			children[platform] = m
+		}
+		if len(info.platforms) == 0 {
+			return info, fmt.Errorf("index lists no platforms")
+		}
+		selected := p.matchPlatform(info.platforms)
+		if selected == "" {
+			selected = "linux/" + runtime.GOARCH
+		}
+		child, ok := children[selected]
+		if !ok {
+			child = children[info.platforms[0]]
+		}
+		b, _, err = client.GetManifest(ctx, ref.Repository, child.Digest)
+		if err != nil {
+			return info, err
+		}
+		if manifest, err = registry.ParseManifest(b); err != nil {
+			return info, err
+		}
+	}
+
+	if manifest.Config == nil {
+		return info, fmt.Errorf("manifest has no config")
+	}
+	info.size = manifest.Config.Size
+	for _, l := range manifest.Layers {
+		info.size += l.Size
+	}
+
+	blob, _, err := client.GetBlob(ctx, ref.Repository, manifest.Config.Digest)
+	if err != nil {
+		return info, err
+	}
+	defer blob.Close()
+	var config imageConfig
+	if err := json.NewDecoder(io.LimitReader(blob, 4<<20)).Decode(&config); err != nil {
+		return info, fmt.Errorf("could not parse image config: %w", err)
+	}
+	info.labels = config.Config.Labels
+	if len(info.platforms) == 0 {
+		info.platforms = []string{platformString(config.OS, config.Architecture, config.Variant)}
+	}
+	return info, nil
+}
@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+)
+
+// pushImage stores a single platform image with the given labels and a layer of size bytes.
+func pushImage(s *registrytest.Server, repo, tag, platform string, labels string, size int) registry.Descriptor {
+	parts := strings.Split(platform, "/")
+	config := []byte(`{"os":"` + parts[0] + `","architecture":"` + parts[1] + `","config":{"Labels":` + labels + `}}`)
+	layer := []byte(strings.Repeat("x", size))
+	return s.PutManifest(repo, tag, registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIManifest,
+		Config:        &registry.Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: s.PutBlob(config), Size: int64(len(config))},
+		Layers:        []registry.Descriptor{{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: s.PutBlob(layer), Size: int64(len(layer))}},
+	})
+}
+
+func newPolicy(t *testing.T, s *registrytest.Server, conf pkg.PolicyConfig) *Policy {
+	p, err := New(&conf, "")
+	assert.Equal(t, err, nil)
+	p.Client = func(host string) *registry.Client {
+		return s.Client("")
+	}
+	return p
+}
+
+func TestNameRules(t *testing.T) {
+	p, err := New(&pkg.PolicyConfig{
+		AllowedRegistries:  []string{"docker.io", "*.gcr.io"},
+		DeniedRepositories: []string{"library/*-dev", "**/debug"},
+		RequireDigest:      true,
+	}, "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, p.Inspects(), false)
+
+	result, err := p.Evaluate(context.Background(), "nginx@sha256:0123456789abcdef", false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Passed(), true)
+
+	result, err = p.Evaluate(context.Background(), "quay.io/team/debug:v1", false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Violations, []string{
+		"registry quay.io is not allowed",
+		"repository quay.io/team/debug is denied by **/debug",
+		"image is not pinned by digest",
+	})
+
+	result, err = p.Evaluate(context.Background(), "eu.gcr.io/project/app-dev@sha256:0123456789abcdef", false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Passed(), true)
+}
+
+func TestInspectionRules(t *testing.T) {
+	s := registrytest.NewServer()
+	defer s.Close()
+	pushImage(s, "team/app", "v1", "linux/amd64", `{"org.opencontainers.image.source":"https://github.com/team/app"}`, 100)
+	pushImage(s, "team/big", "v1", "linux/s390x", `{}`, 5000)
+
+	p := newPolicy(t, s, pkg.PolicyConfig{
+		MaxSize:   "1KB",
+		Platforms: []string{"linux/amd64", "linux/arm*"},
+		Labels:    []string{"org.opencontainers.image.source=https://github.com/team/*"},
+	})
+	result, err := p.Evaluate(context.Background(), s.Host+"/team/app:v1", false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Passed(), true)
+
+	result, err = p.Evaluate(context.Background(), s.Host+"/team/big:v1", false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Violations, []string{
+		"image size 5.06kB exceeds 1KB",
+		"image is only available for linux/s390x",
+		"label org.opencontainers.image.source is missing",
+	})
+
+	// offline evaluation does not contact the registry
+	result, err = p.Evaluate(context.Background(), s.Host+"/team/missing:v1", true)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Passed(), true)
+	_, err = p.Evaluate(context.Background(), s.Host+"/team/missing:v1", false)
+	assert.Equal(t, err != nil, true)
+}
+
+func TestInspectIndex(t *testing.T) {
+	s := registrytest.NewServer()
+	defer s.Close()
+	amd64 := pushImage(s, "team/multi", "", "linux/amd64", `{"tier":"frontend"}`, 10)
+	arm64 := pushImage(s, "team/multi", "", "linux/arm64", `{"tier":"backend"}`, 10)
+	amd64.Platform = &registry.Platform{OS: "linux", Architecture: "amd64"}
+	arm64.Platform = &registry.Platform{OS: "linux", Architecture: "arm64"}
+	s.PutManifest("team/multi", "v1", registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIIndex,
+		Manifests:     []registry.Descriptor{amd64, arm64},
+	})
+
+	// the labels are read from the first allowed platform
+	p := newPolicy(t, s, pkg.PolicyConfig{Platforms: []string{"linux/arm64"}, Labels: []string{"tier=backend"}})
+	result, err := p.Evaluate(context.Background(), s.Host+"/team/multi:v1", false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Passed(), true)
+
+	p = newPolicy(t, s, pkg.PolicyConfig{Platforms: []string{"windows/*"}})
+	result, err = p.Evaluate(context.Background(), s.Host+"/team/multi:v1", false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Summary(), "policy violated: image is only available for linux/amd64, linux/arm64")
+}
+
+func TestNewInvalid(t *testing.T) {
+	p, err := New(nil, "")
+	assert.Equal(t, p == nil, true)
+	assert.Equal(t, err, nil)
+
+	_, err = New(&pkg.PolicyConfig{MaxSize: "huge"}, "")
+	assert.Equal(t, err != nil, true)
+	_, err = New(&pkg.PolicyConfig{OnFailure: "ignore"}, "")
+	assert.Equal(t, err != nil, true)
+
+	p, err = New(&pkg.PolicyConfig{MaxSize: "2GiB", OnFailure: "block"}, "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, p.maxSize, int64(2<<30))
+	assert.Equal(t, p.Blocks(), true)
+}
@@ -0,0 +1,189 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+func init() {
+	Register("ecr", newECR)
+}
+
+// ecrTarget prefixes the actions of the ECR API in the X-Amz-Target header.
+const ecrTarget = "AmazonEC2ContainerRegistry_V20150921."
+
+// ecr creates the repositories pushed to an Amazon ECR registry through its API.
+type ecr struct {
+	endpoint     string
+	region       string
+	creds        awsCredentials
+	conf         pkg.ProviderConfig
+	client       *http.Client
+	now          func() time.Time
+	repositories ensured
+	// policies holds the repositories known to have a lifecycle policy
+	policies ensured
+}
+
+// ecrError is an error returned by the ECR API, e.g. RepositoryAlreadyExistsException.
+type ecrError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (e *ecrError) Error() string {
+	return e.Type + ": " + e.Message
+}
+
+func newECR(conf pkg.ProviderConfig, target pkg.Target) (Provider, error) {
+	e := &ecr{
+		endpoint: strings.TrimSuffix(conf.Endpoint, "/"),
+		region:   conf.Region,
+		creds: awsCredentials{
+			accessKeyID:     conf.AccessKeyID,
+			secretAccessKey: conf.SecretAccessKey,
+			sessionToken:    conf.SessionToken,
+		},
+		conf:   conf,
+		client: &http.Client{Timeout: time.Minute},
+		now:    time.Now,
+	}
+	if e.region == "" {
+		// private registries are named <account>.dkr.ecr.<region>.amazonaws.com
+		if parts := strings.Split(target.Hostname, "."); len(parts) > 4 && parts[1] == "dkr" && parts[2] == "ecr" {
+			e.region = parts[3]
+		} else {
+			e.region = os.Getenv("AWS_REGION")
+		}
+	}
+	if e.region == "" {
+		return nil, errors.New("the region is required, it can't be found in the hostname")
+	}
+	if e.endpoint == "" {
+		e.endpoint = "https://api.ecr." + e.region + ".amazonaws.com"
+	}
+	if e.creds.accessKeyID == "" {
+		e.creds = awsCredentials{
+			accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if e.creds.accessKeyID == "" || e.creds.secretAccessKey == "" {
+		return nil, errors.New("AWS credentials are required, set accessKeyID and secretAccessKey or $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY")
+	}
+	return e, nil
+}
+
+func (e *ecr) Name() string { return "ecr " + e.region }
+
+// EnsureRepository creates repository with the configured tag mutability and vulnerability scanning. Existing
+// repositories are left alone. When a retention is configured, repositories without a lifecycle policy are given
+// one expiring all but the most recent images.
+func (e *ecr) EnsureRepository(ctx context.Context, repository string) error {
+	if err := e.ensureRepository(ctx, repository); err != nil {
+		return err
+	}
+	if e.conf.Retention <= 0 {
+		return nil
+	}
+	// images can be pushed without a lifecycle policy, it is added by a later push
+	if err := e.policies.ensure(repository, func() error { return e.expire(ctx, repository) }); err != nil {
+		pkg.Logger.WithField("repository", repository).Warnf("Could not add the lifecycle policy of ECR repository %s, it will be retried on the next push: %v", repository, err)
+	}
+	return nil
+}
+
+// ensureRepository creates repository unless it exists.
+func (e *ecr) ensureRepository(ctx context.Context, repository string) error {
+	return e.repositories.ensure(repository, func() error {
+		mutability := "MUTABLE"
+		if e.conf.ImmutableTags {
+			mutability = "IMMUTABLE"
+		}
+		err := e.call(ctx, "CreateRepository", map[string]interface{}{
+			"repositoryName":             repository,
+			"imageTagMutability":         mutability,
+			"imageScanningConfiguration": map[string]bool{"scanOnPush": e.conf.ScanOnPush},
+		})
+		var apiErr *ecrError
+		if errors.As(err, &apiErr) && apiErr.Type == "RepositoryAlreadyExistsException" {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		pkg.Logger.WithField("repository", repository).Infof("Created ECR repository %s", repository)
+		return nil
+	})
+}
+
+// expire adds a lifecycle policy to repository, expiring all but its most recent images, unless it already has one.
+func (e *ecr) expire(ctx context.Context, repository string) error {
+	err := e.call(ctx, "GetLifecyclePolicy", map[string]string{"repositoryName": repository})
+	var apiErr *ecrError
+	if !errors.As(err, &apiErr) || apiErr.Type != "LifecyclePolicyNotFoundException" {
+		return err
+	}
+	policy, err := json.Marshal(map[string]interface{}{
+		"rules": []interface{}{map[string]interface{}{
+			"rulePriority": 1,
+			"description":  fmt.Sprintf("keep the %d most recent images", e.conf.Retention),
+			"selection": map[string]interface{}{
+				"tagStatus":   "any",
+				"countType":   "imageCountMoreThan",
+				"countNumber": e.conf.Retention,
+			},
+			"action": map[string]string{"type": "expire"},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	pkg.Logger.WithField("repository", repository).Infof("Adding a lifecycle policy to ECR repository %s", repository)
+	return e.call(ctx, "PutLifecyclePolicy", map[string]string{
+		"repositoryName":      repository,
+		"lifecyclePolicyText": string(policy),
+	})
+}
+
+// call runs action with the input in, signed with the credentials of the provider.
+func (e *ecr) call(ctx context.Context, action string, in interface{}) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", ecrTarget+action)
+	signV4(req, payload, e.creds, e.region, "ecr", e.now())
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	apiErr := &ecrError{}
+	if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Type == "" {
+		return fmt.Errorf("%s returned %s", action, resp.Status)
+	}
+	// types may be qualified by their namespace, e.g. com.amazonaws.ecr#RepositoryAlreadyExistsException
+	if i := strings.LastIndex(apiErr.Type, "#"); i >= 0 {
+		apiErr.Type = apiErr.Type[i+1:]
+	}
+	return apiErr
+}
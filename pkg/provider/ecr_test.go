@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestSignV4(t *testing.T) {
+	// the get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	signV4(req, nil, awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"},
+		"us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31")
+}
+
+// ecrStandIn serves the parts of the ECR API used to create repositories, recording the actions it received.
+type ecrStandIn struct {
+	repositories map[string]bool
+	actions      []string
+	inputs       []map[string]interface{}
+	// policies holds the repositories with a lifecycle policy
+	policies map[string]bool
+	// failPolicies makes PutLifecyclePolicy fail
+	failPolicies bool
+}
+
+func (s *ecrStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/20240102/us-west-2/ecr/aws4_request, ") {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "UnrecognizedClientException", "message": "The security token included in the request is invalid."})
+		return
+	}
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), ecrTarget)
+	var in map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&in)
+	s.actions = append(s.actions, action)
+	s.inputs = append(s.inputs, in)
+	if action == "CreateRepository" {
+		name := in["repositoryName"].(string)
+		if s.repositories[name] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.ecr#RepositoryAlreadyExistsException", "message": "exists"})
+			return
+		}
+		s.repositories[name] = true
+	}
+	if action == "GetLifecyclePolicy" && !s.policies[in["repositoryName"].(string)] {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "LifecyclePolicyNotFoundException", "message": "no policy"})
+		return
+	}
+	if action == "PutLifecyclePolicy" {
+		if s.failPolicies {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.policies[in["repositoryName"].(string)] = true
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{})
+}
+
+func TestECR(t *testing.T) {
+	standIn := &ecrStandIn{repositories: map[string]bool{"mirror/existing": true}, policies: map[string]bool{"mirror/existing": true}}
+	srv := httptest.NewServer(standIn)
+	defer srv.Close()
+
+	p, err := New("ecr", pkg.ProviderConfig{
+		Endpoint:        srv.URL,
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		ImmutableTags:   true,
+		Retention:       5,
+	}, pkg.Target{Hostname: "123456789012.dkr.ecr.us-west-2.amazonaws.com"})
+	assert.Equal(t, err, nil)
+	e := p.(*ecr)
+	assert.Equal(t, e.region, "us-west-2")
+	e.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	assert.Equal(t, p.EnsureRepository(context.Background(), "mirror/rancher/shell"), nil)
+	assert.Equal(t, p.EnsureRepository(context.Background(), "mirror/rancher/shell"), nil)
+	// existing repositories keep their settings and lifecycle policy
+	assert.Equal(t, p.EnsureRepository(context.Background(), "mirror/existing"), nil)
+	assert.Equal(t, standIn.actions, []string{"CreateRepository", "GetLifecyclePolicy", "PutLifecyclePolicy", "CreateRepository", "GetLifecyclePolicy"})
+	assert.Equal(t, standIn.inputs[0], map[string]interface{}{
+		"repositoryName":             "mirror/rancher/shell",
+		"imageTagMutability":         "IMMUTABLE",
+		"imageScanningConfiguration": map[string]interface{}{"scanOnPush": false},
+	})
+	assert.Equal(t, standIn.inputs[2]["lifecyclePolicyText"], `{"rules":[{"action":{"type":"expire"},"description":"keep the 5 most recent images",`+
+		`"rulePriority":1,"selection":{"countNumber":5,"countType":"imageCountMoreThan","tagStatus":"any"}}]}`)
+
+	// images are pushed even when the lifecycle policy can't be added, it is added by the next push
+	standIn.failPolicies = true
+	standIn.actions = nil
+	assert.Equal(t, p.EnsureRepository(context.Background(), "mirror/rancher/fleet"), nil)
+	standIn.failPolicies = false
+	assert.Equal(t, p.EnsureRepository(context.Background(), "mirror/rancher/fleet"), nil)
+	assert.Equal(t, p.EnsureRepository(context.Background(), "mirror/rancher/fleet"), nil)
+	assert.Equal(t, standIn.actions, []string{"CreateRepository", "GetLifecyclePolicy", "PutLifecyclePolicy", "GetLifecyclePolicy", "PutLifecyclePolicy"})
+	assert.Equal(t, standIn.policies["mirror/rancher/fleet"], true)
+
+	// requests are rejected when signed for another region
+	e.region = "eu-west-1"
+	err = p.EnsureRepository(context.Background(), "mirror/rancher/kubectl")
+	assert.Equal(t, err.Error(), "UnrecognizedClientException: The security token included in the request is invalid.")
+
+	t.Setenv("AWS_REGION", "")
+	_, err = New("ecr", pkg.ProviderConfig{AccessKeyID: "AKID", SecretAccessKey: "secret"}, pkg.Target{Hostname: "ecr.local"})
+	assert.Equal(t, err != nil, true)
+}
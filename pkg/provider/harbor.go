@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+func init() {
+	Register("harbor", newHarbor)
+}
+
+// harbor creates the projects of the repositories pushed to a Harbor registry through its v2.0 API.
+type harbor struct {
+	endpoint string
+	username string
+	password string
+	conf     pkg.ProviderConfig
+	client   *http.Client
+	projects ensured
+	// retained holds the projects known to have a retention policy
+	retained ensured
+}
+
+func newHarbor(conf pkg.ProviderConfig, target pkg.Target) (Provider, error) {
+	h := &harbor{
+		endpoint: strings.TrimSuffix(conf.Endpoint, "/"),
+		conf:     conf,
+		client:   &http.Client{Timeout: time.Minute},
+	}
+	if h.endpoint == "" {
+		h.endpoint = "https://" + target.Hostname
+	}
+	if target.PushAuthConfig != "" {
+		auths := strings.SplitN(target.PushAuthConfig, ":", 2)
+		if len(auths) != 2 {
+			return nil, errors.New("pushAuthConfig is improperly formatted, expected format is 'username:password'")
+		}
+		h.username, h.password = auths[0], auths[1]
+	}
+	return h, nil
+}
+
+func (h *harbor) Name() string { return "harbor " + h.endpoint }
+
+// EnsureRepository creates the project of repository, its first path segment, with the configured
+// visibility and vulnerability scanning. Repositories themselves are created by Harbor on push. When a
+// retention is configured, projects without a retention policy are given one.
+func (h *harbor) EnsureRepository(ctx context.Context, repository string) error {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("%s is not within a project, set a repository to push to", repository)
+	}
+	project := parts[0]
+	if err := h.ensureProject(ctx, project); err != nil {
+		return err
+	}
+	if h.conf.Retention <= 0 {
+		return nil
+	}
+	// images can be pushed without a retention policy, it is added by a later push
+	if err := h.retained.ensure(project, func() error { return h.retain(ctx, project) }); err != nil {
+		pkg.Logger.WithField("project", project).Warnf("Could not add the retention policy of Harbor project %s, it will be retried on the next push: %v", project, err)
+	}
+	return nil
+}
+
+// ensureProject creates project unless it exists. The settings of existing projects are left alone.
+func (h *harbor) ensureProject(ctx context.Context, project string) error {
+	return h.projects.ensure(project, func() error {
+		status, err := h.do(ctx, http.MethodHead, "/projects?project_name="+url.QueryEscape(project), nil, nil)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case http.StatusOK:
+			return nil
+		case http.StatusNotFound:
+		default:
+			return fmt.Errorf("checking project %s returned %d", project, status)
+		}
+
+		pkg.Logger.WithField("project", project).Infof("Creating Harbor project %s", project)
+		create := map[string]interface{}{
+			"project_name": project,
+			"metadata": map[string]string{
+				"public":    strconv.FormatBool(h.conf.Public),
+				"auto_scan": strconv.FormatBool(h.conf.ScanOnPush),
+			},
+		}
+		status, err = h.do(ctx, http.MethodPost, "/projects", create, nil)
+		if err != nil {
+			return err
+		}
+		// another client may have created the project in the meantime, its settings are left alone
+		if status == http.StatusConflict {
+			return nil
+		}
+		if status != http.StatusCreated {
+			return fmt.Errorf("creating project %s returned %d", project, status)
+		}
+		return nil
+	})
+}
+
+// retain adds a retention policy to project, keeping the most recently pushed images of each repository,
+// unless the project already has one.
+func (h *harbor) retain(ctx context.Context, project string) error {
+	var p struct {
+		ProjectID int `json:"project_id"`
+		Metadata  struct {
+			RetentionID string `json:"retention_id"`
+		} `json:"metadata"`
+	}
+	status, err := h.do(ctx, http.MethodGet, "/projects/"+url.PathEscape(project), nil, &p)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("reading project %s returned %d", project, status)
+	}
+	if p.Metadata.RetentionID != "" {
+		return nil
+	}
+	pkg.Logger.WithField("project", project).Infof("Adding a retention policy to Harbor project %s", project)
+	policy := map[string]interface{}{
+		"algorithm": "or",
+		"rules": []interface{}{map[string]interface{}{
+			"action":   "retain",
+			"template": "latestPushedK",
+			"params":   map[string]int{"latestPushedK": h.conf.Retention},
+			"tag_selectors": []interface{}{map[string]string{
+				"kind": "doublestar", "decoration": "matches", "pattern": "**",
+			}},
+			"scope_selectors": map[string]interface{}{
+				"repository": []interface{}{map[string]string{
+					"kind": "doublestar", "decoration": "repoMatches", "pattern": "**",
+				}},
+			},
+		}},
+		"trigger": map[string]interface{}{
+			"kind":     "Schedule",
+			"settings": map[string]string{"cron": "0 0 0 * * *"},
+		},
+		"scope": map[string]interface{}{"level": "project", "ref": p.ProjectID},
+	}
+	status, err = h.do(ctx, http.MethodPost, "/retentions", policy, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("creating the retention policy of project %s returned %d", project, status)
+	}
+	return nil
+}
+
+// do calls the API at path, sending in and decoding the response into out when set. The status code is returned.
+func (h *harbor) do(ctx context.Context, method, path string, in, out interface{}) (int, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.endpoint+"/api/v2.0"+path, body)
+	if err != nil {
+		return 0, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// project names must not be mistaken for IDs
+	req.Header.Set("X-Is-Resource-Name", "true")
+	if h.username != "" {
+		req.SetBasicAuth(h.username, h.password)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return resp.StatusCode, fmt.Errorf("%s %s was denied with %d, the push credentials must be allowed to manage projects", method, path, resp.StatusCode)
+	}
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("invalid response to %s %s: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
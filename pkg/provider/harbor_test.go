@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/magiconair/properties/assert"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	pkg.Logger = logrus.New()
+	pkg.Logger.SetOutput(io.Discard)
+}
+
+// harborStandIn serves the parts of the Harbor API used to create projects, recording the requests it received.
+type harborStandIn struct {
+	projects   map[string]int
+	requests   []string
+	created    map[string]interface{}
+	retentions []map[string]interface{}
+	// retained holds the projects with a retention policy
+	retained map[string]bool
+	// failRetentions makes the creation of retention policies fail
+	failRetentions bool
+}
+
+func (s *harborStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	if user, password, _ := r.BasicAuth(); user != "robot" || password != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodHead && r.URL.Path == "/api/v2.0/projects":
+		if _, ok := s.projects[r.URL.Query().Get("project_name")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2.0/projects":
+		var p map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&p)
+		s.created = p
+		s.projects[p["project_name"].(string)] = len(s.projects) + 1
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v2.0/projects/"):
+		name := strings.TrimPrefix(r.URL.Path, "/api/v2.0/projects/")
+		metadata := map[string]string{}
+		if s.retained[name] {
+			metadata["retention_id"] = "1"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"project_id": s.projects[name], "metadata": metadata})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2.0/retentions":
+		if s.failRetentions {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var p map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&p)
+		s.retentions = append(s.retentions, p)
+		for name, id := range s.projects {
+			if float64(id) == p["scope"].(map[string]interface{})["ref"] {
+				s.retained[name] = true
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestHarbor(t *testing.T) {
+	standIn := &harborStandIn{projects: map[string]int{"library": 1}, retained: map[string]bool{"library": true}}
+	srv := httptest.NewServer(standIn)
+	defer srv.Close()
+
+	p, err := New("harbor", pkg.ProviderConfig{Endpoint: srv.URL, ScanOnPush: true, Retention: 10}, pkg.Target{Hostname: "harbor.local", PushAuthConfig: "robot:token"})
+	assert.Equal(t, err, nil)
+
+	// existing projects and retention policies are left alone
+	assert.Equal(t, p.EnsureRepository(context.Background(), "library/nginx"), nil)
+	assert.Equal(t, standIn.requests, []string{"HEAD /api/v2.0/projects?project_name=library", "GET /api/v2.0/projects/library"})
+
+	assert.Equal(t, p.EnsureRepository(context.Background(), "mirror/rancher/shell"), nil)
+	// the project is only checked once
+	assert.Equal(t, p.EnsureRepository(context.Background(), "mirror/rancher/kubectl"), nil)
+	assert.Equal(t, standIn.requests[2:], []string{
+		"HEAD /api/v2.0/projects?project_name=mirror",
+		"POST /api/v2.0/projects",
+		"GET /api/v2.0/projects/mirror",
+		"POST /api/v2.0/retentions",
+	})
+	assert.Equal(t, standIn.created, map[string]interface{}{
+		"project_name": "mirror",
+		"metadata":     map[string]interface{}{"public": "false", "auto_scan": "true"},
+	})
+	assert.Equal(t, standIn.retentions[0]["scope"], map[string]interface{}{"level": "project", "ref": float64(2)})
+	rule := standIn.retentions[0]["rules"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, rule["params"], map[string]interface{}{"latestPushedK": float64(10)})
+
+	// images are pushed even when the retention policy can't be added, it is added by the next push
+	standIn.failRetentions = true
+	standIn.requests = nil
+	assert.Equal(t, p.EnsureRepository(context.Background(), "team/app"), nil)
+	standIn.failRetentions = false
+	assert.Equal(t, p.EnsureRepository(context.Background(), "team/app"), nil)
+	assert.Equal(t, p.EnsureRepository(context.Background(), "team/app"), nil)
+	assert.Equal(t, standIn.requests, []string{
+		"HEAD /api/v2.0/projects?project_name=team",
+		"POST /api/v2.0/projects",
+		"GET /api/v2.0/projects/team",
+		"POST /api/v2.0/retentions",
+		"GET /api/v2.0/projects/team",
+		"POST /api/v2.0/retentions",
+	})
+	assert.Equal(t, standIn.retained["team"], true)
+
+	err = p.EnsureRepository(context.Background(), "shell")
+	assert.Equal(t, err.Error(), "shell is not within a project, set a repository to push to")
+
+	denied, err := New("harbor", pkg.ProviderConfig{Endpoint: srv.URL}, pkg.Target{Hostname: "harbor.local", PushAuthConfig: "robot:guess"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, denied.EnsureRepository(context.Background(), "team/app") != nil, true)
+}
+
+func TestNew(t *testing.T) {
+	for _, name := range []string{"", "docker"} {
+		p, err := New(name, pkg.ProviderConfig{}, pkg.Target{Hostname: "my-registry.space"})
+		assert.Equal(t, err, nil)
+		assert.Equal(t, p, nil)
+	}
+	_, err := New("quay", pkg.ProviderConfig{}, pkg.Target{Hostname: "my-registry.space"})
+	assert.Equal(t, err.Error(), `unknown registry provider "quay", valid providers are [docker ecr harbor]`)
+	_, err = New("harbor", pkg.ProviderConfig{}, pkg.Target{Hostname: "my-registry.space", PushAuthConfig: "robot"})
+	assert.Equal(t, err != nil, true)
+}
@@ -0,0 +1,90 @@
+// Package provider prepares target registries for the images pushed to them, creating the projects or
+// repositories registries such as Harbor and ECR require to exist before an image can be pushed.
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	mutex "sync"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+// Provider prepares a registry for the images pushed to it.
+type Provider interface {
+	// Name identifies the provider in logs and errors
+	Name() string
+	// EnsureRepository creates repository, or the project holding it, unless it already exists.
+	// The repository does not include the registry host, e.g. mirror/rancher/shell.
+	EnsureRepository(ctx context.Context, repository string) error
+}
+
+// Factory builds the Provider of target, configured by conf.
+type Factory func(conf pkg.ProviderConfig, target pkg.Target) (Provider, error)
+
+var (
+	factoriesMu mutex.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a Provider available under the given name, which
+// can then be selected using the registryProvider of a registry in config.yaml.
+func Register(name string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = f
+}
+
+// New builds the Provider registered under name for target. Plain registries,
+// named docker or left empty, need no preparation and have no Provider.
+func New(name string, conf pkg.ProviderConfig, target pkg.Target) (Provider, error) {
+	if name == "" || name == "docker" {
+		return nil, nil
+	}
+	factoriesMu.RLock()
+	f, ok := factories[name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown registry provider %q, valid providers are %v", name, names())
+	}
+	p, err := f(conf, target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s provider for %s: %w", name, target.Hostname, err)
+	}
+	return p, nil
+}
+
+func names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	n := []string{"docker"}
+	for name := range factories {
+		n = append(n, name)
+	}
+	sort.Strings(n)
+	return n
+}
+
+// ensured remembers the projects or repositories a provider already prepared, so they are only checked once.
+type ensured struct {
+	mu   mutex.Mutex
+	done map[string]bool
+}
+
+// ensure runs create for name, unless it already succeeded.
+func (e *ensured) ensure(name string, create func() error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done[name] {
+		return nil
+	}
+	if err := create(); err != nil {
+		return err
+	}
+	if e.done == nil {
+		e.done = make(map[string]bool)
+	}
+	e.done[name] = true
+	return nil
+}
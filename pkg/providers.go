@@ -0,0 +1,237 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	RegisterSource("script", newScriptSource)
+	RegisterSource("static", newStaticSource)
+	RegisterSource("file", newURLSource(fileImages))
+	RegisterSource("compose", newURLSource(composeImages))
+	RegisterSource("dockerfile", newURLSource(dockerfileImages))
+	RegisterSource("http", newURLSource(jsonImages))
+}
+
+// ImageSources lists the image sources of the registry, SyncerScript, Catalog, Kubernetes,
+// and Helm being shorthands for a source of their own, followed by Sources.
+func (r Registry) ImageSources() []SourceConfig {
+	var confs []SourceConfig
+	if r.SyncerScript != "" {
+		confs = append(confs, SourceConfig{Type: "script", Script: r.SyncerScript, Args: r.SyncerScriptArgs})
+	}
+	if r.Catalog != nil {
+		confs = append(confs, SourceConfig{Type: "catalog", Catalog: r.Catalog})
+	}
+	if r.Kubernetes != nil {
+		confs = append(confs, SourceConfig{Type: "kubernetes", Kubernetes: r.Kubernetes})
+	}
+	if r.Helm != nil {
+		confs = append(confs, SourceConfig{Type: "helm", Helm: r.Helm})
+	}
+	return append(confs, r.Sources...)
+}
+
+// scriptSource lists the lines printed by a script.
+type scriptSource struct {
+	executor Executor
+}
+
+func newScriptSource(conf SourceConfig, _ Registry) (ImageSource, error) {
+	if conf.Script == "" {
+		return nil, errors.New("script sources require a script")
+	}
+	return &scriptSource{executor: Executor{File: conf.Script, Args: conf.Args}}, nil
+}
+
+func (s *scriptSource) Name() string { return "syncer script " + s.executor.File }
+
+func (s *scriptSource) Images(context.Context) ([]string, error) {
+	return s.executor.ExecScript()
+}
+
+// staticSource lists the images of its configuration.
+type staticSource struct {
+	images []string
+}
+
+func newStaticSource(conf SourceConfig, _ Registry) (ImageSource, error) {
+	if len(conf.Images) == 0 {
+		return nil, errors.New("static sources require images")
+	}
+	return &staticSource{images: conf.Images}, nil
+}
+
+func (s *staticSource) Name() string { return "static list" }
+
+func (s *staticSource) Images(context.Context) ([]string, error) {
+	return s.images, nil
+}
+
+// urlSource lists the images found by parse in the document at a URL.
+type urlSource struct {
+	conf  SourceConfig
+	parse func(conf SourceConfig, doc []byte) ([]string, error)
+}
+
+func newURLSource(parse func(conf SourceConfig, doc []byte) ([]string, error)) SourceFactory {
+	return func(conf SourceConfig, _ Registry) (ImageSource, error) {
+		if conf.URL == "" {
+			return nil, errors.New("a url is required")
+		}
+		return &urlSource{conf: conf, parse: parse}, nil
+	}
+}
+
+func (s *urlSource) Name() string { return s.conf.Type + " " + s.conf.URL }
+
+func (s *urlSource) Images(ctx context.Context) ([]string, error) {
+	doc, err := readURL(ctx, s.conf.URL, s.conf.Headers)
+	if err != nil {
+		return nil, err
+	}
+	return s.parse(s.conf, doc)
+}
+
+// sourceClient fetches the documents of http(s) URLs.
+var sourceClient = &http.Client{Timeout: time.Minute}
+
+// readURL reads the document at url, which is fetched for http(s) URLs and read from disk otherwise.
+func readURL(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return os.ReadFile(strings.TrimPrefix(url, "file://"))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	r, err := sourceClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", url, r.Status)
+	}
+	return io.ReadAll(r.Body)
+}
+
+// fileImages lists the lines of doc, leaving out comments starting with '#'.
+func fileImages(_ SourceConfig, doc []byte) ([]string, error) {
+	var images []string
+	scanner := bufio.NewScanner(bytes.NewReader(doc))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			images = append(images, line)
+		}
+	}
+	return images, scanner.Err()
+}
+
+// composeImages lists the images of the services of a docker-compose file. Services which are only built have none,
+// and images depending on variables are left out.
+func composeImages(_ SourceConfig, doc []byte) ([]string, error) {
+	var compose struct {
+		Services map[string]struct {
+			Image string `yaml:"image"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(doc, &compose); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+	var names []string
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var images []string
+	for _, name := range names {
+		if image := compose.Services[name].Image; image != "" && !strings.Contains(image, "$") {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// dockerfileImages lists the base images of the FROM instructions of a Dockerfile. Earlier build stages,
+// scratch, and images depending on build arguments are left out.
+func dockerfileImages(_ SourceConfig, doc []byte) ([]string, error) {
+	stages := map[string]bool{"scratch": true}
+	var images []string
+	scanner := bufio.NewScanner(bytes.NewReader(doc))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		var args []string
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "--") {
+				args = append(args, f)
+			}
+		}
+		if len(args) == 0 {
+			continue
+		}
+		image := args[0]
+		if !stages[strings.ToLower(image)] && !strings.Contains(image, "$") {
+			images = append(images, image)
+		}
+		if len(args) == 3 && strings.EqualFold(args[1], "AS") {
+			stages[strings.ToLower(args[2])] = true
+		}
+	}
+	return images, scanner.Err()
+}
+
+// jsonImages lists the images of the JSON document doc, found under the dot separated path in the Field of conf.
+// The list holds either images, or objects with an image field.
+func jsonImages(conf SourceConfig, doc []byte) ([]string, error) {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if conf.Field != "" {
+		for _, key := range strings.Split(conf.Field, ".") {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not an object", key)
+			}
+			v = obj[key]
+		}
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("the images are not a list")
+	}
+	var images []string
+	for _, item := range list {
+		switch i := item.(type) {
+		case string:
+			images = append(images, i)
+		case map[string]interface{}:
+			if image, ok := i["image"].(string); ok {
+				images = append(images, image)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected item %v in the list of images", item)
+		}
+	}
+	return images, nil
+}
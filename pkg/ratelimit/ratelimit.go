@@ -0,0 +1,249 @@
+// Package ratelimit limits the requests, concurrent blob transfers, and bandwidth picture-book
+// uses per registry, and pauses requests to registries which report their rate limit was reached.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	mutex "sync"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+// Config is a single entry of the rateLimits section of config.yaml
+type Config struct {
+	// Registry is the host, or a pattern of hosts, the limits apply to, e.g. docker.io or *.gcr.io
+	Registry string `yaml:"registry"`
+	// RequestsPerMinute is the maximum rate of requests made to the registry
+	RequestsPerMinute int `yaml:"requestsPerMinute"`
+	// ConcurrentTransfers is the maximum number of layers, or pulls and pushes through the docker daemon, in flight at once
+	ConcurrentTransfers int `yaml:"concurrentTransfers"`
+	// Bandwidth is the maximum number of bytes transferred per second, e.g. 10MB or 512KiB
+	Bandwidth string `yaml:"bandwidth"`
+}
+
+var (
+	mu       mutex.Mutex
+	configs  []Config
+	limiters = make(map[string]*Limiter)
+)
+
+// Client is an HTTP client whose requests are subject to the limits of the registry they are sent to.
+var Client = &http.Client{Transport: &Transport{Base: http.DefaultTransport}}
+
+// Configure sets the limits applied to registries. Hosts matching several entries use the first one.
+func Configure(confs []Config) error {
+	for _, conf := range confs {
+		if conf.Registry == "" {
+			return fmt.Errorf("rate limits require a registry")
+		}
+		if conf.Bandwidth != "" {
+			if _, err := pkg.ParseSize(conf.Bandwidth); err != nil {
+				return fmt.Errorf("invalid bandwidth %s for %s: %w", conf.Bandwidth, conf.Registry, err)
+			}
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	configs = confs
+	limiters = make(map[string]*Limiter)
+	return nil
+}
+
+// Host normalizes the host of a registry, so the aliases of Docker Hub share a limiter.
+func Host(host string) string {
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "docker.io"
+	}
+	return host
+}
+
+// For returns the limiter of a registry. Registries without configured limits
+// get a limiter which only pauses when the registry reports its rate limit was reached.
+func For(host string) *Limiter {
+	host = Host(host)
+	mu.Lock()
+	defer mu.Unlock()
+	if l, ok := limiters[host]; ok {
+		return l
+	}
+	l := &Limiter{Host: host}
+	for _, conf := range configs {
+		if conf.Registry != host && !pkg.MatchGlob(conf.Registry, host) {
+			continue
+		}
+		if conf.RequestsPerMinute > 0 {
+			l.interval = time.Minute / time.Duration(conf.RequestsPerMinute)
+		}
+		if conf.ConcurrentTransfers > 0 {
+			l.transfers = make(chan struct{}, conf.ConcurrentTransfers)
+		}
+		if conf.Bandwidth != "" {
+			l.bandwidth, _ = pkg.ParseSize(conf.Bandwidth)
+		}
+		break
+	}
+	limiters[host] = l
+	return l
+}
+
+// Limiter enforces the limits of a single registry. It is safe for concurrent use.
+type Limiter struct {
+	Host string
+
+	interval  time.Duration
+	bandwidth int64
+	transfers chan struct{}
+
+	mu     mutex.Mutex
+	next   time.Time
+	paused time.Time
+	bytes  time.Time
+}
+
+// sleep waits until t, or until ctx is done.
+func sleep(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Wait blocks until a request may be made to the registry.
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	t := time.Now()
+	if l.paused.After(t) {
+		t = l.paused
+	}
+	if l.next.After(t) {
+		t = l.next
+	}
+	if l.interval > 0 {
+		l.next = t.Add(l.interval)
+	}
+	l.mu.Unlock()
+	return sleep(ctx, t)
+}
+
+// Charge accounts for n requests which were made without waiting, e.g. by the docker daemon,
+// delaying the requests made afterwards.
+func (l *Limiter) Charge(n int) {
+	if l.interval == 0 || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now := time.Now(); l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * l.interval)
+}
+
+// Pause holds every request to the registry until t.
+func (l *Limiter) Pause(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t.After(l.paused) {
+		l.paused = t
+		pkg.Logger.WithField("registry", l.Host).Warnf("Rate limit of %s reached, pausing requests until %s", l.Host, t.Format(pkg.TimeFormat))
+	}
+}
+
+// Paused returns the time requests to the registry are paused until, which is in the past when they are not.
+func (l *Limiter) Paused() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.paused
+}
+
+// Throttled reports if the bandwidth used for the registry is limited.
+func (l *Limiter) Throttled() bool {
+	return l.bandwidth > 0
+}
+
+// Acquire blocks until a transfer may start, the returned function must be called once it is done.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l.transfers == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.transfers <- struct{}{}:
+		var once mutex.Once
+		return func() { once.Do(func() { <-l.transfers }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// throttle blocks until n bytes may be transferred.
+func (l *Limiter) throttle(ctx context.Context, n int) error {
+	if l.bandwidth <= 0 || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	t := time.Now()
+	if l.bytes.After(t) {
+		t = l.bytes
+	}
+	l.bytes = t.Add(time.Duration(int64(n) * int64(time.Second) / l.bandwidth))
+	l.mu.Unlock()
+	return sleep(ctx, t)
+}
+
+// Observe pauses the registry when a response reports its rate limit was reached, either
+// through a 429 status or the RateLimit-Remaining header sent by Docker Hub, e.g. '0;w=21600'.
+func (l *Limiter) Observe(r *http.Response) {
+	remaining, window, ok := parseRateLimit(r.Header.Get("RateLimit-Remaining"))
+	if reset, err := strconv.Atoi(r.Header.Get("RateLimit-Reset")); err == nil {
+		window = time.Duration(reset) * time.Second
+	}
+	if r.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(r.Header.Get("Retry-After")); err == nil {
+			window = time.Duration(seconds) * time.Second
+		}
+		if window == 0 {
+			window = time.Minute
+		}
+		l.Pause(time.Now().Add(window))
+		return
+	}
+	if ok && remaining <= 0 && window > 0 {
+		l.Pause(time.Now().Add(window))
+	}
+}
+
+// parseRateLimit parses a RateLimit header, which is a count optionally followed by the window in seconds.
+func parseRateLimit(h string) (int, time.Duration, bool) {
+	if h == "" {
+		return 0, 0, false
+	}
+	parts := strings.Split(h, ";")
+	count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	var window time.Duration
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "w=") {
+			if seconds, err := strconv.Atoi(p[2:]); err == nil {
+				window = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return count, window, true
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/magiconair/properties/assert"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	pkg.Logger = logrus.New()
+	pkg.Logger.SetOutput(io.Discard)
+}
+
+func TestParseRateLimit(t *testing.T) {
+	for h, want := range map[string]struct {
+		count  int
+		window time.Duration
+		ok     bool
+	}{
+		"76;w=21600": {76, 6 * time.Hour, true},
+		"0":          {0, 0, true},
+		"":           {0, 0, false},
+		"many":       {0, 0, false},
+	} {
+		count, window, ok := parseRateLimit(h)
+		assert.Equal(t, count, want.count, h)
+		assert.Equal(t, window, want.window, h)
+		assert.Equal(t, ok, want.ok, h)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	assert.Equal(t, Configure([]Config{{Registry: "*.limited.test", RequestsPerMinute: 600, ConcurrentTransfers: 1}}), nil)
+	l := For("registry.limited.test")
+	assert.Equal(t, For("registry.limited.test") == l, true)
+	assert.Equal(t, For("index.docker.io") == For("docker.io"), true)
+
+	// requests are spaced by 100ms, and charged requests delay the next ones
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, l.Wait(context.Background()), nil)
+	}
+	l.Charge(2)
+	assert.Equal(t, l.Wait(context.Background()), nil)
+	assert.Equal(t, time.Since(start) >= 500*time.Millisecond, true)
+
+	// unconfigured registries are not limited
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, For("other.test").Wait(context.Background()), nil)
+	}
+	assert.Equal(t, time.Since(start) < 100*time.Millisecond, true)
+
+	release, err := l.Acquire(context.Background())
+	assert.Equal(t, err, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx)
+	assert.Equal(t, err, context.DeadlineExceeded)
+	release()
+	release()
+	release, err = l.Acquire(context.Background())
+	assert.Equal(t, err, nil)
+	release()
+
+	assert.Equal(t, Configure([]Config{{Registry: "docker.io", Bandwidth: "fast"}}) != nil, true)
+}
+
+func TestTransport(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/exhausted/manifests/v1":
+			w.Header().Set("RateLimit-Limit", "100;w=21600")
+			w.Header().Set("RateLimit-Remaining", "0;w=21600")
+		case "/v2/throttled/manifests/v1":
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/v2/blob/blobs/sha256:abc":
+			w.Write([]byte(strings.Repeat("a", 96*1024)))
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	// a second registry, which is paused independently
+	hub := httptest.NewServer(handler)
+	defer hub.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	assert.Equal(t, Configure([]Config{{Registry: host, Bandwidth: "128KB"}}), nil)
+
+	start := time.Now()
+	r, err := Client.Get(server.URL + "/v2/blob/blobs/sha256:abc")
+	assert.Equal(t, err, nil)
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(b), 96*1024)
+	assert.Equal(t, time.Since(start) >= 400*time.Millisecond, true)
+
+	// registries are paused once they report their limit was reached
+	r, err = Client.Get(server.URL + "/v2/throttled/manifests/v1")
+	assert.Equal(t, err, nil)
+	r.Body.Close()
+	paused := time.Until(For(host).Paused())
+	assert.Equal(t, paused > 25*time.Second && paused <= 30*time.Second, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, For(host).Wait(ctx), context.DeadlineExceeded)
+
+	r, err = Client.Get(hub.URL + "/v2/exhausted/manifests/v1")
+	assert.Equal(t, err, nil)
+	r.Body.Close()
+	assert.Equal(t, time.Until(For(strings.TrimPrefix(hub.URL, "http://")).Paused()) > 5*time.Hour, true)
+}
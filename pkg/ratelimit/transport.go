@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// chunk bounds the bytes read at once from a throttled body, so transfers progress smoothly.
+const chunk = 32 * 1024
+
+// Transport applies the limits of the registry each request is sent to.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	l := For(req.URL.Host)
+	if err := l.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	// blob downloads and uploads are transfers, requests for manifests or starting an upload are not
+	transfer := strings.Contains(req.URL.Path, "/blobs/") &&
+		(req.Method == http.MethodGet || ((req.Method == http.MethodPut || req.Method == http.MethodPatch) && req.Body != nil))
+	release := func() {}
+	if transfer {
+		var err error
+		if release, err = l.Acquire(ctx); err != nil {
+			return nil, err
+		}
+		if req.Body != nil && l.bandwidth > 0 {
+			req = req.Clone(ctx)
+			req.Body = &body{ReadCloser: req.Body, ctx: ctx, limiter: l}
+		}
+	}
+
+	r, err := t.Base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	l.Observe(r)
+	if transfer && req.Method == http.MethodGet {
+		// the transfer only ends once the blob was read
+		r.Body = &body{ReadCloser: r.Body, ctx: ctx, limiter: l, release: release}
+		return r, nil
+	}
+	release()
+	return r, nil
+}
+
+// body throttles reads to the bandwidth of a limiter, and ends a transfer once closed.
+type body struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *Limiter
+	release func()
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.limiter.bandwidth > 0 && len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if werr := b.limiter.throttle(b.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	if b.release != nil {
+		b.release()
+	}
+	return b.ReadCloser.Close()
+}
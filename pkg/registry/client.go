@@ -0,0 +1,524 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	mutex "sync"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// ErrUnsupported is returned when the registry does not support an operation, such as deleting tags.
+var ErrUnsupported = errors.New("unsupported by registry")
+
+// Client talks to a registry using the OCI distribution API. It handles basic
+// authentication as well as the bearer token flow used by DockerHub and Harbor.
+type Client struct {
+	// Host is the registry hostname as used in image references
+	Host string
+	// Auth is 'username:password', or empty for anonymous access
+	Auth string
+	// Scheme defaults to https
+	Scheme string
+	HTTP   *http.Client
+
+	mu     mutex.Mutex
+	tokens map[string]string
+	basic  bool
+}
+
+func NewClient(host, auth string) *Client {
+	return &Client{
+		Host:   host,
+		Auth:   auth,
+		Scheme: "https",
+		HTTP:   http.DefaultClient,
+		tokens: make(map[string]string),
+	}
+}
+
+func (c *Client) baseURL() string {
+	host := c.Host
+	if host == DockerHub {
+		host = dockerHubAPI
+	}
+	scheme := c.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return scheme + "://" + host
+}
+
+func (c *Client) credentials() (string, string, bool) {
+	parts := strings.SplitN(c.Auth, ":", 2)
+	if c.Auth == "" || len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Do sends a request to the registry, path is relative to the registry root (e.g. /v2/).
+// scope is the token scope needed for the request, e.g. repository:rancher/shell:pull.
+// On a 401 the challenge is answered and the request retried once, which requires the body
+// to be nil or rewindable through GetBody.
+func (c *Client) Do(ctx context.Context, method, path, scope string, header http.Header, body io.Reader) (*http.Response, error) {
+	u := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		u = c.baseURL() + path
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	c.authorize(req, scope)
+
+	r, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusUnauthorized {
+		return r, nil
+	}
+
+	challenge := r.Header.Get("WWW-Authenticate")
+	r.Body.Close()
+	if err := c.answerChallenge(ctx, challenge, scope); err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("%s %s: unauthorized", method, u)
+		}
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	c.authorize(req, scope)
+	return c.HTTP.Do(req)
+}
+
+func (c *Client) authorize(req *http.Request, scope string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if token, ok := c.tokens[scope]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return
+	}
+	if user, pass, ok := c.credentials(); ok && c.basic {
+		req.SetBasicAuth(user, pass)
+	}
+}
+
+// answerChallenge handles a WWW-Authenticate header, either enabling basic
+// auth or fetching a bearer token for the scope from the token service.
+func (c *Client) answerChallenge(ctx context.Context, challenge, scope string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if _, _, ok := c.credentials(); !ok {
+			return fmt.Errorf("%s requires credentials", c.Host)
+		}
+		c.mu.Lock()
+		c.basic = true
+		c.mu.Unlock()
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("%s responded with an unsupported authentication challenge %q", c.Host, challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("%s responded with an invalid token realm %q", c.Host, params["realm"])
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	tokenScope := scope
+	if params["scope"] != "" {
+		tokenScope = params["scope"]
+	}
+	// scopes covering several repositories, such as blob mounts, are sent as separate parameters
+	for _, s := range strings.Fields(tokenScope) {
+		q.Add("scope", s)
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if user, pass, ok := c.credentials(); ok {
+		req.SetBasicAuth(user, pass)
+	}
+	r, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not fetch token for %s: %w", c.Host, err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not fetch token for %s: %s", c.Host, r.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+		return fmt.Errorf("could not decode token for %s: %w", c.Host, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	// requests are authorized by the scope they asked for, which the registry may have answered with another one
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[scope] = token.Token
+	c.tokens[tokenScope] = token.Token
+	return nil
+}
+
+// parseChallenge parses headers like: Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(h string) (string, map[string]string) {
+	params := make(map[string]string)
+	h = strings.TrimSpace(h)
+	i := strings.Index(h, " ")
+	if i < 0 {
+		return h, params
+	}
+	scheme, rest := h[:i], h[i+1:]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[strings.ToLower(key)] = value
+	}
+	return scheme, params
+}
+
+func pullScope(repo string) string {
+	return "repository:" + repo + ":pull"
+}
+
+func pushScope(repo string) string {
+	return "repository:" + repo + ":pull,push"
+}
+
+func deleteScope(repo string) string {
+	return "repository:" + repo + ":delete"
+}
+
+func responseError(r *http.Response, what string) error {
+	if r.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", what, ErrNotFound)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(r.Body, 1024))
+	return fmt.Errorf("%s: %s: %s", what, r.Status, strings.TrimSpace(string(msg)))
+}
+
+// Head resolves a tag or digest to the descriptor of its manifest.
+func (c *Client) Head(ctx context.Context, repo, reference string) (Descriptor, error) {
+	r, err := c.Do(ctx, http.MethodHead, "/v2/"+repo+"/manifests/"+reference, pullScope(repo), http.Header{"Accept": {manifestAccept}}, nil)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return Descriptor{}, responseError(r, fmt.Sprintf("HEAD %s/%s:%s", c.Host, repo, reference))
+	}
+
+	size, _ := strconv.ParseInt(r.Header.Get("Content-Length"), 10, 64)
+	d := Descriptor{
+		MediaType: r.Header.Get("Content-Type"),
+		Digest:    r.Header.Get("Docker-Content-Digest"),
+		Size:      size,
+	}
+	if d.Digest == "" {
+		// not all registries return the digest for HEAD requests
+		_, d, err = c.GetManifest(ctx, repo, reference)
+	}
+	return d, err
+}
+
+// GetManifest fetches the manifest for a tag or digest.
+func (c *Client) GetManifest(ctx context.Context, repo, reference string) ([]byte, Descriptor, error) {
+	r, err := c.Do(ctx, http.MethodGet, "/v2/"+repo+"/manifests/"+reference, pullScope(repo), http.Header{"Accept": {manifestAccept}}, nil)
+	if err != nil {
+		return nil, Descriptor{}, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, Descriptor{}, responseError(r, fmt.Sprintf("GET %s/%s:%s", c.Host, repo, reference))
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, Descriptor{}, err
+	}
+
+	d := Descriptor{
+		MediaType: r.Header.Get("Content-Type"),
+		Digest:    Digest(b),
+		Size:      int64(len(b)),
+	}
+	if m, err := ParseManifest(b); err == nil && m.MediaType != "" {
+		d.MediaType = m.MediaType
+	}
+	return b, d, nil
+}
+
+// PutManifest uploads a manifest under reference, which is either a tag or the manifests digest.
+// The returned bool reports if the registry processed the manifests subject, meaning
+// the referrers API is supported and the fallback tag does not need to be maintained.
+func (c *Client) PutManifest(ctx context.Context, repo, reference, mediaType string, manifest []byte) (bool, error) {
+	r, err := c.Do(ctx, http.MethodPut, "/v2/"+repo+"/manifests/"+reference, pushScope(repo), http.Header{"Content-Type": {mediaType}}, bytes.NewReader(manifest))
+	if err != nil {
+		return false, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusCreated && r.StatusCode != http.StatusOK {
+		return false, responseError(r, fmt.Sprintf("PUT %s/%s:%s", c.Host, repo, reference))
+	}
+	return r.Header.Get("OCI-Subject") != "", nil
+}
+
+// DeleteManifest deletes the manifest a tag or digest refers to. Not every registry supports
+// deleting tags, ErrUnsupported is returned when the registry refuses to.
+func (c *Client) DeleteManifest(ctx context.Context, repo, reference string) error {
+	r, err := c.Do(ctx, http.MethodDelete, "/v2/"+repo+"/manifests/"+reference, deleteScope(repo), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	switch r.StatusCode {
+	case http.StatusAccepted, http.StatusOK:
+		return nil
+	case http.StatusMethodNotAllowed, http.StatusBadRequest:
+		return fmt.Errorf("DELETE %s/%s:%s: %s: %w", c.Host, repo, reference, r.Status, ErrUnsupported)
+	}
+	return responseError(r, fmt.Sprintf("DELETE %s/%s:%s", c.Host, repo, reference))
+}
+
+// BlobExists reports if the repository already holds a blob.
+func (c *Client) BlobExists(ctx context.Context, repo, digest string) (bool, error) {
+	r, err := c.Do(ctx, http.MethodHead, "/v2/"+repo+"/blobs/"+digest, pullScope(repo), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer r.Body.Close()
+	switch r.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, responseError(r, fmt.Sprintf("HEAD %s/%s@%s", c.Host, repo, digest))
+	}
+}
+
+// GetBlob opens a blob for reading, the caller must close it.
+func (c *Client) GetBlob(ctx context.Context, repo, digest string) (io.ReadCloser, int64, error) {
+	r, err := c.Do(ctx, http.MethodGet, "/v2/"+repo+"/blobs/"+digest, pullScope(repo), nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.StatusCode != http.StatusOK {
+		defer r.Body.Close()
+		return nil, 0, responseError(r, fmt.Sprintf("GET %s/%s@%s", c.Host, repo, digest))
+	}
+	return r.Body, r.ContentLength, nil
+}
+
+// PushBlob uploads a blob in a single request.
+func (c *Client) PushBlob(ctx context.Context, repo string, desc Descriptor, blob io.Reader) error {
+	// starting the upload also takes care of authentication, since the blob itself can't be re-sent
+	r, err := c.Do(ctx, http.MethodPost, "/v2/"+repo+"/blobs/uploads/", pushScope(repo), nil, nil)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return responseError(r, fmt.Sprintf("POST %s/%s blob upload", c.Host, repo))
+	}
+
+	location, err := r.Request.URL.Parse(r.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid blob upload location from %s: %w", c.Host, err)
+	}
+	q := location.Query()
+	q.Set("digest", desc.Digest)
+	location.RawQuery = q.Encode()
+
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	if desc.Size > 0 {
+		header.Set("Content-Length", strconv.FormatInt(desc.Size, 10))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location.String(), blob)
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.ContentLength = desc.Size
+	c.authorize(req, pushScope(repo))
+	r, err = c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusCreated {
+		return responseError(r, fmt.Sprintf("PUT %s/%s@%s", c.Host, repo, desc.Digest))
+	}
+	return nil
+}
+
+// MountBlob mounts a blob the registry holds in the repository from into repo, so it does not
+// need to be uploaded again. It reports false if the registry did not mount it, for example
+// because from does not hold it or the credentials can not read from.
+func (c *Client) MountBlob(ctx context.Context, repo, digest, from string) (bool, error) {
+	q := url.Values{"mount": {digest}, "from": {from}}
+	r, err := c.Do(ctx, http.MethodPost, "/v2/"+repo+"/blobs/uploads/?"+q.Encode(), pushScope(repo)+" "+pullScope(from), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	r.Body.Close()
+	switch r.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		// the registry started a regular upload instead, which is left for it to expire if it can't be cancelled
+		if location, err := r.Request.URL.Parse(r.Header.Get("Location")); err == nil && r.Header.Get("Location") != "" {
+			if r, err := c.Do(ctx, http.MethodDelete, location.String(), pushScope(repo), nil, nil); err == nil {
+				r.Body.Close()
+			}
+		}
+		return false, nil
+	default:
+		return false, responseError(r, fmt.Sprintf("POST %s/%s mount of %s from %s", c.Host, repo, digest, from))
+	}
+}
+
+// Tags lists every tag in a repository, following pagination links.
+func (c *Client) Tags(ctx context.Context, repo string) ([]string, error) {
+	return c.list(ctx, "/v2/"+repo+"/tags/list", pullScope(repo), "tags", fmt.Sprintf("GET %s/%s tags", c.Host, repo))
+}
+
+// Catalog lists every repository in the registry, following pagination links.
+func (c *Client) Catalog(ctx context.Context) ([]string, error) {
+	return c.list(ctx, "/v2/_catalog", "registry:catalog:*", "repositories", fmt.Sprintf("GET %s catalog", c.Host))
+}
+
+// list reads the key list of a paginated response, such as the tags of a repository.
+func (c *Client) list(ctx context.Context, path, scope, key, what string) ([]string, error) {
+	var items []string
+	next := path
+	for next != "" {
+		r, err := c.Do(ctx, http.MethodGet, next, scope, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if r.StatusCode != http.StatusOK {
+			err = responseError(r, what)
+			r.Body.Close()
+			return nil, err
+		}
+		var page map[string]json.RawMessage
+		err = json.NewDecoder(r.Body).Decode(&page)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		var pageItems []string
+		if page[key] != nil {
+			if err := json.Unmarshal(page[key], &pageItems); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, pageItems...)
+		next = nextLink(r)
+	}
+	return items, nil
+}
+
+// nextLink returns the target of a Link: <url>; rel="next" header, if any.
+func nextLink(r *http.Response) string {
+	link := r.Header.Get("Link")
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	u, err := r.Request.URL.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// Referrers lists the manifests whose subject is digest, using the referrers API
+// and falling back to the referrers tag schema for registries which don't support it.
+func (c *Client) Referrers(ctx context.Context, repo, digest string) ([]Descriptor, error) {
+	r, err := c.Do(ctx, http.MethodGet, "/v2/"+repo+"/referrers/"+digest, pullScope(repo), http.Header{"Accept": {MediaTypeOCIIndex}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	var index Manifest
+	if r.StatusCode == http.StatusOK && strings.HasPrefix(r.Header.Get("Content-Type"), MediaTypeOCIIndex) {
+		if err := json.NewDecoder(r.Body).Decode(&index); err != nil {
+			return nil, err
+		}
+		return index.Manifests, nil
+	}
+
+	b, _, err := c.GetManifest(ctx, repo, ReferrersTag(digest))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if index, err = ParseManifest(b); err != nil {
+		return nil, err
+	}
+	return index.Manifests, nil
+}
+
+// ReferrersTag is the fallback tag which holds an index of the referrers of digest.
+func ReferrersTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1)
+}
@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Copy copies the manifest at srcRepo:reference from src to dstRepo:dstReference on dst,
+// along with every blob it references and, for indexes, every child manifest. Blobs which
+// already exist on dst are not transferred again. An empty dstReference pushes by digest.
+func Copy(ctx context.Context, src *Client, srcRepo, reference string, dst *Client, dstRepo, dstReference string) (Descriptor, error) {
+	b, desc, err := src.GetManifest(ctx, srcRepo, reference)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	m, err := ParseManifest(b)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("could not parse manifest %s/%s:%s: %w", src.Host, srcRepo, reference, err)
+	}
+
+	if IsIndex(desc.MediaType) {
+		for _, child := range m.Manifests {
+			if _, err := Copy(ctx, src, srcRepo, child.Digest, dst, dstRepo, ""); err != nil {
+				return Descriptor{}, err
+			}
+		}
+	} else {
+		for _, blob := range m.Blobs() {
+			if err := CopyBlob(ctx, src, srcRepo, dst, dstRepo, blob); err != nil {
+				return Descriptor{}, err
+			}
+		}
+	}
+
+	if dstReference == "" {
+		dstReference = desc.Digest
+	}
+	subjectProcessed, err := dst.PutManifest(ctx, dstRepo, dstReference, desc.MediaType, b)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if m.Subject != nil && !subjectProcessed {
+		desc.ArtifactType = m.ArtifactType
+		if desc.ArtifactType == "" && m.Config != nil {
+			desc.ArtifactType = m.Config.MediaType
+		}
+		if err := addReferrer(ctx, dst, dstRepo, m.Subject.Digest, desc); err != nil {
+			return Descriptor{}, err
+		}
+	}
+	return desc, nil
+}
+
+// CopyBlob copies a single blob, unless dst already has it.
+func CopyBlob(ctx context.Context, src *Client, srcRepo string, dst *Client, dstRepo string, blob Descriptor) error {
+	exists, err := dst.BlobExists(ctx, dstRepo, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	r, size, err := src.GetBlob(ctx, srcRepo, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if blob.Size == 0 {
+		blob.Size = size
+	}
+	return dst.PushBlob(ctx, dstRepo, blob, r)
+}
+
+// addReferrer maintains the referrers tag schema index on registries
+// which don't support the referrers API.
+func addReferrer(ctx context.Context, c *Client, repo, subject string, referrer Descriptor) error {
+	index := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIIndex,
+	}
+	b, _, err := c.GetManifest(ctx, repo, ReferrersTag(subject))
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return err
+	default:
+		if index, err = ParseManifest(b); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range index.Manifests {
+		if m.Digest == referrer.Digest {
+			return nil
+		}
+	}
+	index.Manifests = append(index.Manifests, referrer)
+	b, err = json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	_, err = c.PutManifest(ctx, repo, ReferrersTag(subject), MediaTypeOCIIndex, b)
+	return err
+}
+
+// cosignSuffixes are the tag suffixes cosign uses to store signatures,
+// attestations, and SBOMs next to an image.
+var cosignSuffixes = []string{"sig", "att", "sbom"}
+
+// CopyArtifacts copies the cosign signatures, attestations, and SBOMs of the manifest
+// digest, as well as any OCI referrers of it, from src to dst. The tags and digests of
+// the copied artifacts are returned.
+func CopyArtifacts(ctx context.Context, src *Client, srcRepo, digest string, dst *Client, dstRepo string) ([]string, error) {
+	var copied []string
+	for _, suffix := range cosignSuffixes {
+		tag := ReferrersTag(digest) + "." + suffix
+		_, err := src.Head(ctx, srcRepo, tag)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return copied, err
+		}
+		if _, err := Copy(ctx, src, srcRepo, tag, dst, dstRepo, tag); err != nil {
+			return copied, fmt.Errorf("could not copy %s: %w", tag, err)
+		}
+		copied = append(copied, tag)
+	}
+
+	referrers, err := src.Referrers(ctx, srcRepo, digest)
+	if err != nil {
+		return copied, fmt.Errorf("could not list referrers of %s: %w", digest, err)
+	}
+	for _, r := range referrers {
+		if _, err := Copy(ctx, src, srcRepo, r.Digest, dst, dstRepo, ""); err != nil {
+			return copied, fmt.Errorf("could not copy referrer %s: %w", r.Digest, err)
+		}
+		name := r.Digest
+		if r.ArtifactType != "" {
+			name = strings.Join([]string{r.ArtifactType, r.Digest}, " ")
+		}
+		copied = append(copied, name)
+	}
+	return copied, nil
+}
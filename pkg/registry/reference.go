@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DockerHub is the registry used for images which don't specify one
+	DockerHub = "docker.io"
+	// dockerHubAPI is the host actually serving the registry API for DockerHub
+	dockerHubAPI = "registry-1.docker.io"
+)
+
+// Reference is a parsed image reference, e.g. docker.io/rancher/shell:v0.1.19
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference using the same defaulting rules as docker,
+// so 'nginx' is docker.io/library/nginx:latest.
+func ParseReference(image string) (Reference, error) {
+	var ref Reference
+	image = strings.TrimSpace(image)
+	if image == "" {
+		return ref, fmt.Errorf("empty image reference")
+	}
+
+	if i := strings.Index(image, "@"); i >= 0 {
+		ref.Digest = image[i+1:]
+		image = image[:i]
+		if !strings.Contains(ref.Digest, ":") {
+			return ref, fmt.Errorf("invalid digest in image reference %s", image)
+		}
+	}
+
+	// a tag is anything after the last colon, as long as it isn't part of the registry host:port
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i+1:], "/") {
+		ref.Tag = image[i+1:]
+		image = image[:i]
+	}
+
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Registry = parts[0]
+		ref.Repository = parts[1]
+	} else {
+		ref.Registry = DockerHub
+		ref.Repository = image
+	}
+	if ref.Registry == DockerHub && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	if ref.Repository == "" {
+		return ref, fmt.Errorf("invalid image reference %s", image)
+	}
+	return ref, nil
+}
+
+// Name is the registry and repository of the reference, without a tag or digest.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// Reference is the tag, or digest if set, used to address the manifest of the image.
+func (r Reference) Reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
@@ -0,0 +1,117 @@
+package registry_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestParseReference(t *testing.T) {
+	cases := map[string]string{
+		"nginx":                   "docker.io/library/nginx:latest",
+		"rancher/shell:v0.1.19":   "docker.io/rancher/shell:v0.1.19",
+		"localhost:5000/team/app": "localhost:5000/team/app:latest",
+		"my-registry.space/rancher/shell:v1@sha256:abc": "my-registry.space/rancher/shell:v1@sha256:abc",
+	}
+	for in, want := range cases {
+		ref, err := registry.ParseReference(in)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, ref.String(), want)
+	}
+
+	ref, _ := registry.ParseReference("localhost:5000/team/app@sha256:abc")
+	assert.Equal(t, ref.Reference(), "sha256:abc")
+	assert.Equal(t, ref.Repository, "team/app")
+}
+
+func TestCopyArtifacts(t *testing.T) {
+	ctx := context.Background()
+	src := registrytest.NewServer()
+	defer src.Close()
+	dst := registrytest.NewServer()
+	defer dst.Close()
+	dst.Referrers = false
+	dst.Username, dst.Password = "user", "pass"
+
+	image := src.PushImage("rancher/shell", "v0.1.19", "layer-one", "layer-two")
+	signature := src.PushImage("rancher/shell", registry.ReferrersTag(image.Digest)+".sig", "signature")
+	sbom := registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIManifest,
+		ArtifactType:  "application/spdx+json",
+		Config:        &registry.Descriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: src.PutBlob([]byte("{}")), Size: 2},
+		Layers:        []registry.Descriptor{{MediaType: "application/spdx+json", Digest: src.PutBlob([]byte("sbom")), Size: 4}},
+		Subject:       &image,
+	}
+	sbomDesc := src.PutManifest("rancher/shell", "", sbom)
+
+	srcClient, dstClient := src.Client(""), dst.Client("user:pass")
+	_, err := registry.Copy(ctx, srcClient, "rancher/shell", "v0.1.19", dstClient, "mirror/rancher/shell", "v0.1.19")
+	assert.Equal(t, err, nil)
+
+	copied, err := registry.CopyArtifacts(ctx, srcClient, "rancher/shell", image.Digest, dstClient, "mirror/rancher/shell")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, copied, []string{registry.ReferrersTag(image.Digest) + ".sig", "application/spdx+json " + sbomDesc.Digest})
+	assert.Equal(t, dst.HasManifest("mirror/rancher/shell", signature.Digest), true)
+	assert.Equal(t, dst.HasManifest("mirror/rancher/shell", sbomDesc.Digest), true)
+
+	// dst doesn't support the referrers API, so the fallback tag must list the SBOM
+	referrers, err := dstClient.Referrers(ctx, "mirror/rancher/shell", image.Digest)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(referrers), 1)
+	assert.Equal(t, referrers[0].Digest, sbomDesc.Digest)
+	assert.Equal(t, referrers[0].ArtifactType, "application/spdx+json")
+
+	// copying again must not transfer any blobs
+	uploads := dst.Uploads()
+	_, err = registry.CopyArtifacts(ctx, srcClient, "rancher/shell", image.Digest, dstClient, "mirror/rancher/shell")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, dst.Uploads(), uploads)
+}
+
+func TestTagsPagination(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	src.PageSize = 2
+	for _, tag := range []string{"v1", "v2", "v3"} {
+		src.PushImage("team/app", tag, "layer-"+tag)
+	}
+	c := src.Client("")
+	tags, err := c.Tags(context.Background(), "team/app")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, tags, []string{"v1", "v2", "v3"})
+	assert.Equal(t, src.Requests["GET /v2/team/app/tags/list"], 2)
+}
+
+func TestTokenScope(t *testing.T) {
+	// the token service grants the scope of the challenge, which differs from the one the client asks for
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			fmt.Fprintf(w, `{"token":%q}`, r.URL.Query().Get("scope"))
+		case r.Header.Get("Authorization") == "Bearer repository:team/app:pull":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",scope="repository:team/app:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	c := registry.NewClient(strings.TrimPrefix(srv.URL, "http://"), "")
+	c.Scheme = "http"
+	for i := 0; i < 2; i++ {
+		r, err := c.Do(context.Background(), http.MethodGet, "/v2/team/app/tags/list", "repository:team/app:pull,push", nil, nil)
+		assert.Equal(t, err, nil)
+		r.Body.Close()
+		assert.Equal(t, r.StatusCode, http.StatusOK)
+	}
+}
@@ -0,0 +1,356 @@
+// Package registrytest provides an in-memory registry implementing enough of
+// the OCI distribution API to exercise picture-book without a real registry.
+package registrytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	mutex "sync"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+)
+
+type manifest struct {
+	mediaType string
+	body      []byte
+}
+
+// Server is an in-memory registry. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+	// Host is the host:port of the server, as used in image references
+	Host string
+	// Referrers toggles support for the referrers API
+	Referrers bool
+	// PageSize limits the number of tags and repositories returned per page, when set
+	PageSize int
+	// Username and Password enable basic authentication when set
+	Username string
+	Password string
+
+	mu        mutex.Mutex
+	blobs     map[string][]byte
+	links     map[string]map[string]bool     // repo -> digests of the blobs it holds
+	manifests map[string]map[string]manifest // repo -> digest -> manifest
+	tags      map[string]map[string]string   // repo -> tag -> digest
+	uploads   int
+	// Requests counts requests by method and path, e.g. "GET /v2/_catalog"
+	Requests map[string]int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		Referrers: true,
+		blobs:     make(map[string][]byte),
+		links:     make(map[string]map[string]bool),
+		manifests: make(map[string]map[string]manifest),
+		tags:      make(map[string]map[string]string),
+		Requests:  make(map[string]int),
+	}
+	s.Server = httptest.NewServer(s)
+	s.Host = strings.TrimPrefix(s.Server.URL, "http://")
+	return s
+}
+
+// Client returns a registry client for the server.
+func (s *Server) Client(auth string) *registry.Client {
+	c := registry.NewClient(s.Host, auth)
+	c.Scheme = "http"
+	return c
+}
+
+// PushImage stores an image made of the given layers under repo:tag, returning its manifest descriptor.
+func (s *Server) PushImage(repo, tag string, layers ...string) registry.Descriptor {
+	config := []byte(fmt.Sprintf(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"},"repo":%q,"tag":%q}`, repo, tag))
+	m := registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIManifest,
+		Config:        &registry.Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: s.PutBlob(config), Size: int64(len(config))},
+	}
+	for _, l := range layers {
+		m.Layers = append(m.Layers, registry.Descriptor{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: s.PutBlob([]byte(l)), Size: int64(len(l))})
+	}
+	return s.PutManifest(repo, tag, m)
+}
+
+// PutManifest stores m under repo, tagging it if tag is not empty. The blobs m references, which must have been
+// stored with PutBlob, are added to repo.
+func (s *Server) PutManifest(repo, tag string, m registry.Manifest) registry.Descriptor {
+	b, _ := json.Marshal(m)
+	d := registry.Descriptor{MediaType: m.MediaType, Digest: registry.Digest(b), Size: int64(len(b)), ArtifactType: m.ArtifactType}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.storeManifest(repo, tag, d.Digest, manifest{mediaType: m.MediaType, body: b})
+	return d
+}
+
+// PutBlob stores b, which only repositories whose manifests reference it hold, like blobs pushed to a real registry.
+func (s *Server) PutBlob(b []byte) string {
+	d := registry.Digest(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[d] = b
+	return d
+}
+
+// HasManifest reports if repo holds reference, which is a tag or digest.
+func (s *Server) HasManifest(repo, reference string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.lookup(repo, reference)
+	return ok
+}
+
+// Tags returns the tags of repo, sorted.
+func (s *Server) Tags(repo string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tags []string
+	for t := range s.tags[repo] {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Uploads is the number of blobs pushed to the server through the API.
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploads
+}
+
+func (s *Server) storeManifest(repo, tag, digest string, m manifest) {
+	if s.manifests[repo] == nil {
+		s.manifests[repo] = make(map[string]manifest)
+		s.tags[repo] = make(map[string]string)
+	}
+	if parsed, err := registry.ParseManifest(m.body); err == nil {
+		for _, blob := range parsed.Blobs() {
+			s.link(repo, blob.Digest)
+		}
+	}
+	s.manifests[repo][digest] = m
+	if tag != "" {
+		s.tags[repo][tag] = digest
+	}
+}
+
+// link adds the blob digest to repo.
+func (s *Server) link(repo, digest string) {
+	if s.links[repo] == nil {
+		s.links[repo] = make(map[string]bool)
+	}
+	s.links[repo][digest] = true
+}
+
+func (s *Server) lookup(repo, reference string) (manifest, bool) {
+	digest := reference
+	if !strings.Contains(reference, ":") {
+		digest = s.tags[repo][reference]
+	}
+	m, ok := s.manifests[repo][digest]
+	return m, ok
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Requests[r.Method+" "+r.URL.Path]++
+
+	if s.Username != "" {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != s.Username || pass != s.Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registrytest"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	switch {
+	case r.URL.Path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case path == "_catalog":
+		var repos []string
+		for repo := range s.manifests {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+		s.paginate(w, r, "repositories", repos)
+	case strings.HasSuffix(path, "/tags/list"):
+		repo := strings.TrimSuffix(path, "/tags/list")
+		if _, ok := s.tags[repo]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var tags []string
+		for t := range s.tags[repo] {
+			tags = append(tags, t)
+		}
+		sort.Strings(tags)
+		s.paginate(w, r, "tags", tags)
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		s.serveManifest(w, r, path[:i], path[i+len("/manifests/"):])
+	case strings.Contains(path, "/blobs/uploads/"):
+		s.serveUpload(w, r, path[:strings.Index(path, "/blobs/uploads/")])
+	case strings.Contains(path, "/blobs/"):
+		digest := path[strings.LastIndex(path, "/")+1:]
+		b, ok := s.blobs[digest]
+		if !ok || !s.links[path[:strings.Index(path, "/blobs/")]][digest] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(b)
+		}
+	case strings.Contains(path, "/referrers/") && s.Referrers:
+		i := strings.LastIndex(path, "/referrers/")
+		s.serveReferrers(w, path[:i], path[i+len("/referrers/"):])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *Server) paginate(w http.ResponseWriter, r *http.Request, key string, items []string) {
+	if last := r.URL.Query().Get("last"); last != "" {
+		i := sort.SearchStrings(items, last)
+		if i < len(items) && items[i] == last {
+			i++
+		}
+		items = items[i:]
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil {
+		n = s.PageSize
+	}
+	if n > 0 && n < len(items) {
+		items = items[:n]
+		w.Header().Set("Link", fmt.Sprintf(`<%s?n=%d&last=%s>; rel="next"`, r.URL.Path, n, items[len(items)-1]))
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{key: items})
+}
+
+func (s *Server) serveManifest(w http.ResponseWriter, r *http.Request, repo, reference string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		m, ok := s.lookup(repo, reference)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", registry.Digest(m.body))
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.body)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(m.body)
+		}
+	case http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		parsed, err := registry.ParseManifest(b)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, blob := range parsed.Blobs() {
+			if !s.links[repo][blob.Digest] {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "blob unknown %s", blob.Digest)
+				return
+			}
+		}
+		for _, child := range parsed.Manifests {
+			if _, ok := s.manifests[repo][child.Digest]; !ok && registry.IsIndex(r.Header.Get("Content-Type")) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "manifest unknown %s", child.Digest)
+				return
+			}
+		}
+		digest := registry.Digest(b)
+		tag := ""
+		if !strings.Contains(reference, ":") {
+			tag = reference
+		}
+		s.storeManifest(repo, tag, digest, manifest{mediaType: r.Header.Get("Content-Type"), body: b})
+		if parsed.Subject != nil && s.Referrers {
+			w.Header().Set("OCI-Subject", parsed.Subject.Digest)
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if !strings.Contains(reference, ":") {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := s.manifests[repo][reference]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.manifests[repo], reference)
+		for tag, digest := range s.tags[repo] {
+			if digest == reference {
+				delete(s.tags[repo], tag)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, repo string) {
+	switch r.Method {
+	case http.MethodPost:
+		// blobs are mounted from another repository when it holds them, otherwise an upload is started
+		if digest, from := r.URL.Query().Get("mount"), r.URL.Query().Get("from"); digest != "" && s.links[from][digest] {
+			s.link(repo, digest)
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, digest))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d", repo, len(s.blobs)))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		digest := r.URL.Query().Get("digest")
+		if registry.Digest(b) != digest {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "digest invalid")
+			return
+		}
+		s.blobs[digest] = b
+		s.link(repo, digest)
+		s.uploads++
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) serveReferrers(w http.ResponseWriter, repo, digest string) {
+	index := registry.Manifest{SchemaVersion: 2, MediaType: registry.MediaTypeOCIIndex, Manifests: []registry.Descriptor{}}
+	for d, m := range s.manifests[repo] {
+		parsed, err := registry.ParseManifest(m.body)
+		if err != nil || parsed.Subject == nil || parsed.Subject.Digest != digest {
+			continue
+		}
+		index.Manifests = append(index.Manifests, registry.Descriptor{
+			MediaType:    m.mediaType,
+			Digest:       d,
+			Size:         int64(len(m.body)),
+			ArtifactType: parsed.ArtifactType,
+		})
+	}
+	w.Header().Set("Content-Type", registry.MediaTypeOCIIndex)
+	json.NewEncoder(w).Encode(index)
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"fmt"
+	"time"
+)
+
+type ImageStatus string
+
+const (
+	ImagePushed  ImageStatus = "pushed"
+	ImageSkipped ImageStatus = "skipped"
+	ImageFailed  ImageStatus = "failed"
+	// ImageRejected images were not mirrored because they did not pass a check, such as signature verification
+	ImageRejected ImageStatus = "rejected"
+	// ImagePruned images were deleted from the registry after dropping out of the syncer scripts output
+	ImagePruned ImageStatus = "pruned"
+	// ImageStale images would have been pruned, if pruning was not a dry run
+	ImageStale ImageStatus = "stale"
+	// ImageUnchanged images were listed by the previous run and already mirrored, so the registries were not checked
+	ImageUnchanged ImageStatus = "unchanged"
+)
+
+// ImageReport describes what happened to a single image during a sync run.
+type ImageReport struct {
+	Image  string
+	Target string
+	Status ImageStatus
+	Error  string
+	// Digest is the digest of the pushed image, when known
+	Digest string `json:",omitempty"`
+	// Artifacts lists the signatures, attestations, and other referrers copied with the image
+	Artifacts []string `json:",omitempty"`
+	// Gates are the results of the checks the image had to pass before being mirrored
+	Gates []GateResult `json:",omitempty"`
+}
+
+// GateResult is the outcome of a single gate, such as signature verification or a vulnerability scan, for an image.
+type GateResult struct {
+	Gate    string
+	Passed  bool
+	Message string
+	// Findings counts what the gate found, e.g. vulnerabilities by severity
+	Findings map[string]int `json:",omitempty"`
+}
+
+// HookResult is the outcome of a hook run during a sync run.
+type HookResult struct {
+	Hook string
+	// Image and Target are set for the hooks run for a single image
+	Image  string `json:",omitempty"`
+	Target string `json:",omitempty"`
+	// Output is what the hook wrote to standard output and error
+	Output string
+	Error  string `json:",omitempty"`
+}
+
+// RunReport describes the outcome of a single Syncer.Process execution.
+type RunReport struct {
+	ID       string
+	Registry string
+	// Job is the name of the synchronization job, which differs from Registry when several jobs target it
+	Job      string
+	Started  time.Time
+	Finished time.Time
+	Canceled bool
+	// Trigger is webhook for runs synchronizing the images a registry reported pushed, empty for scheduled runs
+	Trigger string
+	// Reconcile is set for the runs of jobs with a reconcile period which checked every image against the
+	// registries, rather than skipping the images which were unchanged since the previous run
+	Reconcile bool `json:",omitempty"`
+	// Added and Removed are the images the image sources started and stopped listing since the previous run
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+	// Hooks are the results of the hooks run, in order
+	Hooks []HookResult `json:",omitempty"`
+	// Error is set when the run could not be completed at all, e.g. the syncer script failed.
+	Error  string
+	Images []ImageReport
+}
+
+func NewRunReport(registry string) *RunReport {
+	now := time.Now()
+	return &RunReport{
+		ID:       fmt.Sprintf("%s-%d", registry, now.UnixNano()),
+		Registry: registry,
+		Started:  now,
+	}
+}
+
+// Add records the result of processing an image. err may be nil. The returned
+// ImageReport may be used to add details, until the next call to Add.
+func (r *RunReport) Add(image, target string, status ImageStatus, err error) *ImageReport {
+	ir := ImageReport{
+		Image:  image,
+		Target: target,
+		Status: status,
+	}
+	if err != nil {
+		ir.Error = err.Error()
+	}
+	r.Images = append(r.Images, ir)
+	return &r.Images[len(r.Images)-1]
+}
+
+func (r *RunReport) Count(status ImageStatus) int {
+	n := 0
+	for _, i := range r.Images {
+		if i.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed reports if the run, or any image within it, failed.
+func (r *RunReport) Failed() bool {
+	return r.Error != "" || r.Count(ImageFailed) > 0
+}
+
+// Progress is a snapshot of what a Syncer is currently doing.
+type Progress struct {
+	Running bool
+	RunID   string
+	Image   string
+	Stage   string
+	// Index is the position of Image within the current image list, starting at 1.
+	Index   int
+	Total   int
+	Started time.Time
+}
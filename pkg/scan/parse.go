@@ -0,0 +1,198 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Severities in increasing order.
+var Severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func severityRank(s string) int {
+	s = strings.ToUpper(s)
+	for i, sev := range Severities {
+		if sev == s {
+			return i
+		}
+	}
+	if s == "NEGLIGIBLE" {
+		return 1
+	}
+	return 0
+}
+
+// Vulnerability is a single finding of a scanner.
+type Vulnerability struct {
+	ID       string
+	Severity string
+	Package  string
+	// Fixed reports if a fixed version of the package is available
+	Fixed bool
+}
+
+// Parse reads a scan report in one of the supported formats: trivy JSON, grype JSON,
+// or SARIF. An empty format detects the format from the document.
+func Parse(format string, b []byte) ([]Vulnerability, error) {
+	if format == "" {
+		format = detect(b)
+	}
+	switch format {
+	case "trivy":
+		return parseTrivy(b)
+	case "grype":
+		return parseGrype(b)
+	case "sarif":
+		return parseSARIF(b)
+	default:
+		return nil, fmt.Errorf("unknown scan report format %q, expected trivy, grype, or sarif", format)
+	}
+}
+
+func detect(b []byte) string {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return ""
+	}
+	switch {
+	case probe["runs"] != nil:
+		return "sarif"
+	case probe["matches"] != nil:
+		return "grype"
+	case probe["Results"] != nil || probe["SchemaVersion"] != nil:
+		return "trivy"
+	}
+	return ""
+}
+
+func parseTrivy(b []byte) ([]Vulnerability, error) {
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID string
+				PkgName         string
+				FixedVersion    string
+				Severity        string
+			}
+		}
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		return nil, fmt.Errorf("could not parse trivy report: %w", err)
+	}
+	var vulns []Vulnerability
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			vulns = append(vulns, Vulnerability{
+				ID:       v.VulnerabilityID,
+				Severity: strings.ToUpper(v.Severity),
+				Package:  v.PkgName,
+				Fixed:    v.FixedVersion != "",
+			})
+		}
+	}
+	return vulns, nil
+}
+
+func parseGrype(b []byte) ([]Vulnerability, error) {
+	var report struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID       string `json:"id"`
+				Severity string `json:"severity"`
+				Fix      struct {
+					State string `json:"state"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name string `json:"name"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		return nil, fmt.Errorf("could not parse grype report: %w", err)
+	}
+	var vulns []Vulnerability
+	for _, m := range report.Matches {
+		vulns = append(vulns, Vulnerability{
+			ID:       m.Vulnerability.ID,
+			Severity: strings.ToUpper(m.Vulnerability.Severity),
+			Package:  m.Artifact.Name,
+			Fixed:    m.Vulnerability.Fix.State == "fixed",
+		})
+	}
+	return vulns, nil
+}
+
+// parseSARIF maps results to severities using the security-severity (CVSS) score scanners
+// attach to rules, falling back to the result level when a score is not available.
+func parseSARIF(b []byte) ([]Vulnerability, error) {
+	type properties struct {
+		SecuritySeverity string `json:"security-severity"`
+	}
+	var report struct {
+		Runs []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID         string     `json:"id"`
+						Properties properties `json:"properties"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID     string     `json:"ruleId"`
+				Level      string     `json:"level"`
+				Properties properties `json:"properties"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		return nil, fmt.Errorf("could not parse SARIF report: %w", err)
+	}
+
+	var vulns []Vulnerability
+	for _, run := range report.Runs {
+		scores := make(map[string]string)
+		for _, rule := range run.Tool.Driver.Rules {
+			scores[rule.ID] = rule.Properties.SecuritySeverity
+		}
+		for _, r := range run.Results {
+			score := r.Properties.SecuritySeverity
+			if score == "" {
+				score = scores[r.RuleID]
+			}
+			vulns = append(vulns, Vulnerability{
+				ID:       r.RuleID,
+				Severity: sarifSeverity(score, r.Level),
+				// SARIF does not describe fixes, so every finding is treated as fixable
+				Fixed: true,
+			})
+		}
+	}
+	return vulns, nil
+}
+
+func sarifSeverity(score, level string) string {
+	if s, err := strconv.ParseFloat(score, 64); err == nil {
+		switch {
+		case s >= 9:
+			return "CRITICAL"
+		case s >= 7:
+			return "HIGH"
+		case s >= 4:
+			return "MEDIUM"
+		case s > 0:
+			return "LOW"
+		}
+	}
+	switch level {
+	case "error":
+		return "HIGH"
+	case "warning":
+		return "MEDIUM"
+	case "note":
+		return "LOW"
+	}
+	return "UNKNOWN"
+}
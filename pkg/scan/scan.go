@@ -0,0 +1,180 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+const (
+	defaultTimeout   = 10 * time.Minute
+	maxViolations    = 10
+	imagePlaceholder = "{image}"
+)
+
+// Result summarizes a scan of a single image.
+type Result struct {
+	// Counts is the number of vulnerabilities found for each severity
+	Counts map[string]int
+	// Violations are the vulnerabilities at or above the severity threshold
+	Violations []Vulnerability
+}
+
+func (r Result) Passed() bool {
+	return len(r.Violations) == 0
+}
+
+// Summary describes the result, listing the first few violations.
+func (r Result) Summary(threshold string) string {
+	if r.Passed() {
+		return fmt.Sprintf("no vulnerabilities at or above %s", threshold)
+	}
+	var ids []string
+	for i, v := range r.Violations {
+		if i == maxViolations {
+			ids = append(ids, fmt.Sprintf("and %d more", len(r.Violations)-maxViolations))
+			break
+		}
+		ids = append(ids, fmt.Sprintf("%s (%s %s)", v.ID, v.Severity, v.Package))
+	}
+	return fmt.Sprintf("%d vulnerabilities at or above %s: %s", len(r.Violations), threshold, strings.Join(ids, ", "))
+}
+
+type runFunc func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+func execRun(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// scanners may exit non-zero when they find vulnerabilities, the report is still usable
+		if stdout.Len() > 0 {
+			return stdout.Bytes(), nil
+		}
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Scanner runs a vulnerability scanner, or reads a pre-generated report,
+// and enforces a severity threshold.
+type Scanner struct {
+	conf      pkg.ScanConfig
+	threshold string
+	block     bool
+	timeout   time.Duration
+	run       runFunc
+}
+
+// New builds a Scanner for the registries configuration. A nil Scanner
+// is returned when scanning is disabled.
+func New(conf pkg.ScanConfig) (*Scanner, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+	s := &Scanner{
+		conf:      conf,
+		threshold: strings.ToUpper(conf.Severity),
+		timeout:   defaultTimeout,
+		run:       execRun,
+	}
+	if s.threshold == "" {
+		s.threshold = "CRITICAL"
+	}
+	if severityRank(s.threshold) == 0 && s.threshold != "UNKNOWN" {
+		return nil, fmt.Errorf("invalid scan.severity %q, expected one of %v", conf.Severity, Severities)
+	}
+	if conf.Command == "" && conf.Report == "" {
+		return nil, fmt.Errorf("scanning requires either a command or a report")
+	}
+	switch conf.Format {
+	case "", "trivy", "grype", "sarif":
+	default:
+		return nil, fmt.Errorf("invalid scan.format %q, expected trivy, grype, or sarif", conf.Format)
+	}
+	switch conf.OnFailure {
+	case "", "skip":
+	case "block":
+		s.block = true
+	default:
+		return nil, fmt.Errorf("invalid scan.onFailure %q, expected skip or block", conf.OnFailure)
+	}
+	if conf.Timeout != "" {
+		d, err := time.ParseDuration(conf.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scan.timeout: %w", err)
+		}
+		s.timeout = d
+	}
+	return s, nil
+}
+
+// Threshold is the lowest severity which fails a scan.
+func (s *Scanner) Threshold() string {
+	return s.threshold
+}
+
+// Blocks reports if a failed scan should stop the synchronization entirely.
+func (s *Scanner) Blocks() bool {
+	return s.block
+}
+
+// Scan scans image and evaluates the findings against the severity threshold.
+func (s *Scanner) Scan(ctx context.Context, image string) (Result, error) {
+	var out []byte
+	var err error
+	if s.conf.Report != "" {
+		path := strings.ReplaceAll(s.conf.Report, imagePlaceholder, ReportName(image))
+		out, err = os.ReadFile(path)
+		if err != nil {
+			return Result{}, fmt.Errorf("could not read scan report: %w", err)
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+		var args []string
+		for _, a := range strings.Fields(s.conf.Args) {
+			args = append(args, strings.ReplaceAll(a, imagePlaceholder, image))
+		}
+		out, err = s.run(ctx, s.conf.Command, args...)
+		if err != nil {
+			if ctx.Err() != nil {
+				return Result{}, fmt.Errorf("scanner did not complete: %w", ctx.Err())
+			}
+			return Result{}, fmt.Errorf("scanner failed: %w", err)
+		}
+	}
+
+	vulns, err := Parse(s.conf.Format, out)
+	if err != nil {
+		return Result{}, err
+	}
+	return s.evaluate(vulns), nil
+}
+
+func (s *Scanner) evaluate(vulns []Vulnerability) Result {
+	result := Result{Counts: make(map[string]int)}
+	threshold := severityRank(s.threshold)
+	for _, v := range vulns {
+		result.Counts[v.Severity]++
+		if s.conf.IgnoreUnfixed && !v.Fixed {
+			continue
+		}
+		if severityRank(v.Severity) >= threshold {
+			result.Violations = append(result.Violations, v)
+		}
+	}
+	return result
+}
+
+// ReportName converts an image into the name used to find pre-generated reports.
+func ReportName(image string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(image)
+}
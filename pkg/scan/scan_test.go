@@ -0,0 +1,121 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/magiconair/properties/assert"
+)
+
+const trivyReport = `{
+  "SchemaVersion": 2,
+  "Results": [{
+    "Target": "nginx:1.23 (debian 11.6)",
+    "Vulnerabilities": [
+      {"VulnerabilityID": "CVE-2023-0001", "PkgName": "openssl", "FixedVersion": "1.1.1n-0+deb11u4", "Severity": "CRITICAL"},
+      {"VulnerabilityID": "CVE-2023-0002", "PkgName": "zlib", "Severity": "HIGH"},
+      {"VulnerabilityID": "CVE-2023-0003", "PkgName": "curl", "FixedVersion": "7.74.0-1.3+deb11u7", "Severity": "LOW"}
+    ]
+  }]
+}`
+
+const grypeReport = `{
+  "matches": [
+    {"vulnerability": {"id": "CVE-2023-0004", "severity": "Medium", "fix": {"state": "fixed"}}, "artifact": {"name": "libc6"}},
+    {"vulnerability": {"id": "CVE-2023-0005", "severity": "Negligible", "fix": {"state": "not-fixed"}}, "artifact": {"name": "tar"}}
+  ]
+}`
+
+const sarifReport = `{
+  "runs": [{
+    "tool": {"driver": {"rules": [{"id": "CVE-2023-0006", "properties": {"security-severity": "9.8"}}]}},
+    "results": [
+      {"ruleId": "CVE-2023-0006", "level": "error"},
+      {"ruleId": "CVE-2023-0007", "level": "warning"}
+    ]
+  }]
+}`
+
+func TestParse(t *testing.T) {
+	vulns, err := Parse("", []byte(trivyReport))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, vulns, []Vulnerability{
+		{ID: "CVE-2023-0001", Severity: "CRITICAL", Package: "openssl", Fixed: true},
+		{ID: "CVE-2023-0002", Severity: "HIGH", Package: "zlib"},
+		{ID: "CVE-2023-0003", Severity: "LOW", Package: "curl", Fixed: true},
+	})
+
+	vulns, err = Parse("", []byte(grypeReport))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, vulns, []Vulnerability{
+		{ID: "CVE-2023-0004", Severity: "MEDIUM", Package: "libc6", Fixed: true},
+		{ID: "CVE-2023-0005", Severity: "NEGLIGIBLE", Package: "tar"},
+	})
+
+	vulns, err = Parse("sarif", []byte(sarifReport))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, vulns, []Vulnerability{
+		{ID: "CVE-2023-0006", Severity: "CRITICAL", Fixed: true},
+		{ID: "CVE-2023-0007", Severity: "MEDIUM", Fixed: true},
+	})
+
+	_, err = Parse("", []byte(`{"unrelated": true}`))
+	assert.Equal(t, err != nil, true)
+}
+
+func TestScanWithCommand(t *testing.T) {
+	s, err := New(pkg.ScanConfig{Enabled: true, Command: "trivy", Args: "image --format json {image}", Severity: "high"})
+	assert.Equal(t, err, nil)
+	var called string
+	s.run = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		called = name + " " + strings.Join(args, " ")
+		return []byte(trivyReport), nil
+	}
+
+	result, err := s.Scan(context.Background(), "nginx:1.23")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, called, "trivy image --format json nginx:1.23")
+	assert.Equal(t, result.Passed(), false)
+	assert.Equal(t, len(result.Violations), 2)
+	assert.Equal(t, result.Counts, map[string]int{"CRITICAL": 1, "HIGH": 1, "LOW": 1})
+	assert.Equal(t, result.Summary(s.Threshold()), "2 vulnerabilities at or above HIGH: CVE-2023-0001 (CRITICAL openssl), CVE-2023-0002 (HIGH zlib)")
+
+	// the unfixed HIGH vulnerability no longer counts against the threshold
+	s.conf.IgnoreUnfixed = true
+	result, err = s.Scan(context.Background(), "nginx:1.23")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(result.Violations), 1)
+}
+
+func TestScanWithReport(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "rancher_shell_v0.1.19.json"), []byte(grypeReport), 0644)
+
+	s, err := New(pkg.ScanConfig{Enabled: true, Report: filepath.Join(dir, "{image}.json"), OnFailure: "block"})
+	assert.Equal(t, err, nil)
+	result, err := s.Scan(context.Background(), "rancher/shell:v0.1.19")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Passed(), true)
+	assert.Equal(t, result.Summary(s.Threshold()), "no vulnerabilities at or above CRITICAL")
+	assert.Equal(t, s.Blocks(), true)
+
+	_, err = s.Scan(context.Background(), "rancher/shell:v0.1.20")
+	assert.Equal(t, err != nil, true)
+}
+
+func TestNewDisabledOrInvalid(t *testing.T) {
+	s, err := New(pkg.ScanConfig{})
+	assert.Equal(t, s == nil, true)
+	assert.Equal(t, err, nil)
+
+	_, err = New(pkg.ScanConfig{Enabled: true})
+	assert.Equal(t, err != nil, true)
+	_, err = New(pkg.ScanConfig{Enabled: true, Command: "trivy", Severity: "severe"})
+	assert.Equal(t, err != nil, true)
+	_, err = New(pkg.ScanConfig{Enabled: true, Command: "trivy", OnFailure: "ignore"})
+	assert.Equal(t, err != nil, true)
+}
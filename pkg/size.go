@@ -0,0 +1,15 @@
+package pkg
+
+import (
+	"strings"
+
+	"github.com/docker/go-units"
+)
+
+// ParseSize parses a human readable size, accepting decimal (MB) and binary (MiB) units.
+func ParseSize(s string) (int64, error) {
+	if strings.Contains(strings.ToLower(s), "i") {
+		return units.RAMInBytes(s)
+	}
+	return units.FromHumanSize(s)
+}
@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	mutex "sync"
+)
+
+// ImageSource lists the images a job synchronizes.
+type ImageSource interface {
+	// Name describes the source in logs and run reports, e.g. 'syncer script images.sh'
+	Name() string
+	// Images lists the images found by the source, each of which includes its tag or digest
+	Images(ctx context.Context) ([]string, error)
+}
+
+// Renamer is implemented by sources whose images are mirrored under another name than the one they are listed as,
+// e.g. the catalog provider leaves out the source registry. Rename returns the name image is retagged from, and
+// false when image wasn't listed by the source.
+type Renamer interface {
+	Rename(image string) (string, bool)
+}
+
+// SourceConfig is a single entry of the sources of a registry. Type selects the provider,
+// which only reads the fields documented for it.
+type SourceConfig struct {
+	// Type is the provider listing the images: script, static, file, compose, dockerfile, http, catalog, kubernetes, or helm
+	Type string `yaml:"type"`
+	// Script is the executable run by the script provider, with the arguments in Args
+	Script string `yaml:"script"`
+	Args   string `yaml:"args"`
+	// Images are listed as is by the static provider
+	Images []string `yaml:"images"`
+	// URL is read by the file, compose, dockerfile, and http providers. Paths and file:// URLs are read from disk
+	URL string `yaml:"url"`
+	// Headers are sent with the requests of providers reading http(s) URLs, e.g. for authorization
+	Headers map[string]string `yaml:"headers" json:"-"`
+	// Field is the dot separated path of the list of images in the JSON read by the http provider, the document itself when empty
+	Field string `yaml:"field"`
+	// Catalog configures the catalog provider
+	Catalog *CatalogConfig `yaml:"catalog"`
+	// Kubernetes configures the kubernetes provider
+	Kubernetes *KubernetesConfig `yaml:"kubernetes"`
+	// Helm configures the helm provider
+	Helm *HelmConfig `yaml:"helm"`
+}
+
+// SourceFactory builds the ImageSource of conf, an entry of the sources of registry.
+// Invalid configurations are reported as errors.
+type SourceFactory func(conf SourceConfig, registry Registry) (ImageSource, error)
+
+var (
+	sourcesMu mutex.RWMutex
+	sources   = make(map[string]SourceFactory)
+)
+
+// RegisterSource makes a provider available under the given type, which
+// can then be selected using the sources of a registry in config.yaml.
+func RegisterSource(typ string, f SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[typ] = f
+}
+
+// NewSource builds the ImageSource of conf using the provider registered under its type.
+func NewSource(conf SourceConfig, registry Registry) (ImageSource, error) {
+	sourcesMu.RLock()
+	f, ok := sources[conf.Type]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown image source %q, valid sources are %v", conf.Type, sourceTypes())
+	}
+	s, err := f(conf, registry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s source: %w", conf.Type, err)
+	}
+	return s, nil
+}
+
+// NewSources builds every image source of registry.
+func NewSources(registry Registry) ([]ImageSource, error) {
+	confs := registry.ImageSources()
+	if len(confs) == 0 {
+		return nil, errors.New("no image sources are configured, set syncerScript or sources")
+	}
+	var built []ImageSource
+	for _, conf := range confs {
+		s, err := NewSource(conf, registry)
+		if err != nil {
+			return nil, err
+		}
+		built = append(built, s)
+	}
+	return built, nil
+}
+
+func sourceTypes() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	var n []string
+	for typ := range sources {
+		n = append(n, typ)
+	}
+	sort.Strings(n)
+	return n
+}
+
+// ListImages merges the images of every source, each image once and in the order it was first
+// listed. The images of a partial list can't be told apart from dropped ones, so any failing
+// source fails the whole list.
+func ListImages(ctx context.Context, imageSources []ImageSource) ([]string, error) {
+	seen := make(map[string]bool)
+	var images []string
+	for _, s := range imageSources {
+		listed, err := s.Images(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s failed: %w", s.Name(), err)
+		}
+		for _, image := range listed {
+			image = strings.TrimSpace(image)
+			if image == "" || seen[image] {
+				continue
+			}
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
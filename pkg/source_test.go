@@ -0,0 +1,94 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+)
+
+func listSources(t *testing.T, confs ...SourceConfig) ([]string, error) {
+	sources, err := NewSources(Registry{Hostname: "my-registry.space", Sources: confs})
+	assert.Equal(t, err, nil)
+	return ListImages(context.Background(), sources)
+}
+
+func TestSources(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "images.txt")
+	assert.Equal(t, os.WriteFile(list, []byte("# rancher images\nrancher/shell:v0.1.19\n\nnginx:1.25\n"), 0644), nil)
+	compose := filepath.Join(dir, "docker-compose.yaml")
+	assert.Equal(t, os.WriteFile(compose, []byte(`services:
+  web:
+    image: nginx:1.25
+  db:
+    image: postgres:16
+  app:
+    build: .
+  api:
+    image: ${REGISTRY}/api:${TAG}
+`), 0644), nil)
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	assert.Equal(t, os.WriteFile(dockerfile, []byte(`ARG GO_VERSION=1.21
+FROM --platform=$BUILDPLATFORM golang:${GO_VERSION} AS build
+FROM golang:1.21-alpine AS Builder
+FROM builder AS test
+from gcr.io/distroless/static:nonroot
+FROM scratch
+`), 0644), nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data": {"images": ["redis:7", {"image": "nginx:1.25", "digest": "sha256:0123"}]}}`))
+	}))
+	defer server.Close()
+
+	images, err := listSources(t,
+		SourceConfig{Type: "static", Images: []string{"busybox:1.36", "nginx:1.25"}},
+		SourceConfig{Type: "file", URL: "file://" + list},
+		SourceConfig{Type: "compose", URL: compose},
+		SourceConfig{Type: "dockerfile", URL: dockerfile},
+		SourceConfig{Type: "http", URL: server.URL, Field: "data.images", Headers: map[string]string{"Authorization": "Bearer token"}},
+	)
+	assert.Equal(t, err, nil)
+	// images are merged in the order they were first listed
+	assert.Equal(t, images, []string{
+		"busybox:1.36",
+		"nginx:1.25",
+		"rancher/shell:v0.1.19",
+		"postgres:16",
+		"golang:1.21-alpine",
+		"gcr.io/distroless/static:nonroot",
+		"redis:7",
+	})
+
+	// a failing source fails the whole list
+	_, err = listSources(t,
+		SourceConfig{Type: "static", Images: []string{"busybox:1.36"}},
+		SourceConfig{Type: "http", URL: server.URL},
+	)
+	assert.Equal(t, err != nil, true)
+}
+
+func TestSourcesConfig(t *testing.T) {
+	for _, conf := range []SourceConfig{
+		{Type: "ftp", URL: "ftp://images.txt"},
+		{Type: "script"},
+		{Type: "static"},
+		{Type: "compose"},
+	} {
+		_, err := NewSource(conf, Registry{})
+		assert.Equal(t, err != nil, true, conf.Type)
+	}
+
+	// the syncer script is a source of its own
+	confs := Registry{SyncerScript: "images.sh", SyncerScriptArgs: "v2.7", Sources: []SourceConfig{{Type: "static"}}}.ImageSources()
+	assert.Equal(t, confs, []SourceConfig{{Type: "script", Script: "images.sh", Args: "v2.7"}, {Type: "static"}})
+}
@@ -0,0 +1,140 @@
+// Package state persists what picture-book has done to each registry across runs and restarts.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	mutex "sync"
+	"time"
+)
+
+// DefaultDir holds the state of every registry, unless state.dir is configured.
+const DefaultDir = ".picture-book"
+
+// Image is an image picture-book mirrored into a registry.
+type Image struct {
+	// Source is the image as listed by the syncer script
+	Source string
+	// LastListed is the last time the syncer script listed the image
+	LastListed time.Time
+	// StaleSince is set when the image is no longer listed by the syncer script
+	StaleSince time.Time `json:",omitempty"`
+	// Digest is the digest of the image when it was last pushed, when known
+	Digest string `json:",omitempty"`
+	// SourceDigest is the digest Source had when the image was last mirrored, when known
+	SourceDigest string `json:",omitempty"`
+}
+
+// LocalImage is an image picture-book pulled into the local docker storage.
+type LocalImage struct {
+	ID   string
+	Size int64
+	// References are the tags picture-book created, i.e. the image it pulled and its retagged name
+	References []string
+	// LastSynced is the last time the image was pulled
+	LastSynced time.Time
+}
+
+// Registry is the state of a single registry. It is safe for concurrent use.
+type Registry struct {
+	// Images are keyed by their reference on the target registry
+	Images map[string]*Image
+	// Local are the images picture-book pulled and still holds, keyed by the pulled image
+	Local map[string]*LocalImage `json:",omitempty"`
+	// Listed are the images listed by the image sources during the last run
+	Listed []string `json:",omitempty"`
+	// LastReconcile is the last time a run checked every listed image against the registries
+	LastReconcile time.Time `json:",omitempty"`
+
+	path string
+	mu   mutex.Mutex
+}
+
+// Load reads the state of hostname from dir. A missing state file yields an empty state.
+func Load(dir, hostname string) (*Registry, error) {
+	if dir == "" {
+		dir = DefaultDir
+	}
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(hostname) + ".json"
+	r := &Registry{
+		Images: make(map[string]*Image),
+		Local:  make(map[string]*LocalImage),
+		path:   filepath.Join(dir, name),
+	}
+	b, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("could not parse state %s: %w", r.path, err)
+	}
+	if r.Images == nil {
+		r.Images = make(map[string]*Image)
+	}
+	if r.Local == nil {
+		r.Local = make(map[string]*LocalImage)
+	}
+	return r, nil
+}
+
+// Update runs f while holding the state lock.
+func (r *Registry) Update(f func(images map[string]*Image)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(r.Images)
+}
+
+// UpdateLocal runs f on the images held locally while holding the state lock.
+func (r *Registry) UpdateLocal(f func(local map[string]*LocalImage)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(r.Local)
+}
+
+// SetListed records the images listed by the image sources during a run, returning those of the previous run.
+func (r *Registry) SetListed(images []string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous := r.Listed
+	r.Listed = images
+	return previous
+}
+
+// Reconciled returns the last time a run checked every listed image against the registries.
+func (r *Registry) Reconciled() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.LastReconcile
+}
+
+// SetReconciled records that a run checked every listed image against the registries.
+func (r *Registry) SetReconciled(t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.LastReconcile = t
+}
+
+// Save writes the state to disk, replacing the previous state atomically.
+func (r *Registry) Save() error {
+	r.mu.Lock()
+	b, err := json.MarshalIndent(r, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"fmt"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/ratelimit"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+)
+
+// registryClient returns a cached registry.Client for host and auth, so tokens
+// are reused across the images of a run.
+func (d *Syncer) registryClient(host, auth string) *registry.Client {
+	d.clientsMu.Lock()
+	defer d.clientsMu.Unlock()
+	if d.clients == nil {
+		d.clients = make(map[string]*registry.Client)
+	}
+	key := host + "\x00" + auth
+	c, ok := d.clients[key]
+	if !ok {
+		c = RegistryClients(auth)(host)
+		d.clients[key] = c
+	}
+	return c
+}
+
+// RegistryClients returns a function creating registry clients authenticated with auth,
+// whose requests are subject to the rate limits of the registry.
+func RegistryClients(auth string) func(host string) *registry.Client {
+	return func(host string) *registry.Client {
+		c := registry.NewClient(host, auth)
+		c.HTTP = ratelimit.Client
+		return c
+	}
+}
+
+// MirrorArtifacts copies the signatures, attestations, SBOMs, and OCI referrers of image
+// to reTaggedImage on target t. The docker daemon does not always push a manifest identical to the one
+// it pulled, in which case signatures would not match the mirrored image, so the source
+// manifest is copied over the pushed tag first.
+func (d *Syncer) MirrorArtifacts(image, reTaggedImage string, t pkg.Target) ([]string, error) {
+	srcRef, err := registry.ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	dstRef, err := registry.ParseReference(reTaggedImage)
+	if err != nil {
+		return nil, err
+	}
+	src := d.registryClient(srcRef.Registry, d.PullAuth)
+	dst := d.registryClient(t.Hostname, t.PushAuthConfig)
+
+	srcDesc, err := src.Head(d.Context, srcRef.Repository, srcRef.Reference())
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %w", image, err)
+	}
+
+	dstDesc, err := dst.Head(d.Context, dstRef.Repository, dstRef.Reference())
+	if err != nil || dstDesc.Digest != srcDesc.Digest {
+		pkg.Logger.WithField("registry", t.Hostname).WithField("image", image).
+			Infof("Digest of %s differs from the source, copying source manifest %s", reTaggedImage, srcDesc.Digest)
+		if _, err := registry.Copy(d.Context, src, srcRef.Repository, srcDesc.Digest, dst, dstRef.Repository, dstRef.Reference()); err != nil {
+			return nil, fmt.Errorf("could not copy source manifest of %s: %w", image, err)
+		}
+	}
+
+	return registry.CopyArtifacts(d.Context, src, srcRef.Repository, srcDesc.Digest, dst, dstRef.Repository)
+}
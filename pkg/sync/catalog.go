@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+)
+
+// catalogSource lists every tag of the repositories of a source registry matching the catalog patterns.
+type catalogSource struct {
+	conf   pkg.CatalogConfig
+	client *registry.Client
+}
+
+func newCatalogSource(conf pkg.SourceConfig, reg pkg.Registry) (pkg.ImageSource, error) {
+	if conf.Catalog == nil || conf.Catalog.Registry == "" {
+		return nil, errors.New("catalog sources require a registry")
+	}
+	return &catalogSource{conf: *conf.Catalog, client: RegistryClients(reg.PullAuthConfig)(conf.Catalog.Registry)}, nil
+}
+
+func (s *catalogSource) Name() string { return "catalog of " + s.conf.Registry }
+
+// Images lists the tags of the matching repositories. Tags of signatures and other artifacts
+// are left out, they are copied along with their image by copyArtifacts.
+func (s *catalogSource) Images(ctx context.Context) ([]string, error) {
+	repos, err := s.client.Catalog(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the repositories of %s: %w", s.conf.Registry, err)
+	}
+	var images []string
+	for _, repo := range repos {
+		if len(s.conf.Include) > 0 && !pkg.MatchAnyGlob(s.conf.Include, repo) {
+			continue
+		}
+		if pkg.MatchAnyGlob(s.conf.Exclude, repo) {
+			continue
+		}
+		tags, err := s.client.Tags(ctx, repo)
+		if err != nil {
+			return nil, fmt.Errorf("could not list the tags of %s/%s: %w", s.conf.Registry, repo, err)
+		}
+		for _, tag := range tags {
+			if !strings.HasPrefix(tag, "sha256-") {
+				images = append(images, s.conf.Registry+"/"+repo+":"+tag)
+			}
+		}
+	}
+	return images, nil
+}
+
+// Rename drops the source registry of the images of the catalog, which keep their repository path on the targets.
+func (s *catalogSource) Rename(image string) (string, bool) {
+	if !strings.HasPrefix(image, s.conf.Registry+"/") {
+		return image, false
+	}
+	return strings.TrimPrefix(image, s.conf.Registry+"/"), true
+}
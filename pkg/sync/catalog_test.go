@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestProcessCatalog(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	// every page holds a single repository or tag
+	src.PageSize = 1
+	shell := src.PushImage("team/shell", "v1", "shell layer")
+	src.PushImage("team/shell", "v2", "shell v2 layer")
+	src.PushImage("team/shell", registry.ReferrersTag(shell.Digest)+".sig", "signature layer")
+	src.PushImage("team/scratch/tmp", "v1", "tmp layer")
+	src.PushImage("other/app", "v1", "app layer")
+
+	d := newTestSyncer(t, src, pkg.Registry{
+		Hostname:   "edge.local",
+		Repository: "mirror",
+		Layout:     filepath.Join(t.TempDir(), "layout"),
+		Catalog: &pkg.CatalogConfig{
+			Registry: src.Host,
+			Include:  []string{"team/**"},
+			Exclude:  []string{"**/tmp"},
+		},
+	})
+
+	d.Sources[0].(*catalogSource).client.Scheme = "http"
+	images, err := pkg.ListImages(d.Context, d.Sources)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, images, []string{src.Host + "/team/shell:v1", src.Host + "/team/shell:v2"})
+
+	d.Process()
+	report, _ := d.Reports.Latest()
+	assert.Equal(t, report.Error, "")
+	// images keep their repository path on the target
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		"edge.local/mirror/team/shell:v1": pkg.ImagePushed,
+		"edge.local/mirror/team/shell:v2": pkg.ImagePushed,
+	})
+}
@@ -0,0 +1,21 @@
+package sync
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// DashboardHandler serves the embedded web dashboard. The dashboard itself is
+// static, all data is fetched from the API endpoints, which enforce authentication.
+func DashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		// the embedded directory is always present
+		panic(err)
+	}
+	return http.FileServer(http.FS(files))
+}
@@ -0,0 +1,155 @@
+"use strict";
+
+const tokenInput = document.getElementById("token");
+const errorBox = document.getElementById("error");
+let selected = null;
+
+tokenInput.value = localStorage.getItem("picture-book-token") || "";
+tokenInput.addEventListener("change", () => {
+    localStorage.setItem("picture-book-token", tokenInput.value);
+    refresh();
+});
+
+async function api(path) {
+    const headers = {};
+    if (tokenInput.value) {
+        headers["Authorization"] = "Bearer " + tokenInput.value;
+    }
+    const res = await fetch(path, {headers});
+    if (!res.ok) {
+        throw new Error(`${path}: ${res.status} ${res.statusText}`);
+    }
+    return res;
+}
+
+function showError(err) {
+    errorBox.textContent = err ? err.message : "";
+    errorBox.hidden = !err;
+}
+
+function formatTime(t) {
+    return t ? new Date(t).toLocaleString() : "-";
+}
+
+function el(tag, attrs, ...children) {
+    const e = document.createElement(tag);
+    Object.assign(e, attrs || {});
+    for (const child of children) {
+        e.append(child);
+    }
+    return e;
+}
+
+function progressCell(p) {
+    if (!p.Running) {
+        return el("td", {}, "idle");
+    }
+    const cell = el("td", {});
+    if (p.Total > 0) {
+        cell.append(el("progress", {max: p.Total, value: p.Index}), ` ${p.Index}/${p.Total} `);
+    }
+    cell.append(el("div", {}, `${p.Stage} ${p.Image || ""}`));
+    return cell;
+}
+
+async function op(action, registry) {
+    try {
+        const res = await api(`/ops?action=${action}&sync=${encodeURIComponent(registry)}`);
+        showError(null);
+        console.log(await res.text());
+    } catch (err) {
+        showError(err);
+    }
+    refresh();
+}
+
+function actionsCell(s) {
+    const cell = el("td", {className: "actions"});
+    if (s.Paused) {
+        cell.append(el("button", {onclick: () => op("resume", s.Name)}, "Resume"));
+    } else {
+        cell.append(
+            el("button", {onclick: () => op("pause", s.Name)}, "Pause"),
+            el("button", {onclick: () => op("run", s.Name), disabled: s.Progress.Running}, "Run now"),
+        );
+    }
+    cell.append(el("button", {onclick: () => { selected = s.Name; refresh(); }}, "History"));
+    return cell;
+}
+
+function renderStatuses(statuses) {
+    const body = document.querySelector("#registries tbody");
+    body.replaceChildren();
+    for (const s of statuses || []) {
+        const state = s.Paused ? "paused" : "running";
+        const row = el("tr", {className: s.Name === selected ? "selected" : ""},
+            el("td", {}, s.Name === s.Hostname ? s.Hostname : `${s.Name} (${s.Hostname})`),
+            el("td", {}, s.Repository || "-"),
+            el("td", {}, s.SyncPeriod),
+            el("td", {className: "state-" + state}, state),
+            el("td", {}, formatTime(s.LastRun)),
+            el("td", {}, formatTime(s.NextRun)),
+            progressCell(s.Progress),
+            actionsCell(s),
+        );
+        body.append(row);
+    }
+}
+
+function renderReport(r) {
+    const images = r.Images || [];
+    const pushed = images.filter(i => i.Status === "pushed").length;
+    const skipped = images.filter(i => i.Status === "skipped" || i.Status === "unchanged").length;
+    const failed = images.filter(i => i.Status === "failed" || i.Status === "rejected");
+    const rejected = failed.filter(i => i.Status === "rejected").length;
+    const pruned = images.filter(i => i.Status === "pruned").length;
+    const div = el("div", {className: "report"},
+        el("h3", {}, `${formatTime(r.Started)} - ${formatTime(r.Finished)}${r.Canceled ? " (canceled)" : ""}`),
+        el("div", {}, `${pushed} pushed, ${skipped} already present, ${failed.length - rejected} failed, ${rejected} rejected${pruned ? `, ${pruned} pruned` : ""}`),
+    );
+    if (r.Added || r.Removed) {
+        div.append(el("div", {}, `${(r.Added || []).length} added, ${(r.Removed || []).length} removed since the previous run`));
+    }
+    if (r.Error) {
+        div.append(el("div", {className: "error"}, r.Error));
+    }
+    if (failed.length > 0) {
+        const list = el("ul", {});
+        for (const i of failed) {
+            list.append(el("li", {className: "failed"}, `${i.Image || i.Target} (${i.Status}): ${i.Error}`));
+        }
+        div.append(list);
+    }
+    return div;
+}
+
+async function renderHistory() {
+    const section = document.getElementById("history");
+    if (!selected) {
+        section.hidden = true;
+        return;
+    }
+    const res = await api(`/history?sync=${encodeURIComponent(selected)}`);
+    const reports = await res.json();
+    document.getElementById("history-registry").textContent = selected;
+    const container = document.getElementById("reports");
+    container.replaceChildren(...(reports || []).map(renderReport));
+    if (!reports || reports.length === 0) {
+        container.append("No runs have completed yet.");
+    }
+    section.hidden = false;
+}
+
+async function refresh() {
+    try {
+        const res = await api("/status");
+        renderStatuses(await res.json());
+        await renderHistory();
+        showError(null);
+    } catch (err) {
+        showError(err);
+    }
+}
+
+refresh();
+setInterval(refresh, 2000);
@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/state"
+)
+
+// diffImages returns the images of current which are not in previous, and those of previous no longer in current.
+func diffImages(previous, current []string) (added, removed []string) {
+	prev := make(map[string]bool, len(previous))
+	for _, image := range previous {
+		prev[image] = true
+	}
+	cur := make(map[string]bool, len(current))
+	for _, image := range current {
+		cur[image] = true
+		if !prev[image] {
+			added = append(added, image)
+		}
+	}
+	for _, image := range previous {
+		if !cur[image] {
+			removed = append(removed, image)
+		}
+	}
+	return added, removed
+}
+
+// sourceDigest resolves the digest image currently has in its source registry, empty when it can't be resolved.
+func (d *Syncer) sourceDigest(image string) string {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return ""
+	}
+	desc, err := d.registryClient(ref.Registry, d.PullAuth).Head(d.Context, ref.Repository, ref.Reference())
+	if err != nil {
+		return ""
+	}
+	return desc.Digest
+}
+
+// unchanged reports if image, whose source currently has the given digest, can be skipped without checking
+// the registries: it was listed by the previous run and every one of its targets was mirrored from that
+// digest according to the state. Tags moved at the source since, e.g. latest, are checked again.
+func (d *Syncer) unchanged(previous map[string]bool, image, digest string, targets []string) bool {
+	if !previous[image] || digest == "" {
+		return false
+	}
+	mirrored := true
+	d.State.Update(func(images map[string]*state.Image) {
+		for _, target := range targets {
+			if img := images[d.stateKey(target)]; img == nil || img.SourceDigest != digest {
+				mirrored = false
+			}
+		}
+	})
+	return mirrored
+}
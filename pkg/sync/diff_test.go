@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestProcessChangedImages(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	shellDesc := src.PushImage("rancher/shell", "v0.1.19", "shell layer")
+	src.PushImage("rancher/kubectl", "latest", "kubectl layer")
+	src.PushImage("rancher/fleet", "v0.9.0", "fleet layer")
+
+	shell := src.Host + "/rancher/shell:v0.1.19"
+	kubectl := src.Host + "/rancher/kubectl:latest"
+	fleet := src.Host + "/rancher/fleet:v0.9.0"
+	d := newTestSyncer(t, src, pkg.Registry{
+		Hostname:        "edge.local",
+		Layout:          filepath.Join(t.TempDir(), "layout"),
+		ReconcilePeriod: "1h",
+	}, shell, kubectl)
+
+	// the first run reconciles, and every image is new
+	d.Process()
+	report, _ := d.Reports.Latest()
+	assert.Equal(t, report.Reconcile, true)
+	assert.Equal(t, report.Added, []string{shell, kubectl})
+	assert.Equal(t, statuses(report)["edge.local/"+shell], pkg.ImagePushed)
+	assert.Equal(t, report.Images[0].Digest, shellDesc.Digest)
+	assert.Equal(t, d.State.Images["edge.local/"+shell].Digest, shellDesc.Digest)
+	assert.Equal(t, d.State.Images["edge.local/"+shell].SourceDigest, shellDesc.Digest)
+
+	// images listed again are skipped without checking the layout, as long as their source digest didn't change
+	d.Process()
+	report, _ = d.Reports.Latest()
+	assert.Equal(t, report.Reconcile, false)
+	assert.Equal(t, len(report.Added)+len(report.Removed), 0)
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		"edge.local/" + shell:   pkg.ImageUnchanged,
+		"edge.local/" + kubectl: pkg.ImageUnchanged,
+	})
+
+	// a tag moved at the source is checked again, the latest tag is always pushed to the layout
+	kubectlDesc := src.PushImage("rancher/kubectl", "latest", "new kubectl layer")
+	d.Process()
+	report, _ = d.Reports.Latest()
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		"edge.local/" + shell:   pkg.ImageUnchanged,
+		"edge.local/" + kubectl: pkg.ImagePushed,
+	})
+	assert.Equal(t, d.State.Images["edge.local/"+kubectl].SourceDigest, kubectlDesc.Digest)
+
+	static, err := pkg.NewSource(pkg.SourceConfig{Type: "static", Images: []string{shell, fleet}}, pkg.Registry{})
+	assert.Equal(t, err, nil)
+	d.Sources = []pkg.ImageSource{static}
+	d.Process()
+	report, _ = d.Reports.Latest()
+	assert.Equal(t, report.Added, []string{fleet})
+	assert.Equal(t, report.Removed, []string{kubectl})
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		"edge.local/" + shell: pkg.ImageUnchanged,
+		"edge.local/" + fleet: pkg.ImagePushed,
+	})
+
+	// once the reconcile period elapsed every image is checked again
+	d.State.SetReconciled(time.Now().Add(-2 * time.Hour))
+	d.Process()
+	report, _ = d.Reports.Latest()
+	assert.Equal(t, report.Reconcile, true)
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		"edge.local/" + shell: pkg.ImageSkipped,
+		"edge.local/" + fleet: pkg.ImageSkipped,
+	})
+	assert.Equal(t, time.Since(d.State.Reconciled()) < time.Minute, true)
+}
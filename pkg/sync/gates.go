@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/policy"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/scan"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/verify"
+)
+
+// Gate is a check an image must pass before it is mirrored. Images which don't
+// pass a gate are recorded as rejected in the run report.
+type Gate interface {
+	// Name identifies the gate in logs and run reports
+	Name() string
+	// BeforePull reports if the gate runs before the image is pulled. Other gates
+	// run once the image has been pulled, right before it is pushed.
+	BeforePull() bool
+	// Blocks reports if an image failing the gate should stop the synchronization entirely
+	Blocks() bool
+	// Check evaluates image. An error is only returned if the check was interrupted,
+	// a check which could not be performed is reported as not passing.
+	Check(ctx context.Context, image string) (pkg.GateResult, error)
+}
+
+// BuildGates creates the gates configured for registry.
+func BuildGates(registry pkg.Registry) ([]Gate, error) {
+	var gates []Gate
+	p, err := policy.New(registry.Policy, registry.PullAuthConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy configuration: %w", err)
+	}
+	if p != nil {
+		p.Client = RegistryClients(registry.PullAuthConfig)
+		gates = append(gates, &policyGate{policy: p})
+	}
+
+	verifier, err := verify.New(registry.Verify)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature verification configuration: %w", err)
+	}
+	if verifier != nil {
+		gates = append(gates, &verifyGate{verifier: verifier, auth: registry.PullAuthConfig})
+	}
+
+	scanner, err := scan.New(registry.Scan)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vulnerability scan configuration: %w", err)
+	}
+	if scanner != nil {
+		gates = append(gates, &scanGate{scanner: scanner})
+	}
+	return gates, nil
+}
+
+type policyGate struct {
+	policy *policy.Policy
+}
+
+func (g *policyGate) Name() string     { return "policy" }
+func (g *policyGate) BeforePull() bool { return true }
+func (g *policyGate) Blocks() bool     { return g.policy.Blocks() }
+
+func (g *policyGate) Check(ctx context.Context, image string) (pkg.GateResult, error) {
+	result := pkg.GateResult{Gate: g.Name()}
+	evaluated, err := g.policy.Evaluate(ctx, image, false)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if err != nil {
+		result.Message = err.Error()
+		return result, nil
+	}
+	result.Passed = evaluated.Passed()
+	result.Message = evaluated.Summary()
+	return result, nil
+}
+
+type verifyGate struct {
+	verifier *verify.Verifier
+	auth     string
+}
+
+func (g *verifyGate) Name() string     { return "signature" }
+func (g *verifyGate) BeforePull() bool { return true }
+func (g *verifyGate) Blocks() bool     { return g.verifier.Blocks() }
+
+func (g *verifyGate) Check(ctx context.Context, image string) (pkg.GateResult, error) {
+	result := pkg.GateResult{Gate: g.Name()}
+	err := g.verifier.Verify(ctx, image, g.auth)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if err != nil {
+		result.Message = err.Error()
+		return result, nil
+	}
+	result.Passed = true
+	result.Message = "signature verified"
+	return result, nil
+}
+
+// scanGate runs after the pull so scanners can use the image held by the local docker daemon.
+type scanGate struct {
+	scanner *scan.Scanner
+}
+
+func (g *scanGate) Name() string     { return "vulnerability-scan" }
+func (g *scanGate) BeforePull() bool { return false }
+func (g *scanGate) Blocks() bool     { return g.scanner.Blocks() }
+
+func (g *scanGate) Check(ctx context.Context, image string) (pkg.GateResult, error) {
+	result := pkg.GateResult{Gate: g.Name()}
+	scanned, err := g.scanner.Scan(ctx, image)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if err != nil {
+		result.Message = err.Error()
+		return result, nil
+	}
+	result.Passed = scanned.Passed()
+	result.Message = scanned.Summary(g.scanner.Threshold())
+	result.Findings = scanned.Counts
+	return result, nil
+}
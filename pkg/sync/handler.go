@@ -1,11 +1,16 @@
 package sync
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/config"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/events"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/notify"
 	"github.com/pkg/errors"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type Handler struct {
@@ -17,13 +22,13 @@ type Handler struct {
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if h.EnableAuth {
-		authHeader := w.Header().Get("Authorization")
+		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		token := strings.ReplaceAll(authHeader, "Bearer: ", "")
+		token := strings.TrimPrefix(strings.TrimPrefix(authHeader, "Bearer: "), "Bearer ")
 		if token != h.Token {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
@@ -55,6 +60,77 @@ func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Status returns a summary of every configured registry, including
+// its schedule, pause state, live progress, and most recent run report.
+func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
+	h.Pool.RLock()
+	statuses := ListRegistryStatuses(h.Pool)
+	h.Pool.RUnlock()
+
+	j, err := json.MarshalIndent(statuses, "", " ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+// History returns the stored run reports for a single job, newest first.
+func (h *Handler) History(w http.ResponseWriter, r *http.Request) {
+	reports, ok := h.Pool.Reports[r.URL.Query().Get("sync")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	j, err := json.MarshalIndent(reports.List(), "", " ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+// Events streams sync progress as Server-Sent Events. The optional
+// registry query parameter limits the stream to a single registry or job.
+func (h *Handler) Events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ch, unsubscribe := events.Default.Subscribe(r.URL.Query().Get("registry"))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// proxies tend to close idle connections, so periodically send a comment
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-ch:
+			j, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: progress\ndata: %s\n\n", j)
+		}
+		flusher.Flush()
+	}
+}
+
 // Ops is an endpoint which lets you configure a currently running sync operation.
 // mostly good for getting info on the currently running config, and stopping/starting
 // already defined sync'ers. Maybe add new ones via this endpoint idk yet. Changes made via
@@ -96,9 +172,27 @@ func (h *Handler) Ops(w http.ResponseWriter, r *http.Request) {
 		}
 
 		delete(h.Pool.Syncers, syncName)
-		pkg.Logger.Infof("Syncer for %s has been paused", syncName)
+		pkg.Logger.WithField("job", syncName).Infof("Syncer for %s has been paused", syncName)
+		config.Notifier.NotifyAsync(notify.Notification{Event: notify.EventPaused, Registry: s.RegistryHostName, Job: syncName})
 		w.Write([]byte(fmt.Sprintf("OK. %s has been paused.", syncName)))
 
+	case "run":
+		if !syncerFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// running through the scheduler respects the jobs singleton mode,
+		// so a run that is already in progress will not be duplicated.
+		err := h.Pool.CronJobScheduler.RunByTag(s.Tag())
+		if err != nil {
+			pkg.ErrLogger.Errorf("error encountered running registry sync: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		pkg.Logger.WithField("job", syncName).Infof("Syncer for %s has been started via API", syncName)
+		w.Write([]byte(fmt.Sprintf("OK. Syncer for %s has been started.", syncName)))
+
 	case "resume":
 		syncer, job, err := ResumeRegistry(syncName, h.Pool)
 		if err != nil {
@@ -111,8 +205,9 @@ func (h *Handler) Ops(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		h.Pool.Syncers[syncName] = syncer
-		pkg.Logger.Infof("Syncer for %s has been resumed", syncName)
+		h.Pool.Syncers[syncer.Name] = syncer
+		pkg.Logger.WithField("job", syncer.Name).Infof("Syncer for %s has been resumed", syncer.Name)
+		config.Notifier.NotifyAsync(notify.Notification{Event: notify.EventResumed, Registry: syncer.RegistryHostName, Job: syncer.Name})
 		w.Write([]byte(fmt.Sprintf("OK. Syncer for %s is now running. Next execution will be at %s", syncName, job.NextRun().Format(pkg.TimeFormat))))
 	}
 }
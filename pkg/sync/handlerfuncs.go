@@ -2,9 +2,11 @@ package sync
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg/config"
 	"github.com/go-co-op/gocron"
+	"time"
 )
 
 // ListConfiguredRegistrySyncers returns the contents of the config.ConfiguredRegistries as formatted JSON
@@ -43,11 +45,68 @@ func ResumeRegistry(syncName string, pool *SyncerPool) (*Syncer, *gocron.Job, er
 	if err != nil {
 		return nil, nil, pkg.RegistryNotFound
 	}
+	if _, ok := pool.Syncers[registry.JobName()]; ok {
+		return nil, nil, fmt.Errorf("%s is already running", registry.JobName())
+	}
 
-	syncer, job, err := SetupRegistryJob(registry, pool.CronJobScheduler)
+	syncer, job, err := SetupRegistryJob(registry, pool.CronJobScheduler, pool.Display)
 	if err != nil {
 		return nil, nil, err
 	}
+	if reports, ok := pool.Reports[registry.JobName()]; ok {
+		syncer.Reports = reports
+	}
 
 	return syncer, job, nil
 }
+
+// RegistryStatus is a summary of a configured registry used by the dashboard.
+type RegistryStatus struct {
+	// Name is the name of the job, which is used to select it through the API
+	Name       string
+	Hostname   string
+	Repository string
+	SyncPeriod string
+	Paused     bool
+	RunCount   int
+	LastRun    *time.Time
+	NextRun    *time.Time
+	Progress   pkg.Progress
+	LastReport *pkg.RunReport
+}
+
+// ListRegistryStatuses builds a RegistryStatus for every job in config.ConfiguredRegistries.
+// Registries without an entry in the SyncerPool are considered paused. The caller must hold
+// a read lock on the pool.
+func ListRegistryStatuses(pool *SyncerPool) []RegistryStatus {
+	var statuses []RegistryStatus
+	for _, registry := range config.ConfiguredRegistries {
+		status := RegistryStatus{
+			Name:       registry.JobName(),
+			Hostname:   registry.Hostname,
+			Repository: registry.Repository,
+			SyncPeriod: registry.SyncPeriod,
+		}
+
+		syncer, ok := pool.Syncers[status.Name]
+		status.Paused = !ok
+		if ok && syncer.Job != nil {
+			status.RunCount = syncer.Job.RunCount()
+			if last := syncer.Job.LastRun(); !last.IsZero() {
+				status.LastRun = &last
+			}
+			if next := syncer.Job.NextRun(); !next.IsZero() {
+				status.NextRun = &next
+			}
+			status.Progress = syncer.Progress()
+		}
+
+		if reports, ok := pool.Reports[status.Name]; ok {
+			if latest, ok := reports.Latest(); ok {
+				status.LastReport = &latest
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,119 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/helm"
+	"github.com/sirupsen/logrus"
+)
+
+// helmSource lists the images referenced by a chart or a directory of manifests, keeping
+// the manifests so their images can be rewritten once the run is done.
+type helmSource struct {
+	conf      pkg.HelmConfig
+	manifests map[string][]byte
+}
+
+func newHelmSource(conf pkg.SourceConfig, reg pkg.Registry) (pkg.ImageSource, error) {
+	h := conf.Helm
+	if h == nil || (h.Chart == "") == (h.Manifests == "") {
+		return nil, errors.New("helm sources require either a chart or manifests")
+	}
+	if h.Push && h.Chart == "" {
+		return nil, errors.New("helm push requires a chart")
+	}
+	if h.Push && reg.Layout != "" {
+		return nil, errors.New("helm push is not supported for layouts")
+	}
+	return &helmSource{conf: *h}, nil
+}
+
+func (s *helmSource) Name() string {
+	if s.conf.Chart != "" {
+		return "chart " + s.conf.Chart
+	}
+	return "manifests in " + s.conf.Manifests
+}
+
+func (s *helmSource) Images(ctx context.Context) ([]string, error) {
+	docs, err := helm.Render(ctx, s.conf)
+	if err != nil {
+		return nil, err
+	}
+	s.manifests = docs
+	return helm.Images(docs), nil
+}
+
+// publishCharts publishes the charts, and manifests, of every helm source.
+func (d *Syncer) publishCharts(report *pkg.RunReport, listed map[string]string, log, errLog *logrus.Entry) {
+	for _, s := range d.Sources {
+		if h, ok := s.(*helmSource); ok {
+			d.publishChart(h, report, listed, log, errLog)
+		}
+	}
+}
+
+// publishChart pushes the chart of s to every target when configured, and writes its manifests to the output directory
+// with the images which were mirrored rewritten to the first target. Pushed charts are listed, so they are not pruned.
+func (d *Syncer) publishChart(s *helmSource, report *pkg.RunReport, listed map[string]string, log, errLog *logrus.Entry) {
+	if s.conf.Push {
+		d.setStage("pushing chart")
+		for j, t := range d.Targets {
+			op := d.Display.Start(t.Hostname, "Pushing", "chart "+s.conf.Chart)
+			var ref string
+			err := d.prepareChart(s.conf.Chart, j)
+			if err == nil {
+				ref, err = helm.Push(d.Context, s.conf.Chart, t.Hostname, t.Repository, t.PushAuthConfig)
+			}
+			op.Done(err)
+			if err != nil {
+				errLog.WithFields(logrus.Fields{"stage": "pushing chart", "image": s.conf.Chart}).Errorf("Could not push chart %s to %s: %v", s.conf.Chart, t.Hostname, err)
+				report.Add(s.conf.Chart, t.Hostname+"/"+t.Repository, pkg.ImageFailed, err)
+				continue
+			}
+			log.WithFields(logrus.Fields{"stage": "pushing chart", "image": s.conf.Chart, "target": ref}).Infof("Pushed chart %s", ref)
+			report.Add(s.conf.Chart, ref, pkg.ImagePushed, nil)
+			listed[d.stateKey(ref)] = s.conf.Chart
+		}
+	}
+
+	if s.conf.Output == "" {
+		return
+	}
+	d.setStage("rewriting manifests")
+	first := d.Targets[0]
+	mirrored := make(map[string]bool)
+	for _, i := range report.Images {
+		if (i.Status == pkg.ImagePushed || i.Status == pkg.ImageSkipped || i.Status == pkg.ImageUnchanged) && i.Target == d.reTag(i.Image, first) {
+			mirrored[i.Image] = true
+		}
+	}
+	rewritten := helm.Rewrite(s.manifests, func(image string) (string, bool) {
+		return d.reTag(image, first), mirrored[image]
+	})
+	if err := helm.Write(s.conf.Output, rewritten); err != nil {
+		errLog.WithField("stage", "rewriting manifests").Errorf("Could not write the rewritten manifests to %s: %v", s.conf.Output, err)
+		report.Error = fmt.Sprintf("could not write the rewritten manifests to %s: %v", s.conf.Output, err)
+		return
+	}
+	log.WithField("stage", "rewriting manifests").Infof("Wrote the manifests, referencing %d mirrored images, to %s", len(mirrored), s.conf.Output)
+}
+
+// prepareChart lets the provider of the target at index j create the repository chart is pushed to, like
+// it does for images.
+func (d *Syncer) prepareChart(chart string, j int) error {
+	p := d.providers[j]
+	if p == nil {
+		return nil
+	}
+	name, err := helm.ChartName(chart)
+	if err != nil {
+		return err
+	}
+	t := d.Targets[j]
+	return d.ensureRepository(p, t, t.Hostname+"/"+path.Join(t.Repository, name))
+}
@@ -0,0 +1,56 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/provider"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestProcessManifests(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	src.PushImage("rancher/shell", "v0.1.19", "shell layer")
+
+	manifests := t.TempDir()
+	content := "containers:\n  - name: shell\n    image: " + src.Host + "/rancher/shell:v0.1.19\n  - name: missing\n    image: " + src.Host + "/rancher/missing:v1\n"
+	assert.Equal(t, os.WriteFile(filepath.Join(manifests, "pod.yaml"), []byte(content), 0644), nil)
+	output := t.TempDir()
+
+	d := newTestSyncer(t, src, pkg.Registry{
+		Hostname:   "edge.local",
+		Repository: "mirror",
+		Layout:     filepath.Join(t.TempDir(), "layout"),
+		Helm:       &pkg.HelmConfig{Manifests: manifests, Output: output},
+	})
+	d.Process()
+	report, _ := d.Reports.Latest()
+	assert.Equal(t, report.Error, "")
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		"edge.local/mirror/" + src.Host + "/rancher/shell:v0.1.19": pkg.ImagePushed,
+		"edge.local/mirror/" + src.Host + "/rancher/missing:v1":    pkg.ImageFailed,
+	})
+
+	// only the images which were mirrored are rewritten
+	b, err := os.ReadFile(filepath.Join(output, "pod.yaml"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(b), "containers:\n  - name: shell\n    image: edge.local/mirror/"+src.Host+"/rancher/shell:v0.1.19\n  - name: missing\n    image: "+src.Host+"/rancher/missing:v1\n")
+}
+
+func TestPrepareChart(t *testing.T) {
+	chart := t.TempDir()
+	assert.Equal(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("apiVersion: v2\nname: web\nversion: 1.0.0\n"), 0644), nil)
+
+	// charts are pushed to the repository named after them, which the provider of the target creates
+	p := &recordingProvider{}
+	d := &Syncer{Context: context.Background(), providers: []provider.Provider{p, nil}}
+	d.Targets = []pkg.Target{{Hostname: "harbor.local", Repository: "mirror"}, {Hostname: "plain.local"}}
+	assert.Equal(t, d.prepareChart(chart, 0), nil)
+	assert.Equal(t, d.prepareChart(chart, 1), nil)
+	assert.Equal(t, p.repositories, []string{"mirror/web"})
+}
@@ -0,0 +1,54 @@
+package sync
+
+import (
+	mutex "sync"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+)
+
+const defaultHistorySize = 25
+
+// ReportLog keeps the most recent run reports for a registry. It outlives
+// any single Syncer so history is retained when a registry is paused and resumed.
+type ReportLog struct {
+	mu      mutex.RWMutex
+	size    int
+	reports []pkg.RunReport
+}
+
+func NewReportLog(size int) *ReportLog {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	return &ReportLog{size: size}
+}
+
+func (l *ReportLog) Add(report pkg.RunReport) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reports = append(l.reports, report)
+	if len(l.reports) > l.size {
+		l.reports = l.reports[len(l.reports)-l.size:]
+	}
+}
+
+// List returns the stored reports, newest first.
+func (l *ReportLog) List() []pkg.RunReport {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := make([]pkg.RunReport, 0, len(l.reports))
+	for i := len(l.reports) - 1; i >= 0; i-- {
+		out = append(out, l.reports[i])
+	}
+	return out
+}
+
+// Latest returns the most recent report, if any.
+func (l *ReportLog) Latest() (pkg.RunReport, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.reports) == 0 {
+		return pkg.RunReport{}, false
+	}
+	return l.reports[len(l.reports)-1], true
+}
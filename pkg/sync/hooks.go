@@ -0,0 +1,164 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+// The hooks run around synchronizations, named as in config.yaml.
+const (
+	hookPreSync       = "preSync"
+	hookPostSync      = "postSync"
+	hookOnImagePushed = "onImagePushed"
+	hookOnFailure     = "onFailure"
+)
+
+const (
+	defaultHookTimeout = 5 * time.Minute
+	// maxHookOutput bounds the output of a hook kept in the run report
+	maxHookOutput = 16 << 10
+)
+
+// hookWaitDelay bounds how long the output of a timed out hook is still read, processes it started in the
+// background may hold it open after the hook itself was killed.
+var hookWaitDelay = 5 * time.Second
+
+// hook is a command run around synchronizations.
+type hook struct {
+	name    string
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+// buildHooks creates the hooks configured for a registry, keyed by their name.
+func buildHooks(conf pkg.HooksConfig) (map[string]*hook, error) {
+	hooks := make(map[string]*hook)
+	for name, c := range map[string]*pkg.HookConfig{
+		hookPreSync:       conf.PreSync,
+		hookPostSync:      conf.PostSync,
+		hookOnImagePushed: conf.OnImagePushed,
+		hookOnFailure:     conf.OnFailure,
+	} {
+		if c == nil {
+			continue
+		}
+		if c.Command == "" {
+			return nil, fmt.Errorf("the %s hook requires a command", name)
+		}
+		h := &hook{name: name, command: c.Command, args: strings.Fields(c.Args), timeout: defaultHookTimeout}
+		if c.Timeout != "" {
+			d, err := time.ParseDuration(c.Timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid timeout %s for the %s hook", c.Timeout, name)
+			}
+			h.timeout = d
+		}
+		hooks[name] = h
+	}
+	return hooks, nil
+}
+
+// run runs the hook with env added to the environment of picture-book, returning what it
+// wrote to standard output and error. Hooks are not canceled along with the run, only when they time out.
+func (h *hook) run(env map[string]string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.command, h.args...)
+	cmd.WaitDelay = hookWaitDelay
+	cmd.Env = os.Environ()
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, k+"="+env[k])
+	}
+	pkg.Logger.WithField("hook", h.name).Debugf("Running %s", cmd.String())
+	out, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", h.timeout)
+	}
+	output := string(out)
+	if len(output) > maxHookOutput {
+		output = output[:maxHookOutput] + "\n... (truncated)"
+	}
+	return output, err
+}
+
+// runHook runs the named hook, when configured, and records its result in report. The hook's environment
+// describes the job and the run, along with env.
+func (d *Syncer) runHook(name string, report *pkg.RunReport, env map[string]string, log, errLog *logrus.Entry) error {
+	h, ok := d.hooks[name]
+	if !ok {
+		return nil
+	}
+	d.setStage(name + " hook")
+	vars := map[string]string{
+		"PICTURE_BOOK_HOOK":       name,
+		"PICTURE_BOOK_JOB":        d.Name,
+		"PICTURE_BOOK_REGISTRY":   d.RegistryHostName,
+		"PICTURE_BOOK_REPOSITORY": d.Repository,
+		"PICTURE_BOOK_RUN_ID":     report.ID,
+	}
+	for k, v := range env {
+		vars[k] = v
+	}
+	output, err := h.run(vars)
+	result := pkg.HookResult{
+		Hook:   name,
+		Image:  env["PICTURE_BOOK_IMAGE"],
+		Target: env["PICTURE_BOOK_TARGET"],
+		Output: output,
+	}
+	fields := logrus.Fields{"stage": name + " hook", "hook": h.command}
+	if err != nil {
+		result.Error = err.Error()
+		errLog.WithFields(fields).Errorf("The %s hook failed: %v", name, err)
+	} else {
+		log.WithFields(fields).Infof("Ran the %s hook", name)
+	}
+	report.Hooks = append(report.Hooks, result)
+	return err
+}
+
+// runImageHook runs the onImagePushed hook for image, pushed to target with the given digest.
+func (d *Syncer) runImageHook(report *pkg.RunReport, image, target, digest string, log, errLog *logrus.Entry) {
+	d.runHook(hookOnImagePushed, report, map[string]string{
+		"PICTURE_BOOK_IMAGE":  image,
+		"PICTURE_BOOK_TARGET": target,
+		"PICTURE_BOOK_DIGEST": digest,
+	}, log, errLog)
+}
+
+// runResultHooks runs the postSync hook once a run is done, followed by the onFailure hook if it failed.
+func (d *Syncer) runResultHooks(report *pkg.RunReport, log, errLog *logrus.Entry) {
+	result := "succeeded"
+	if report.Failed() {
+		result = "failed"
+	} else if report.Canceled {
+		result = "canceled"
+	}
+	env := map[string]string{
+		"PICTURE_BOOK_RESULT":  result,
+		"PICTURE_BOOK_ERROR":   report.Error,
+		"PICTURE_BOOK_PUSHED":  strconv.Itoa(report.Count(pkg.ImagePushed)),
+		"PICTURE_BOOK_FAILED":  strconv.Itoa(report.Count(pkg.ImageFailed)),
+		"PICTURE_BOOK_TRIGGER": report.Trigger,
+	}
+	d.runHook(hookPostSync, report, env, log, errLog)
+	if report.Failed() {
+		d.runHook(hookOnFailure, report, env, log, errLog)
+	}
+}
@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+)
+
+// hookScript writes a hook which prints its name and the given environment variables, then exits with code.
+func hookScript(t *testing.T, code string, vars ...string) string {
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	content := "#!/bin/sh\necho \"$PICTURE_BOOK_HOOK $PICTURE_BOOK_JOB"
+	for _, v := range vars {
+		content += " $" + v
+	}
+	content += "\"\nexit " + code + "\n"
+	assert.Equal(t, os.WriteFile(script, []byte(content), 0755), nil)
+	return script
+}
+
+func TestHooks(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	desc := src.PushImage("rancher/shell", "v0.1.19", "shell layer")
+	shell := src.Host + "/rancher/shell:v0.1.19"
+
+	d := newTestSyncer(t, src, pkg.Registry{
+		Name:     "edge",
+		Hostname: "edge.local",
+		Layout:   filepath.Join(t.TempDir(), "layout"),
+		Hooks: pkg.HooksConfig{
+			PreSync:       &pkg.HookConfig{Command: hookScript(t, "0", "PICTURE_BOOK_REGISTRY")},
+			OnImagePushed: &pkg.HookConfig{Command: hookScript(t, "0", "PICTURE_BOOK_IMAGE", "PICTURE_BOOK_TARGET", "PICTURE_BOOK_DIGEST")},
+			PostSync:      &pkg.HookConfig{Command: hookScript(t, "0", "PICTURE_BOOK_RESULT", "PICTURE_BOOK_PUSHED")},
+			OnFailure:     &pkg.HookConfig{Command: hookScript(t, "0", "PICTURE_BOOK_ERROR")},
+		},
+	}, shell)
+
+	d.Process()
+	report, _ := d.Reports.Latest()
+	assert.Equal(t, report.Error, "")
+	assert.Equal(t, report.Hooks, []pkg.HookResult{
+		{Hook: "preSync", Output: "preSync edge edge.local\n"},
+		{Hook: "onImagePushed", Image: shell, Target: "edge.local/" + shell, Output: "onImagePushed edge " + shell + " edge.local/" + shell + " " + desc.Digest + "\n"},
+		{Hook: "postSync", Output: "postSync edge succeeded 1\n"},
+	})
+
+	// a failing preSync hook fails the run before any image is synchronized
+	d.hooks[hookPreSync].command = hookScript(t, "3")
+	d.Process()
+	report, _ = d.Reports.Latest()
+	assert.Equal(t, report.Error, "the preSync hook failed: exit status 3")
+	assert.Equal(t, len(report.Images), 0)
+	assert.Equal(t, report.Hooks, []pkg.HookResult{
+		{Hook: "preSync", Output: "preSync edge\n", Error: "exit status 3"},
+		{Hook: "postSync", Output: "postSync edge failed 0\n"},
+		{Hook: "onFailure", Output: "onFailure edge the preSync hook failed: exit status 3\n"},
+	})
+}
+
+func TestBuildHooks(t *testing.T) {
+	hooks, err := buildHooks(pkg.HooksConfig{
+		PreSync: &pkg.HookConfig{Command: "sleep", Args: "5", Timeout: "100ms"},
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(hooks), 1)
+	_, err = hooks[hookPreSync].run(nil)
+	assert.Equal(t, err.Error(), "timed out after 100ms")
+
+	// processes left in the background by a timed out hook must not hold up the run
+	old := hookWaitDelay
+	hookWaitDelay = 100 * time.Millisecond
+	defer func() { hookWaitDelay = old }()
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	assert.Equal(t, os.WriteFile(script, []byte("#!/bin/sh\nsleep 5 &\nsleep 5\n"), 0755), nil)
+	hooks[hookPreSync].command, hooks[hookPreSync].args = script, nil
+	start := time.Now()
+	_, err = hooks[hookPreSync].run(nil)
+	assert.Equal(t, err.Error(), "timed out after 100ms")
+	assert.Equal(t, time.Since(start) < 2*time.Second, true)
+
+	for _, conf := range []pkg.HooksConfig{
+		{PostSync: &pkg.HookConfig{}},
+		{OnFailure: &pkg.HookConfig{Command: "true", Timeout: "soon"}},
+	} {
+		_, err := buildHooks(conf)
+		assert.Equal(t, err != nil, true)
+	}
+}
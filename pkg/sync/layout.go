@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"fmt"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+)
+
+// WriteLayout copies image from its source registry into the layout under its retagged name, without going
+// through the docker daemon, returning that name and the digest of the image. The layout is saved once the image is written,
+// so it can be served at any time.
+func (d *Syncer) WriteLayout(image string) (string, string, error) {
+	reTaggedImage := d.reTag(image, d.Targets[0])
+	op := d.Display.Start(d.RegistryHostName, "Writing", fmt.Sprintf("%s -> %s", image, reTaggedImage))
+	var desc registry.Descriptor
+	ref, err := registry.ParseReference(image)
+	if err == nil {
+		desc, err = d.Layout.AddAs(d.Context, d.registryClient(ref.Registry, d.PullAuth), image, reTaggedImage)
+	}
+	if err == nil {
+		err = d.Layout.Save()
+	}
+	op.Done(err)
+	return reTaggedImage, desc.Digest, err
+}
+
+// ImageExistsInLayout checks if the layout already holds the retagged image, following
+// the same rules as ImageExistsOnRegistry: images tagged 'latest' are always processed.
+func (d *Syncer) ImageExistsInLayout(image string) (bool, error) {
+	reTaggedImage := d.reTag(image, d.Targets[0])
+	ref, err := registry.ParseReference(reTaggedImage)
+	if err != nil {
+		return false, err
+	}
+	if ref.Tag == "latest" && ref.Digest == "" {
+		return false, nil
+	}
+	_, ok := d.Layout.Lookup(reTaggedImage)
+	return ok, nil
+}
@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/state"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+// tracksLocalImages reports if the images pulled by the syncer are removed from the local docker storage later on.
+func (d *Syncer) tracksLocalImages() bool {
+	return d.RemoveLocalImages || d.DiskBudget > 0
+}
+
+// ownsLocalImage reports if picture-book may remove image from the local docker storage once it was pulled,
+// which is only the case when picture-book pulled it, rather than finding it already present.
+func (d *Syncer) ownsLocalImage(image string) bool {
+	var tracked bool
+	d.State.UpdateLocal(func(local map[string]*state.LocalImage) {
+		_, tracked = local[image]
+	})
+	if tracked {
+		return true
+	}
+	_, _, err := d.client.ImageInspectWithRaw(d.Context, image)
+	return client.IsErrNotFound(err)
+}
+
+// recordLocalImage records a pulled image, which will be retagged as targets, so it can be evicted later.
+func (d *Syncer) recordLocalImage(image string, targets []string, now time.Time) error {
+	inspect, _, err := d.client.ImageInspectWithRaw(d.Context, image)
+	if err != nil {
+		return err
+	}
+	d.State.UpdateLocal(func(local map[string]*state.LocalImage) {
+		local[image] = &state.LocalImage{
+			ID:         inspect.ID,
+			Size:       inspect.Size,
+			References: append([]string{image}, targets...),
+			LastSynced: now,
+		}
+	})
+	return nil
+}
+
+// evictLocalImages removes the least recently synchronized images picture-book pulled, until
+// the images it holds fit in the disk budget. Images which can't be removed, e.g. because
+// a container uses them, are skipped.
+func (d *Syncer) evictLocalImages(log, errLog *logrus.Entry) {
+	var total int64
+	var images []state.LocalImage
+	d.State.UpdateLocal(func(local map[string]*state.LocalImage) {
+		for _, l := range local {
+			total += l.Size
+			images = append(images, *l)
+		}
+	})
+	if total <= d.DiskBudget {
+		return
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].LastSynced.Before(images[j].LastSynced)
+	})
+
+	log = log.WithField("stage", "removing local images")
+	for _, l := range images {
+		if total <= d.DiskBudget {
+			break
+		}
+		op := d.Display.Start(d.RegistryHostName, "Removing", fmt.Sprintf("locally held image %s to stay within the disk budget", l.References[0]))
+		err := RemoveImage(d.Context, d.client, l.References...)
+		op.Done(err)
+		if err != nil {
+			errLog.WithFields(logrus.Fields{"stage": "removing local images", "image": l.References[0]}).Warnf("Could not remove locally held image %s, it may be in use: %v", l.References[0], err)
+			continue
+		}
+		total -= l.Size
+		log.WithField("image", l.References[0]).Infof("Removed locally held image %s, last synchronized %s", l.References[0], l.LastSynced.Format(time.RFC3339))
+		d.State.UpdateLocal(func(local map[string]*state.LocalImage) {
+			delete(local, l.References[0])
+		})
+	}
+	if total > d.DiskBudget {
+		errLog.WithField("stage", "removing local images").Warnf("The images held locally for %s exceed the disk budget", d.RegistryHostName)
+	}
+}
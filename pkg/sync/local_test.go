@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/state"
+	"github.com/docker/docker/client"
+	"github.com/magiconair/properties/assert"
+)
+
+// fakeDaemon serves the image endpoints of the docker API. present images can be inspected,
+// inUse images can't be removed, and every removed reference is recorded.
+type fakeDaemon struct {
+	present map[string]bool
+	inUse   map[string]bool
+	removed []string
+}
+
+func (f *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1.41/images/")
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(name, "/json"):
+		name = strings.TrimSuffix(name, "/json")
+		if !f.present[name] {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "No such image: " + name})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Id": "sha256:" + name, "Size": 1000})
+	case r.Method == http.MethodDelete:
+		if f.inUse[name] {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"message": "conflict: unable to remove repository reference " + name})
+			return
+		}
+		f.removed = append(f.removed, name)
+		json.NewEncoder(w).Encode([]map[string]string{{"Untagged": name}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeDaemon(t *testing.T, d *Syncer, f *fakeDaemon) {
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	c, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.41"))
+	assert.Equal(t, err, nil)
+	d.client = c
+}
+
+func TestEvictLocalImages(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	d := newTestSyncer(t, src, pkg.Registry{Hostname: "my-registry.space", DiskBudget: "100B"})
+	assert.Equal(t, d.DiskBudget, int64(100))
+	daemon := &fakeDaemon{present: map[string]bool{"busybox": true}, inUse: map[string]bool{"rancher/kubectl:v1": true}}
+	newFakeDaemon(t, d, daemon)
+
+	now := time.Now()
+	for i, image := range []string{"rancher/shell:v1", "rancher/kubectl:v1", "rancher/fleet:v1"} {
+		d.State.Local[image] = &state.LocalImage{
+			Size:       60,
+			References: []string{image, "my-registry.space/" + image},
+			LastSynced: now.Add(time.Duration(i) * time.Minute),
+		}
+	}
+
+	// only images picture-book pulled itself may be removed
+	assert.Equal(t, d.ownsLocalImage("busybox"), false)
+	assert.Equal(t, d.ownsLocalImage("alpine"), true)
+	assert.Equal(t, d.ownsLocalImage("rancher/shell:v1"), true)
+
+	// the least recently synchronized images are removed first, images in use are skipped
+	d.evictLocalImages(pkg.Logger.WithField("test", true), pkg.ErrLogger.WithField("test", true))
+	assert.Equal(t, daemon.removed, []string{
+		"rancher/shell:v1", "my-registry.space/rancher/shell:v1",
+		"rancher/fleet:v1", "my-registry.space/rancher/fleet:v1",
+	})
+	assert.Equal(t, len(d.State.Local), 1)
+	assert.Equal(t, d.State.Local["rancher/kubectl:v1"].Size, int64(60))
+
+	// within the budget nothing is removed
+	daemon.removed = nil
+	d.evictLocalImages(pkg.Logger.WithField("test", true), pkg.ErrLogger.WithField("test", true))
+	assert.Equal(t, len(daemon.removed), 0)
+
+	// images picture-book did not pull only lose the name they were retagged with
+	assert.Equal(t, d.RemoveImage("busybox", []string{"my-registry.space/busybox"}, false), nil)
+	assert.Equal(t, daemon.removed, []string{"my-registry.space/busybox"})
+}
+
+func TestDiskBudgetConfig(t *testing.T) {
+	for _, conf := range []pkg.Registry{
+		{Hostname: "my-registry.space", DiskBudget: "20GB", DeleteLocalImages: true},
+		{Hostname: "my-registry.space", DiskBudget: "a lot"},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, _, err := BuildRegistrySyncer(ctx, cancel, conf, &display.Logs{})
+		cancel()
+		assert.Equal(t, err != nil, true, conf.DiskBudget)
+	}
+}
@@ -8,23 +8,122 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
 	"strings"
+	mutex "sync"
 	"time"
 
 	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/config"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/events"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/notify"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/provider"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/ratelimit"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
 	"github.com/docker/docker/client"
-	"github.com/theckman/yacspin"
+	"github.com/sirupsen/logrus"
 )
 
+// Process synchronizes every image listed by the sources of the job.
 func (d *Syncer) Process() {
-	images, err := d.ExecScript()
+	d.process(nil)
+}
+
+// ProcessImages synchronizes only the given images, e.g. those a registry reported pushed through a webhook.
+// The sources are not listed, so nothing is pruned and no charts are published.
+func (d *Syncer) ProcessImages(images []string) {
+	d.process(images)
+}
+
+// process synchronizes the given images, or those listed by the sources of the job when nil.
+func (d *Syncer) process(only []string) {
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	report := pkg.NewRunReport(d.RegistryHostName)
+	report.Job = d.Name
+	if only != nil {
+		report.Trigger = "webhook"
+	}
+	d.setProgress(func(p *pkg.Progress) {
+		*p = pkg.Progress{
+			Running: true,
+			RunID:   report.ID,
+			Started: report.Started,
+		}
+	})
+
+	// every log line for this run carries the registry and run ID so
+	// they can be queried once shipped to a log aggregator
+	fields := logrus.Fields{
+		"registry": d.RegistryHostName,
+		"job":      d.Name,
+		"run_id":   report.ID,
+	}
+	log := pkg.Logger.WithFields(fields)
+	errLog := pkg.ErrLogger.WithFields(fields)
+
+	defer func() {
+		d.runResultHooks(report, log, errLog)
+		report.Finished = time.Now()
+		d.Reports.Add(*report)
+		d.setProgress(func(p *pkg.Progress) {
+			*p = pkg.Progress{}
+		})
+		events.Publish(events.Event{
+			Registry: d.RegistryHostName,
+			Job:      d.Name,
+			Stage:    "finished",
+		})
+		// sinks may be slow to respond, the next run of the job must not wait for them
+		config.Notifier.NotifyAsync(notify.Notification{
+			Event:    notify.EventRun,
+			Registry: d.RegistryHostName,
+			Job:      d.Name,
+			Report:   report,
+		})
+	}()
+
+	if err := d.runHook(hookPreSync, report, nil, log, errLog); err != nil {
+		report.Error = fmt.Sprintf("the preSync hook failed: %v", err)
+		return
+	}
+	d.setStage("listing images")
+
+	images := only
+	var err error
+	if only == nil {
+		images, err = pkg.ListImages(d.Context, d.Sources)
+	}
 	if err != nil {
-		pkg.ErrLogger.Errorf("error encountered when executing syncer script %s. Exiting script execution and image syncing process: %v", d.Executor.File, err)
+		errLog.WithField("stage", "listing images").Errorf("error encountered when listing images. Exiting image syncing process: %v", err)
+		report.Error = err.Error()
 		return
 	}
-	pkg.Logger.Infof("Beginning synchronization for %s", d.RegistryHostName)
+	log.WithField("stage", "listing images").Infof("Beginning synchronization for %s", d.RegistryHostName)
 
+	// previous holds the images listed by the previous run, which are skipped without checking the
+	// registries when unchanged, unless the reconcile period elapsed. Webhook runs always check.
+	var previous map[string]bool
+	if only == nil {
+		listedBefore := d.State.SetListed(images)
+		report.Added, report.Removed = diffImages(listedBefore, images)
+		if d.reconcilePeriod > 0 {
+			if time.Since(d.State.Reconciled()) >= d.reconcilePeriod {
+				report.Reconcile = true
+			} else {
+				previous = make(map[string]bool, len(listedBefore))
+				for _, image := range listedBefore {
+					previous[image] = true
+				}
+			}
+		}
+	}
+
+	listed := make(map[string]string)
+	// sourceDigests holds the digest of each image at its source, recorded in the state so moved tags are noticed
+	sourceDigests := make(map[string]string)
 SyncLoop:
-	for _, image := range images {
+	for i, image := range images {
 		if image == "" {
 			continue
 		}
@@ -32,75 +131,323 @@ SyncLoop:
 		// check for any cancel signals from the API
 		select {
 		case <-d.Context.Done():
-			pkg.Logger.Infof("Canceling image synchronization due to syncer pause via API")
+			log.Infof("Canceling image synchronization due to syncer pause via API")
+			report.Canceled = true
 			break SyncLoop
 		default:
 
 		}
 
-		// check if the target registry already has the image and tag being processed
-		alreadyPushed, err := d.ImageExistsOnRegistry(image)
-		if err != nil {
-			pkg.ErrLogger.Errorf("Error encountered while checking if image has already been pushed to %s: %v", d.RegistryHostName, err)
+		d.setProgress(func(p *pkg.Progress) {
+			p.Image = image
+			p.Index = i + 1
+			p.Total = len(images)
+		})
+		d.setStage("checking")
+		// the image is pulled once, and pushed to each of the targets of the job
+		targets := make([]string, len(d.Targets))
+		for j, t := range d.Targets {
+			targets[j] = d.reTag(image, t)
+			listed[d.stateKey(targets[j])] = image
+		}
+		imageStart := time.Now()
+		imgFields := logrus.Fields{
+			"image":  image,
+			"target": strings.Join(targets, ","),
+		}
+		imgLog := log.WithFields(imgFields)
+		imgErrLog := errLog.WithFields(imgFields)
+
+		var gateResults []pkg.GateResult
+		add := func(j int, status pkg.ImageStatus, err error) *pkg.ImageReport {
+			r := report.Add(image, targets[j], status, err)
+			r.Gates = gateResults
+			return r
+		}
+		// pending are the indexes of the targets the image still has to be pushed to
+		var pending []int
+		addPending := func(status pkg.ImageStatus, err error) {
+			for _, j := range pending {
+				add(j, status, err)
+			}
+		}
+		// reject records an image which did not pass gate, and reports
+		// if the rest of the synchronization must be blocked
+		reject := func(gate Gate) bool {
+			result := gateResults[len(gateResults)-1]
+			addPending(pkg.ImageRejected, fmt.Errorf("%s: %s", gate.Name(), result.Message))
+			log := imgErrLog.WithField("stage", gate.Name())
+			if gate.Blocks() {
+				log.Errorf("%s rejected %s, blocking synchronization: %s", gate.Name(), image, result.Message)
+				report.Error = fmt.Sprintf("synchronization blocked, %s rejected %s: %s", gate.Name(), image, result.Message)
+				return true
+			}
+			log.Warnf("%s rejected %s, skipping: %s", gate.Name(), image, result.Message)
+			return false
+		}
+
+		var digest string
+		if d.reconcilePeriod > 0 && only == nil {
+			digest = d.sourceDigest(image)
+			sourceDigests[image] = digest
+		}
+		if d.unchanged(previous, image, digest, targets) {
+			for j := range d.Targets {
+				add(j, pkg.ImageUnchanged, nil)
+			}
 			continue
 		}
 
-		if alreadyPushed {
-			pkg.Logger.Infof("%s has already been retagged and pushed to remote repository!", image)
-			// nothing to do!
+		// check if the target registries already have the image and tag being processed
+		for j, t := range d.Targets {
+			alreadyPushed, err := d.ImageExistsOnRegistry(t, image)
+			if err != nil {
+				imgErrLog.WithFields(logrus.Fields{"stage": "checking", "target": targets[j]}).Errorf("Error encountered while checking if image has already been pushed to %s: %v", t.Hostname, err)
+				add(j, pkg.ImageFailed, err)
+				continue
+			}
+			if alreadyPushed {
+				imgLog.WithFields(logrus.Fields{"stage": "checking", "target": targets[j]}).Infof("%s has already been retagged and pushed to %s!", image, t.Hostname)
+				// nothing to do!
+				add(j, pkg.ImageSkipped, nil)
+				continue
+			}
+			pending = append(pending, j)
+		}
+		if len(pending) == 0 {
 			continue
 		}
 
-		err = d.Pull(image)
-		if err != nil && !errors.Is(err, context.Canceled) {
-			pkg.ErrLogger.Errorf("Error encountered while pulling %s: %v", image, err)
+		gate, err := d.runGates(true, image, &gateResults)
+		if errors.Is(err, context.Canceled) {
+			report.Canceled = true
+			break SyncLoop
+		}
+		if gate != nil {
+			if reject(gate) {
+				break SyncLoop
+			}
 			continue
 		}
 
-		reTaggedImage, err := d.Retag(d.Context, image)
-		if err != nil && !errors.Is(err, context.Canceled) {
-			pkg.ErrLogger.Errorf("Could not retag image '%s' -> '%s': %v", image, reTaggedImage, err)
+		// layouts are written straight from the source registry, so there is nothing to pull
+		var owned bool
+		if d.Layout == nil {
+			// images found in the local storage before pulling may be used by other workloads, they are never removed
+			owned = d.tracksLocalImages() && d.ownsLocalImage(image)
+			d.setStage("pulling")
+			err = d.Pull(image)
+			if errors.Is(err, context.Canceled) {
+				report.Canceled = true
+				break SyncLoop
+			}
+			if err != nil {
+				imgErrLog.WithField("stage", "pulling").Errorf("Error encountered while pulling %s: %v", image, err)
+				addPending(pkg.ImageFailed, err)
+				continue
+			}
+			if owned && d.DiskBudget > 0 {
+				if err := d.recordLocalImage(image, targets, time.Now()); err != nil {
+					imgErrLog.WithField("stage", "pulling").Errorf("Could not inspect %s, it will not be removed to stay within the disk budget: %v", image, err)
+				}
+			}
+		}
+
+		gate, err = d.runGates(false, image, &gateResults)
+		if errors.Is(err, context.Canceled) {
+			report.Canceled = true
+			break SyncLoop
+		}
+		if gate != nil {
+			if d.RemoveLocalImages && owned {
+				if err := RemoveImage(d.Context, d.client, image); err != nil {
+					imgErrLog.WithField("stage", "removing local images").Errorf("couldn't delete locally held image %s: %v", image, err)
+				}
+			}
+			if reject(gate) {
+				break SyncLoop
+			}
 			continue
 		}
 
-		err = d.Push(reTaggedImage)
-		if err != nil && !errors.Is(err, context.Canceled) {
-			pkg.ErrLogger.Errorf("Error encountered while pushing %s to %s: %v", reTaggedImage, d.RegistryHostName, err)
+		if d.Layout != nil {
+			d.setStage("writing")
+			reTaggedImage, digest, err := d.WriteLayout(image)
+			if errors.Is(err, context.Canceled) {
+				report.Canceled = true
+				break SyncLoop
+			}
+			if err != nil {
+				imgErrLog.WithField("stage", "writing").Errorf("Error encountered while writing %s to the layout of %s: %v", image, d.RegistryHostName, err)
+				addPending(pkg.ImageFailed, err)
+				continue
+			}
+			add(0, pkg.ImagePushed, nil).Digest = digest
+			imgLog.WithFields(logrus.Fields{
+				"stage":    "writing",
+				"duration": time.Since(imageStart).String(),
+			}).Infof("Wrote %s", reTaggedImage)
+			d.runImageHook(report, image, reTaggedImage, digest, imgLog, imgErrLog)
 			continue
 		}
 
-		if d.RemoveLocalImages {
-			// this also removes the retagged image since they share the same image ID
-			err = d.RemoveImage(image, reTaggedImage)
+		d.setStage("retagging")
+		var retagged []string
+		var tagged []int
+		for _, j := range pending {
+			reTaggedImage, err := d.Retag(d.Context, image, d.Targets[j])
+			if errors.Is(err, context.Canceled) {
+				report.Canceled = true
+				break SyncLoop
+			}
+			if err != nil {
+				imgErrLog.WithFields(logrus.Fields{"stage": "retagging", "target": targets[j]}).Errorf("Could not retag image '%s' -> '%s': %v", image, targets[j], err)
+				add(j, pkg.ImageFailed, err)
+				continue
+			}
+			retagged = append(retagged, reTaggedImage)
+			tagged = append(tagged, j)
+		}
+
+		d.setStage("pushing")
+		results := d.pushTargets(image, tagged, targets)
+		var pushed bool
+		for k, j := range tagged {
+			r := results[k]
+			if errors.Is(r.err, context.Canceled) {
+				// the push may have been interrupted halfway, the target must not appear untouched in the report
+				report.Canceled = true
+				add(j, pkg.ImageFailed, r.err)
+				continue
+			}
+			targetLog := imgLog.WithField("target", targets[j])
+			targetErrLog := imgErrLog.WithField("target", targets[j])
+			if r.err != nil {
+				targetErrLog.WithField("stage", "pushing").Errorf("Error encountered while pushing %s to %s: %v", targets[j], d.Targets[j].Hostname, r.err)
+				add(j, pkg.ImageFailed, r.err)
+				continue
+			}
+			pushed = true
+			imgReport := add(j, pkg.ImagePushed, nil)
+			imgReport.Digest = r.digest
+			imgReport.Artifacts = r.artifacts
+			if r.artifactErr != nil {
+				targetErrLog.WithField("stage", "copying artifacts").Errorf("Could not copy signatures and attestations of %s: %v", image, r.artifactErr)
+				imgReport.Status = pkg.ImageFailed
+				imgReport.Error = fmt.Sprintf("image was pushed, but copying its artifacts failed: %v", r.artifactErr)
+			}
+			targetLog.WithFields(logrus.Fields{
+				"stage":    "pushing",
+				"duration": r.duration.String(),
+			}).Infof("Pushed %s", targets[j])
+			d.runImageHook(report, image, targets[j], r.digest, targetLog, targetErrLog)
+		}
+		if report.Canceled {
+			break SyncLoop
+		}
+		if pushed && (d.RemoveLocalImages || (d.DiskBudget > 0 && !owned)) {
+			d.setStage("removing local images")
+			// images picture-book did not pull only lose their retagged names
+			err = d.RemoveImage(image, retagged, owned && d.RemoveLocalImages)
 			if err != nil {
-				pkg.ErrLogger.Errorf("couldn't delete locally held image %s: %v", image, err)
+				imgErrLog.WithField("stage", "removing local images").Errorf("couldn't delete locally held image %s: %v", image, err)
 			}
 		}
+		if d.DiskBudget > 0 {
+			d.evictLocalImages(imgLog, imgErrLog)
+		}
+	}
+	if d.DiskBudget > 0 {
+		d.evictLocalImages(log, errLog)
+	}
+
+	// images are only pruned once the whole list was processed, a partial
+	// run can't tell which images dropped out of the syncer scripts output
+	if only == nil && !report.Canceled && report.Error == "" {
+		d.publishCharts(report, listed, log, errLog)
+	}
+	now := time.Now()
+	d.recordImages(report, listed, sourceDigests, now)
+	if report.Reconcile && !report.Canceled && report.Error == "" {
+		d.State.SetReconciled(now)
 	}
-	pkg.Logger.Infof("Done synchronizing images for %s", d.RegistryHostName)
+	if d.Prune.Enabled && only == nil && !report.Canceled && report.Error == "" {
+		d.prune(report, listed, now, log, errLog)
+	}
+	if err := d.State.Save(); err != nil {
+		errLog.WithField("stage", "saving state").Errorf("Could not save the state of %s: %v", d.RegistryHostName, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"duration":  time.Since(report.Started).String(),
+		"pushed":    report.Count(pkg.ImagePushed),
+		"skipped":   report.Count(pkg.ImageSkipped),
+		"unchanged": report.Count(pkg.ImageUnchanged),
+		"failed":    report.Count(pkg.ImageFailed),
+		"rejected":  report.Count(pkg.ImageRejected),
+		"pruned":    report.Count(pkg.ImagePruned),
+	}).Infof("Done synchronizing images for %s", d.RegistryHostName)
 }
 
-var cfg = yacspin.Config{
-	Frequency:       100 * time.Millisecond,
-	CharSet:         yacspin.CharSets[59],
-	Suffix:          "",
-	SuffixAutoColon: true,
-	Message:         "",
-	StopCharacter:   "✓",
-	StopColors:      []string{"fgGreen"},
+// pushResult is the outcome of pushing an image to one of the targets of a job.
+type pushResult struct {
+	err         error
+	digest      string
+	artifacts   []string
+	artifactErr error
+	duration    time.Duration
 }
 
-func RemoveImage(ctx context.Context, client *client.Client, image string) error {
-	img, _, err := client.ImageInspectWithRaw(ctx, image)
-	if err != nil {
-		return err
+// pushTargets pushes the retagged images of image to the targets at the given indexes in parallel,
+// copying their artifacts as well when configured. The results are in the order of the indexes.
+func (d *Syncer) pushTargets(image string, indexes []int, targets []string) []pushResult {
+	results := make([]pushResult, len(indexes))
+	var wg mutex.WaitGroup
+	for k, j := range indexes {
+		wg.Add(1)
+		go func(r *pushResult, t pkg.Target, p provider.Provider, reTaggedImage string) {
+			defer wg.Done()
+			start := time.Now()
+			defer func() {
+				r.duration = time.Since(start)
+			}()
+			if p != nil {
+				if r.err = d.ensureRepository(p, t, reTaggedImage); r.err != nil {
+					return
+				}
+			}
+			if ratelimit.For(t.Hostname).Throttled() {
+				// the daemon can't be throttled, the image is copied from the source registry instead
+				if r.digest, r.err = d.CopyWithDisplay(image, reTaggedImage, t); r.err != nil {
+					return
+				}
+			} else {
+				if r.err = d.Push(reTaggedImage, t); r.err != nil {
+					return
+				}
+				r.digest = d.pushedDigest(reTaggedImage)
+			}
+			if d.CopyArtifacts {
+				r.artifacts, r.artifactErr = d.MirrorArtifacts(image, reTaggedImage, t)
+			}
+		}(&results[k], d.Targets[j], d.providers[j], targets[j])
 	}
-	// force delete the image using its ID
-	_, err = client.ImageRemove(ctx, img.ID, types.ImageRemoveOptions{
-		Force:         true,
-		PruneChildren: true,
-	})
-	return err
+	wg.Wait()
+	return results
+}
+
+// RemoveImage removes references, the tags of an image, from the local docker storage. The image itself is
+// deleted along with its last tag, unless a container uses it, so images other workloads rely on are left alone.
+func RemoveImage(ctx context.Context, dockerClient *client.Client, references ...string) error {
+	for _, reference := range references {
+		_, err := dockerClient.ImageRemove(ctx, reference, types.ImageRemoveOptions{
+			PruneChildren: true,
+		})
+		if err != nil && !client.IsErrNotFound(err) {
+			return err
+		}
+	}
+	return nil
 }
 
 func Retag(ctx context.Context, client *client.Client, image, reTaggedImage string) (string, error) {
@@ -113,59 +460,129 @@ func Retag(ctx context.Context, client *client.Client, image, reTaggedImage stri
 
 // push / pull logic
 
-func PushWithDisplayFunc(ctx context.Context, client *client.Client, reTaggedImage, hostname, auth string, f func(scanner *bufio.Scanner, op, image, hostname string)) error {
+func PushWithDisplay(ctx context.Context, client *client.Client, reTaggedImage, hostname, auth string, disp display.Display) error {
+	done, err := limitTransfer(ctx, hostname)
+	if err != nil {
+		return err
+	}
+	op := disp.Start(hostname, "Pushing", reTaggedImage)
 	r, err := client.ImagePush(ctx, reTaggedImage, pkg.BuildPushOptions(auth, hostname))
 	if err != nil {
+		done(0)
+		op.Done(err)
 		return err
 	}
 	defer r.Close()
-	f(bufio.NewScanner(r), "Pushing", reTaggedImage, hostname)
-	return nil
+	layers, err := streamStatus(bufio.NewScanner(r), "Pushing", reTaggedImage, hostname, op)
+	done(layers)
+	op.Done(err)
+	return err
 }
 
-func PullWithDisplayFunc(ctx context.Context, client *client.Client, image, hostname, auth string, f func(scanner *bufio.Scanner, op, image, hostname string)) error {
+// PullWithDisplay pulls image into the docker daemon. clients returns the registry client used for the registry of image,
+// which loads the image itself when the bandwidth of the registry is limited, see LoadWithDisplay. Images referenced
+// by digest are always pulled by the daemon, since loaded images can't be named by their digest.
+func PullWithDisplay(ctx context.Context, client *client.Client, clients func(host string) *registry.Client, image, hostname, auth string, disp display.Display) error {
+	done := func(int) {}
+	if ref, err := registry.ParseReference(image); err == nil {
+		if ratelimit.For(ref.Registry).Throttled() && ref.Digest == "" {
+			return LoadWithDisplay(ctx, client, clients(ref.Registry), image, hostname, disp)
+		}
+		if ref.Registry == registry.DockerHub {
+			// HEAD requests don't count against the pull limit of Docker Hub, but report the
+			// pulls remaining, so the pull can wait instead of failing once none are left
+			clients(ref.Registry).Head(ctx, ref.Repository, ref.Reference())
+		}
+		if done, err = limitTransfer(ctx, ref.Registry); err != nil {
+			return err
+		}
+	}
+	op := disp.Start(hostname, "Pulling", image)
 	r, err := client.ImagePull(ctx, image, pkg.BuildPullOptions(auth, hostname))
 	if err != nil {
+		done(0)
 		if strings.Contains(err.Error(), "repository does not exist") {
-			return pkg.ImageNotFound
+			err = pkg.ImageNotFound
 		}
+		op.Done(err)
 		return err
 	}
 	defer r.Close()
-	f(bufio.NewScanner(r), "Pulling", image, hostname)
-	return nil
+	layers, err := streamStatus(bufio.NewScanner(r), "Pulling", image, hostname, op)
+	done(layers)
+	op.Done(err)
+	return err
 }
 
-// push / pull display logic
-
-func PushPullSpinner(scanner *bufio.Scanner, op, image, _ string) {
-	spinner, _ := yacspin.New(cfg)
-	spinner.Suffix(fmt.Sprintf("[%s] %s %s", time.Now().Format(pkg.TimeFormat), op, image))
-	spinner.Start()
-	defer spinner.Stop()
+// limitTransfer waits until the docker daemon may pull from, or push to, host. The returned
+// function must be called with the number of layers transferred once the daemon is done, which
+// are accounted for in the request rate of host.
+func limitTransfer(ctx context.Context, host string) (func(layers int), error) {
+	l := ratelimit.For(host)
+	if err := l.Wait(ctx); err != nil {
+		return nil, err
+	}
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(layers int) {
+		release()
+		l.Charge(layers)
+	}, nil
+}
 
-	var status DockerStatusOutput
-	for {
-		if !scanner.Scan() {
-			spinner.Suffix(fmt.Sprintf("[%s] Done pushing %s", time.Now().Format(pkg.TimeFormat), image))
-			break
+// streamStatus decodes the docker daemons JSON progress output, passing each line to the
+// display operation and the event bus. The number of layers transferred is returned, along
+// with an error if the daemon reports one.
+func streamStatus(scanner *bufio.Scanner, op, image, hostname string, dispOp display.Operation) (int, error) {
+	layers := 0
+	for scanner.Scan() {
+		var status pkg.DockerStatusOutput
+		if err := json.Unmarshal(scanner.Bytes(), &status); err != nil {
+			continue
+		}
+		publishStatus(status, op, image, hostname)
+		dispOp.Update(status)
+		if status.Error != "" {
+			return layers, errors.New(status.Error)
+		}
+		if status.Status == "Pull complete" || status.Status == "Pushed" {
+			layers++
 		}
-		json.Unmarshal(scanner.Bytes(), &status)
-		spinner.Message(fmt.Sprintf("%s %s", status.Status, status.Progress))
 	}
+	return layers, scanner.Err()
 }
 
-func PushPullStdDisplay(scanner *bufio.Scanner, _, image, hostname string) {
-	var status DockerStatusOutput
-	for {
-		if !scanner.Scan() {
-			break
+// publishStatus publishes a line of docker status output on the event bus.
+func publishStatus(status pkg.DockerStatusOutput, op, image, hostname string) {
+	events.Publish(events.Event{
+		Registry: hostname,
+		Image:    image,
+		Stage:    op,
+		LayerID:  status.ID,
+		Status:   status.Status,
+		Current:  status.ProgressDetail.Current,
+		Total:    status.ProgressDetail.Total,
+	})
+}
+
+// runGates runs the gates of the given phase against image, appending their results. The
+// first gate which did not pass is returned, in which case its result is the last one appended.
+func (d *Syncer) runGates(beforePull bool, image string, results *[]pkg.GateResult) (Gate, error) {
+	for _, g := range d.Gates {
+		if g.BeforePull() != beforePull {
+			continue
+		}
+		d.setStage(g.Name())
+		result, err := g.Check(d.Context, image)
+		if err != nil {
+			return nil, err
 		}
-		json.Unmarshal(scanner.Bytes(), &status)
-		if status.Progress == "" {
-			fmt.Println(fmt.Sprintf("%s: %s:", hostname, status.Status))
-		} else {
-			fmt.Println(fmt.Printf("%s: %s: %s", image, status.Status, status.Progress))
+		*results = append(*results, result)
+		if !result.Passed {
+			return g, nil
 		}
 	}
+	return nil, nil
 }
@@ -0,0 +1,166 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/bundle"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	pkg.Logger = logrus.New()
+	pkg.Logger.SetOutput(io.Discard)
+	pkg.ErrLogger = logrus.New()
+	pkg.ErrLogger.SetOutput(io.Discard)
+}
+
+// newTestSyncer builds a Syncer whose script lists images, pulling them from src.
+func newTestSyncer(t *testing.T, src *registrytest.Server, registry pkg.Registry, images ...string) *Syncer {
+	if registry.Catalog == nil && registry.Kubernetes == nil && registry.Helm == nil {
+		script := filepath.Join(t.TempDir(), "images.sh")
+		content := "#!/bin/sh\n"
+		for _, image := range images {
+			content += "echo " + image + "\n"
+		}
+		assert.Equal(t, os.WriteFile(script, []byte(content), 0755), nil)
+		registry.SyncerScript = script
+	}
+	viper.Set("state.dir", t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	d, _, err := BuildRegistrySyncer(ctx, cancel, registry, &display.Logs{})
+	assert.Equal(t, err, nil)
+	d.registryClient(src.Host, "").Scheme = "http"
+	return d
+}
+
+func statuses(report pkg.RunReport) map[string]pkg.ImageStatus {
+	s := make(map[string]pkg.ImageStatus)
+	for _, i := range report.Images {
+		s[i.Target] = i.Status
+	}
+	return s
+}
+
+func TestProcessLayout(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	src.PushImage("rancher/shell", "v0.1.19", "base layer", "shell layer")
+	src.PushImage("rancher/kubectl", "latest", "base layer", "kubectl layer")
+
+	layout := filepath.Join(t.TempDir(), "layout")
+	shell := src.Host + "/rancher/shell:v0.1.19"
+	kubectl := src.Host + "/rancher/kubectl:latest"
+	d := newTestSyncer(t, src, pkg.Registry{Hostname: "edge.local", Repository: "mirror", Layout: layout}, shell, kubectl, src.Host+"/rancher/missing:v1")
+
+	d.Process()
+	report, _ := d.Reports.Latest()
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		"edge.local/mirror/" + shell:                            pkg.ImagePushed,
+		"edge.local/mirror/" + kubectl:                          pkg.ImagePushed,
+		"edge.local/mirror/" + src.Host + "/rancher/missing:v1": pkg.ImageFailed,
+	})
+
+	// images already in the layout are skipped, unless they are tagged latest
+	d.Process()
+	report, _ = d.Reports.Latest()
+	assert.Equal(t, statuses(report)["edge.local/mirror/"+shell], pkg.ImageSkipped)
+	assert.Equal(t, statuses(report)["edge.local/mirror/"+kubectl], pkg.ImagePushed)
+
+	r, err := bundle.Open(layout)
+	assert.Equal(t, err, nil)
+	defer r.Close()
+	assert.Equal(t, len(r.Index.Manifests), 2)
+	assert.Equal(t, r.Index.Manifests[0].Annotations[bundle.ImageNameAnnotation], "edge.local/mirror/"+shell)
+	assert.Equal(t, r.Index.Manifests[0].Annotations[bundle.RefNameAnnotation], "v0.1.19")
+	desc, err := src.Client("").Head(context.Background(), "rancher/kubectl", "latest")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, r.Index.Manifests[1].Digest, desc.Digest)
+
+	// the layout can be served by a registry
+	dst := registrytest.NewServer()
+	defer dst.Close()
+	results, err := r.Import(context.Background(), dst.Client(""), "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, results[0].Err, nil)
+	ref, _ := registry.ParseReference(results[0].Target)
+	assert.Equal(t, dst.Tags(ref.Repository), []string{"v0.1.19"})
+}
+
+func TestBuildTargets(t *testing.T) {
+	targets, err := buildTargets(pkg.Registry{
+		Hostname:       "my-registry.space",
+		Repository:     "mirror",
+		PushAuthConfig: "user:password",
+		Targets: []pkg.Target{
+			{Hostname: "dr.my-registry.space"},
+			{Hostname: "my-registry.space", Repository: "backup", PushAuthConfig: "backup:password"},
+		},
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, targets, []pkg.Target{
+		{Hostname: "my-registry.space", Repository: "mirror", PushAuthConfig: "user:password"},
+		{Hostname: "dr.my-registry.space", Repository: "mirror", PushAuthConfig: "user:password"},
+		{Hostname: "my-registry.space", Repository: "backup", PushAuthConfig: "backup:password"},
+	})
+
+	for _, conf := range []pkg.Registry{
+		{Hostname: "my-registry.space", Targets: []pkg.Target{{Repository: "mirror"}}},
+		{Hostname: "my-registry.space", Targets: []pkg.Target{{Hostname: "my-registry.space"}}},
+		{Hostname: "my-registry.space", Layout: "layout", Targets: []pkg.Target{{Hostname: "dr.my-registry.space"}}},
+	} {
+		_, err := buildTargets(conf)
+		assert.Equal(t, err != nil, true)
+	}
+}
+
+// recordingProvider records the repositories it was asked to create.
+type recordingProvider struct {
+	repositories []string
+}
+
+func (p *recordingProvider) Name() string { return "recording" }
+
+func (p *recordingProvider) EnsureRepository(_ context.Context, repository string) error {
+	p.repositories = append(p.repositories, repository)
+	return nil
+}
+
+func TestBuildProviders(t *testing.T) {
+	conf := pkg.Registry{
+		Hostname:         "harbor.local",
+		Repository:       "mirror",
+		PushAuthConfig:   "robot:token",
+		RegistryProvider: "harbor",
+		Targets:          []pkg.Target{{Hostname: "dr.local", RegistryProvider: "docker"}, {Hostname: "backup.local"}},
+	}
+	targets, err := buildTargets(conf)
+	assert.Equal(t, err, nil)
+	providers, err := buildProviders(conf, targets)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, providers[0].Name(), "harbor https://harbor.local")
+	assert.Equal(t, providers[1], nil)
+	assert.Equal(t, providers[2].Name(), "harbor https://backup.local")
+
+	// repositories are named without the registry host, tag, or digest
+	p := &recordingProvider{}
+	d := &Syncer{Context: context.Background()}
+	target := pkg.Target{Hostname: "harbor.local:8443"}
+	assert.Equal(t, d.ensureRepository(p, target, "harbor.local:8443/mirror/rancher/shell:v0.1.19"), nil)
+	assert.Equal(t, d.ensureRepository(p, target, "harbor.local:8443/mirror/rancher/kubectl@sha256:1a2b"), nil)
+	assert.Equal(t, p.repositories, []string{"mirror/rancher/shell", "mirror/rancher/kubectl"})
+
+	_, err = buildProviders(pkg.Registry{Hostname: "harbor.local", RegistryProvider: "harbor", Layout: "layout"}, []pkg.Target{{Hostname: "harbor.local", RegistryProvider: "harbor"}})
+	assert.Equal(t, err.Error(), "registryProvider harbor is not supported for layouts")
+}
@@ -0,0 +1,269 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/state"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PruneSourceState prunes the images picture-book recorded pushing
+	PruneSourceState = "state"
+	// PruneSourceRegistry prunes every tag found under the configured repository
+	PruneSourceRegistry = "registry"
+
+	defaultGracePeriod = 24 * time.Hour
+)
+
+// artifactSuffixes are the suffixes of the tags cosign and the referrers fallback
+// attach to an image, which are removed along with it.
+var artifactSuffixes = []string{"", ".sig", ".att", ".sbom"}
+
+// pruneGracePeriod validates the prune configuration of a registry, returning its grace period.
+func pruneGracePeriod(conf pkg.PruneConfig, targets []pkg.Target, layout string) (time.Duration, error) {
+	if !conf.Enabled {
+		return 0, nil
+	}
+	if layout != "" {
+		return 0, errors.New("pruning is not supported for layouts")
+	}
+	switch conf.Source {
+	case "", PruneSourceState:
+	case PruneSourceRegistry:
+		for _, t := range targets {
+			if t.Repository == "" {
+				return 0, fmt.Errorf("pruning tags from %s requires a repository, or every image on the registry would be considered", t.Hostname)
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown prune source %s, expected %s or %s", conf.Source, PruneSourceState, PruneSourceRegistry)
+	}
+	if conf.GracePeriod == "" {
+		return defaultGracePeriod, nil
+	}
+	grace, err := time.ParseDuration(conf.GracePeriod)
+	if err != nil {
+		return 0, fmt.Errorf("invalid prune grace period %s: %w", conf.GracePeriod, err)
+	}
+	return grace, nil
+}
+
+// targetOf returns the target an image was pushed to, which is the one with the longest matching hostname.
+func (d *Syncer) targetOf(image string) pkg.Target {
+	var match pkg.Target
+	for _, t := range d.Targets {
+		if strings.HasPrefix(image, t.Hostname+"/") && len(t.Hostname) > len(match.Hostname) {
+			match = t
+		}
+	}
+	if match.Hostname == "" && len(d.Targets) > 0 {
+		return d.Targets[0]
+	}
+	return match
+}
+
+// splitTarget splits an image on a target registry into its repository and tag or digest.
+func (d *Syncer) splitTarget(target string) (string, string) {
+	rest := strings.TrimPrefix(target, d.targetOf(target).Hostname+"/")
+	if i := strings.Index(rest, "@"); i >= 0 {
+		return rest[:i], rest[i+1:]
+	}
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.Contains(rest[i+1:], "/") {
+		return rest[:i], rest[i+1:]
+	}
+	return rest, "latest"
+}
+
+// stateKey is the name an image on a target registry is recorded under, with untagged images tagged latest.
+func (d *Syncer) stateKey(target string) string {
+	host := d.targetOf(target).Hostname
+	repo, reference := d.splitTarget(target)
+	if strings.Contains(reference, ":") {
+		return host + "/" + repo + "@" + reference
+	}
+	return host + "/" + repo + ":" + reference
+}
+
+// recordImages updates the state with the outcome of a run. listed maps the state key of every
+// image listed by the syncer script to the image itself, and sourceDigests the images to their digest at the source.
+func (d *Syncer) recordImages(report *pkg.RunReport, listed, sourceDigests map[string]string, now time.Time) {
+	mirrored := make(map[string]bool)
+	digests := make(map[string]string)
+	for _, i := range report.Images {
+		if i.Status == pkg.ImagePushed || i.Status == pkg.ImageSkipped || i.Status == pkg.ImageUnchanged {
+			mirrored[d.stateKey(i.Target)] = true
+		}
+		if i.Status == pkg.ImagePushed && i.Digest != "" {
+			digests[d.stateKey(i.Target)] = i.Digest
+		}
+	}
+	d.State.Update(func(images map[string]*state.Image) {
+		for key, image := range listed {
+			img, ok := images[key]
+			if !ok {
+				if !mirrored[key] {
+					continue
+				}
+				img = &state.Image{}
+				images[key] = img
+			}
+			img.Source = image
+			img.LastListed = now
+			img.StaleSince = time.Time{}
+			if digest, ok := digests[key]; ok {
+				img.Digest = digest
+			}
+			if digest := sourceDigests[image]; digest != "" && mirrored[key] {
+				img.SourceDigest = digest
+			}
+		}
+	})
+}
+
+// prune deletes the images which were not listed by the syncer script for longer than the grace period.
+func (d *Syncer) prune(report *pkg.RunReport, listed map[string]string, now time.Time, log, errLog *logrus.Entry) {
+	d.setStage("pruning")
+	log = log.WithField("stage", "pruning")
+	errLog = errLog.WithField("stage", "pruning")
+
+	var registryTags []string
+	if d.Prune.Source == PruneSourceRegistry {
+		for _, t := range d.Targets {
+			tags, err := d.repositoryTags(t)
+			if err != nil {
+				errLog.Errorf("Could not list the images under %s/%s, only images recorded in the state will be pruned: %v", t.Hostname, t.Repository, err)
+			}
+			registryTags = append(registryTags, tags...)
+		}
+	}
+
+	var stale []string
+	sources := make(map[string]string)
+	d.State.Update(func(images map[string]*state.Image) {
+		for _, key := range registryTags {
+			if _, ok := images[key]; !ok {
+				images[key] = &state.Image{}
+			}
+		}
+		for key, img := range images {
+			if _, ok := listed[key]; ok {
+				continue
+			}
+			if img.StaleSince.IsZero() {
+				img.StaleSince = now
+			}
+			if now.Sub(img.StaleSince) < d.pruneGrace {
+				log.WithField("target", key).Debugf("%s is stale since %s, it will be pruned after %s", key, img.StaleSince.Format(pkg.TimeFormat), d.pruneGrace)
+				continue
+			}
+			stale = append(stale, key)
+			sources[key] = img.Source
+		}
+	})
+	sort.Strings(stale)
+
+	for _, target := range stale {
+		imgLog := log.WithFields(logrus.Fields{"image": sources[target], "target": target})
+		if d.Prune.DryRun {
+			imgLog.Infof("Would prune %s", target)
+			report.Add(sources[target], target, pkg.ImageStale, nil)
+			continue
+		}
+		t := d.targetOf(target)
+		op := d.Display.Start(t.Hostname, "Pruning", target)
+		err := d.deleteImage(d.registryClient(t.Hostname, t.PushAuthConfig), target, listed)
+		op.Done(err)
+		if err != nil {
+			errLog.WithFields(logrus.Fields{"image": sources[target], "target": target}).Errorf("Could not prune %s: %v", target, err)
+			report.Add(sources[target], target, pkg.ImageFailed, fmt.Errorf("could not prune: %w", err))
+			continue
+		}
+		imgLog.Infof("Pruned %s", target)
+		report.Add(sources[target], target, pkg.ImagePruned, nil)
+		d.State.Update(func(images map[string]*state.Image) {
+			delete(images, target)
+		})
+	}
+}
+
+// repositoryTags lists the images found under the repository of t, leaving out the tags of signatures and other artifacts.
+func (d *Syncer) repositoryTags(t pkg.Target) ([]string, error) {
+	c := d.registryClient(t.Hostname, t.PushAuthConfig)
+	repos, err := c.Catalog(d.Context)
+	if err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, repo := range repos {
+		if !strings.HasPrefix(repo, t.Repository+"/") {
+			continue
+		}
+		tags, err := c.Tags(d.Context, repo)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			if !strings.HasPrefix(tag, "sha256-") {
+				images = append(images, t.Hostname+"/"+repo+":"+tag)
+			}
+		}
+	}
+	return images, nil
+}
+
+// deleteImage deletes target from the registry, along with the signatures and attestations tagged after it.
+// Registries which can't delete tags require the manifest to be deleted, which is refused when an image
+// that is still listed shares it.
+func (d *Syncer) deleteImage(c *registry.Client, target string, listed map[string]string) error {
+	host := d.targetOf(target).Hostname
+	repo, reference := d.splitTarget(target)
+	desc, err := c.Head(d.Context, repo, reference)
+	if errors.Is(err, registry.ErrNotFound) {
+		// already deleted by someone else
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = registry.ErrUnsupported
+	if !strings.Contains(reference, ":") {
+		err = c.DeleteManifest(d.Context, repo, reference)
+	}
+	if errors.Is(err, registry.ErrUnsupported) {
+		for key := range listed {
+			listedRepo, listedReference := d.splitTarget(key)
+			if d.targetOf(key).Hostname != host || listedRepo != repo {
+				continue
+			}
+			if other, err := c.Head(d.Context, repo, listedReference); err == nil && other.Digest == desc.Digest {
+				return fmt.Errorf("%s shares its manifest with %s, which is still listed", target, key)
+			}
+		}
+		err = c.DeleteManifest(d.Context, repo, desc.Digest)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, suffix := range artifactSuffixes {
+		artifact, err := c.Head(d.Context, repo, registry.ReferrersTag(desc.Digest)+suffix)
+		if errors.Is(err, registry.ErrNotFound) {
+			continue
+		}
+		if err == nil {
+			err = c.DeleteManifest(d.Context, repo, artifact.Digest)
+		}
+		if err != nil {
+			return fmt.Errorf("image was deleted, but not its artifacts: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/state"
+	"github.com/magiconair/properties/assert"
+	"github.com/spf13/viper"
+)
+
+// pruneRun records a run of the syncer which listed images at now, and prunes the images it did not list.
+func pruneRun(d *Syncer, now time.Time, mirrored []string, images ...string) pkg.RunReport {
+	report := pkg.NewRunReport(d.RegistryHostName)
+	listed := make(map[string]string)
+	for _, image := range images {
+		target := pkg.ReTag(image, d.RegistryHostName, d.Repository)
+		listed[d.stateKey(target)] = image
+	}
+	for _, image := range mirrored {
+		report.Add(image, pkg.ReTag(image, d.RegistryHostName, d.Repository), pkg.ImagePushed, nil)
+	}
+	d.recordImages(report, listed, nil, now)
+	d.prune(report, listed, now, pkg.Logger.WithField("test", true), pkg.ErrLogger.WithField("test", true))
+	return *report
+}
+
+func TestPrune(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	dst := registrytest.NewServer()
+	defer dst.Close()
+	shared := dst.PushImage("mirror/rancher/shell", "v1", "shell layer")
+	b, _, _ := dst.Client("").GetManifest(context.Background(), "mirror/rancher/shell", "v1")
+	dst.Client("").PutManifest(context.Background(), "mirror/rancher/shell", "v2", shared.MediaType, b)
+	old := dst.PushImage("mirror/rancher/old", "v1", "old layer")
+	dst.PushImage("mirror/rancher/old", registry.ReferrersTag(old.Digest)+".sig", "signature layer")
+	dst.PushImage("mirror/rancher/unknown", "v1", "unknown layer")
+
+	d := newTestSyncer(t, src, pkg.Registry{Hostname: dst.Host, Repository: "mirror", Prune: pkg.PruneConfig{Enabled: true, GracePeriod: "1h"}})
+	d.registryClient(dst.Host, "").Scheme = "http"
+	images := []string{"rancher/shell:v1", "rancher/shell:v2", "rancher/old:v1"}
+
+	start := time.Now()
+	report := pruneRun(d, start, images, images...)
+	assert.Equal(t, len(report.Images), 3)
+	assert.Equal(t, len(d.State.Images), 3)
+
+	// stale images are kept during the grace period
+	report = pruneRun(d, start.Add(30*time.Minute), nil, "rancher/shell:v1")
+	assert.Equal(t, len(report.Images), 0)
+
+	// a listed image reappearing is no longer stale
+	pruneRun(d, start.Add(40*time.Minute), nil, "rancher/shell:v1", "rancher/shell:v2")
+	report = pruneRun(d, start.Add(80*time.Minute), nil, "rancher/shell:v1")
+	assert.Equal(t, len(report.Images), 0)
+
+	report = pruneRun(d, start.Add(3*time.Hour), nil, "rancher/shell:v1")
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		dst.Host + "/mirror/rancher/old:v1": pkg.ImagePruned,
+		// the registry can't delete tags, and the manifest is shared with a listed image
+		dst.Host + "/mirror/rancher/shell:v2": pkg.ImageFailed,
+	})
+	assert.Equal(t, dst.HasManifest("mirror/rancher/old", old.Digest), false)
+	assert.Equal(t, len(dst.Tags("mirror/rancher/old")), 0)
+	assert.Equal(t, dst.HasManifest("mirror/rancher/shell", shared.Digest), true)
+	// images picture-book did not push are left alone
+	assert.Equal(t, dst.Tags("mirror/rancher/unknown"), []string{"v1"})
+
+	// the state survives restarts
+	loaded, err := state.Load(viper.GetString("state.dir"), dst.Host)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(loaded.Images), 0)
+	assert.Equal(t, d.State.Save(), nil)
+	loaded, err = state.Load(viper.GetString("state.dir"), dst.Host)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(loaded.Images), 2)
+	assert.Equal(t, loaded.Images[dst.Host+"/mirror/rancher/shell:v1"].Source, "rancher/shell:v1")
+}
+
+func TestPruneRegistryDryRun(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	dst := registrytest.NewServer()
+	defer dst.Close()
+	dst.PushImage("mirror/rancher/shell", "v1", "shell layer")
+	dst.PushImage("mirror/rancher/unknown", "v1", "unknown layer")
+	dst.PushImage("other/rancher/unknown", "v1", "unknown layer")
+
+	d := newTestSyncer(t, src, pkg.Registry{Hostname: dst.Host, Repository: "mirror", Prune: pkg.PruneConfig{Enabled: true, Source: PruneSourceRegistry, GracePeriod: "0s", DryRun: true}})
+	d.registryClient(dst.Host, "").Scheme = "http"
+
+	report := pruneRun(d, time.Now(), nil, "rancher/shell:v1")
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		dst.Host + "/mirror/rancher/unknown:v1": pkg.ImageStale,
+	})
+	assert.Equal(t, dst.Tags("mirror/rancher/unknown"), []string{"v1"})
+
+	d.Prune.DryRun = false
+	report = pruneRun(d, time.Now(), nil, "rancher/shell:v1")
+	assert.Equal(t, statuses(report)[dst.Host+"/mirror/rancher/unknown:v1"], pkg.ImagePruned)
+	assert.Equal(t, len(dst.Tags("mirror/rancher/unknown")), 0)
+	assert.Equal(t, dst.Tags("other/rancher/unknown"), []string{"v1"})
+}
+
+func TestPruneConfig(t *testing.T) {
+	for _, conf := range []pkg.Registry{
+		{Hostname: "my-registry.space", Prune: pkg.PruneConfig{Enabled: true, Source: PruneSourceRegistry}},
+		{Hostname: "my-registry.space", Prune: pkg.PruneConfig{Enabled: true, Source: "catalog"}},
+		{Hostname: "my-registry.space", Prune: pkg.PruneConfig{Enabled: true, GracePeriod: "a week"}},
+		{Hostname: "my-registry.space", Layout: "layout", Prune: pkg.PruneConfig{Enabled: true}},
+	} {
+		_, err := pruneGracePeriod(conf.Prune, []pkg.Target{{Hostname: conf.Hostname, Repository: conf.Repository}}, conf.Layout)
+		assert.Equal(t, err != nil, true, conf.Prune.Source+conf.Prune.GracePeriod+conf.Layout)
+	}
+	grace, err := pruneGracePeriod(pkg.PruneConfig{Enabled: true}, []pkg.Target{{Hostname: "my-registry.space"}}, "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, grace, 24*time.Hour)
+}
+
+func TestPruneTargets(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	primary := registrytest.NewServer()
+	defer primary.Close()
+	dr := registrytest.NewServer()
+	defer dr.Close()
+	for _, dst := range []*registrytest.Server{primary, dr} {
+		dst.PushImage("mirror/rancher/shell", "v1", "shell layer")
+		dst.PushImage("mirror/rancher/old", "v1", "old layer")
+	}
+
+	d := newTestSyncer(t, src, pkg.Registry{
+		Hostname:   primary.Host,
+		Repository: "mirror",
+		Prune:      pkg.PruneConfig{Enabled: true, Source: PruneSourceRegistry, GracePeriod: "0s"},
+		Targets:    []pkg.Target{{Hostname: dr.Host}},
+	})
+	d.registryClient(primary.Host, "").Scheme = "http"
+	d.registryClient(dr.Host, "").Scheme = "http"
+
+	listed := make(map[string]string)
+	for _, target := range d.Targets {
+		listed[d.stateKey(pkg.ReTag("rancher/shell:v1", target.Hostname, target.Repository))] = "rancher/shell:v1"
+	}
+	assert.Equal(t, len(listed), 2)
+
+	report := pkg.NewRunReport(d.RegistryHostName)
+	d.prune(report, listed, time.Now(), pkg.Logger.WithField("test", true), pkg.ErrLogger.WithField("test", true))
+	assert.Equal(t, statuses(*report), map[string]pkg.ImageStatus{
+		primary.Host + "/mirror/rancher/old:v1": pkg.ImagePruned,
+		dr.Host + "/mirror/rancher/old:v1":      pkg.ImagePruned,
+	})
+	for _, dst := range []*registrytest.Server{primary, dr} {
+		assert.Equal(t, len(dst.Tags("mirror/rancher/old")), 0)
+		assert.Equal(t, dst.Tags("mirror/rancher/shell"), []string{"v1"})
+	}
+}
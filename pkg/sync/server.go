@@ -28,5 +28,34 @@ func StartServer(pool *SyncerPool) {
 		EnableAuth: viper.GetBool("api.enableAuth"),
 	})
 
+	mux.Handle("/status", &Handler{
+		Pool:       pool,
+		H:          h.Status,
+		Token:      viper.GetString("api.authToken"),
+		EnableAuth: viper.GetBool("api.enableAuth"),
+	})
+
+	mux.Handle("/history", &Handler{
+		Pool:       pool,
+		H:          h.History,
+		Token:      viper.GetString("api.authToken"),
+		EnableAuth: viper.GetBool("api.enableAuth"),
+	})
+
+	mux.Handle("/events", &Handler{
+		Pool:       pool,
+		H:          h.Events,
+		Token:      viper.GetString("api.authToken"),
+		EnableAuth: viper.GetBool("api.enableAuth"),
+	})
+
+	// registries authenticate with the secret of each job's webhook, as most can't send the API token
+	mux.Handle("/webhook", &Handler{
+		Pool: pool,
+		H:    h.Webhook,
+	})
+
+	mux.Handle("/", DashboardHandler())
+
 	http.ListenAndServe(":"+viper.GetString("api.port"), mux)
 }
@@ -0,0 +1,42 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/kube"
+)
+
+func init() {
+	pkg.RegisterSource("catalog", newCatalogSource)
+	pkg.RegisterSource("kubernetes", newKubernetesSource)
+	pkg.RegisterSource("helm", newHelmSource)
+}
+
+// kubernetesSource lists the images run by the workloads of a cluster.
+type kubernetesSource struct {
+	conf pkg.KubernetesConfig
+}
+
+func newKubernetesSource(conf pkg.SourceConfig, _ pkg.Registry) (pkg.ImageSource, error) {
+	if conf.Kubernetes == nil {
+		return nil, errors.New("kubernetes sources require a kubernetes configuration")
+	}
+	return &kubernetesSource{conf: *conf.Kubernetes}, nil
+}
+
+func (s *kubernetesSource) Name() string { return "kubernetes cluster" }
+
+func (s *kubernetesSource) Images(ctx context.Context) ([]string, error) {
+	client, err := kube.NewClient(s.conf)
+	if err != nil {
+		return nil, err
+	}
+	images, err := kube.Discover(ctx, client, s.conf.Namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("could not discover images: %w", err)
+	}
+	return images, nil
+}
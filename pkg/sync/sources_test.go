@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestSourcesConfig(t *testing.T) {
+	for _, conf := range []pkg.Registry{
+		{Hostname: "my-registry.space"},
+		{Hostname: "my-registry.space", Catalog: &pkg.CatalogConfig{}},
+		{Hostname: "my-registry.space", Helm: &pkg.HelmConfig{}},
+		{Hostname: "my-registry.space", Helm: &pkg.HelmConfig{Chart: "web", Manifests: "manifests"}},
+		{Hostname: "my-registry.space", Helm: &pkg.HelmConfig{Manifests: "manifests", Push: true}},
+		{Hostname: "my-registry.space", Layout: "layout", Helm: &pkg.HelmConfig{Chart: "web", Push: true}},
+		{Hostname: "my-registry.space", Sources: []pkg.SourceConfig{{Type: "kubernetes"}}},
+	} {
+		_, err := pkg.NewSources(conf)
+		assert.Equal(t, err != nil, true)
+	}
+
+	// every source of a registry is used
+	sources, err := pkg.NewSources(pkg.Registry{
+		Hostname:     "my-registry.space",
+		SyncerScript: "images.sh",
+		Catalog:      &pkg.CatalogConfig{Registry: "internal.space"},
+		Sources: []pkg.SourceConfig{
+			{Type: "kubernetes", Kubernetes: &pkg.KubernetesConfig{}},
+			{Type: "helm", Helm: &pkg.HelmConfig{Chart: "web"}},
+		},
+	})
+	assert.Equal(t, err, nil)
+	var names []string
+	for _, s := range sources {
+		names = append(names, s.Name())
+	}
+	assert.Equal(t, names, []string{"syncer script images.sh", "catalog of internal.space", "kubernetes cluster", "chart web"})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg"
 	"github.com/HarrisonWAffel/playground/picture-book/pkg/config"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
 
 	"github.com/go-co-op/gocron"
 	"github.com/spf13/viper"
@@ -14,25 +15,35 @@ import (
 
 func BeginSynchronization(ctx *cli.Context) error {
 	pkg.Logger.Infof("Setting up registry synchronizers")
+	disp, err := display.New(viper.GetString("display"))
+	if err != nil {
+		return err
+	}
+
 	cronRunner := gocron.NewScheduler(time.UTC)
 	pool := &SyncerPool{
+		Display:          disp,
 		Syncers:          make(map[string]*Syncer),
+		Reports:          make(map[string]*ReportLog),
 		CronJobScheduler: cronRunner,
 		Context:          ctx.Context,
 	}
 
 	for _, registry := range config.ConfiguredRegistries {
-		if _, ok := pool.Syncers[registry.Hostname]; ok {
-			return fmt.Errorf("fatal: dupliacte registry found (%s), each registry hostname may only be configured once", registry.Hostname)
+		name := registry.JobName()
+		if _, ok := pool.Reports[name]; ok {
+			return fmt.Errorf("fatal: duplicate job found (%s), jobs targeting the same registry must be given unique names", name)
 		}
 
-		syncer, _, err := SetupRegistryJob(registry, cronRunner)
+		pool.Reports[name] = NewReportLog(viper.GetInt("api.historySize"))
+		syncer, _, err := SetupRegistryJob(registry, cronRunner, disp)
 		if err != nil {
 			pkg.ErrLogger.Errorf("error encountered setting up registry sync: %v", err)
 			continue
 		}
 
-		pool.Syncers[registry.Hostname] = syncer
+		syncer.Reports = pool.Reports[name]
+		pool.Syncers[name] = syncer
 	}
 
 	if viper.GetBool("api.enabled") {
@@ -50,9 +61,9 @@ func BeginSynchronization(ctx *cli.Context) error {
 	return nil
 }
 
-func SetupRegistryJob(registry pkg.Registry, cronRunner *gocron.Scheduler) (*Syncer, *gocron.Job, error) {
+func SetupRegistryJob(registry pkg.Registry, cronRunner *gocron.Scheduler, disp display.Display) (*Syncer, *gocron.Job, error) {
 	ctx, cancel := context.WithCancel(context.Background())
-	syncer, tag, err := BuildRegistrySyncer(ctx, cancel, registry)
+	syncer, tag, err := BuildRegistrySyncer(ctx, cancel, registry, disp)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -6,13 +6,20 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"github.com/theckman/yacspin"
 	"io"
 	"net/http"
 	"strings"
+	mutex "sync"
 	"time"
 
 	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/bundle"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/events"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/provider"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/ratelimit"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/state"
 	"github.com/docker/docker/client"
 	"github.com/spf13/viper"
 )
@@ -22,15 +29,98 @@ type Syncer struct {
 	context.Context    `json:"-"`
 	context.CancelFunc `json:"-"`
 	pkg.SyncerBase
-	client *client.Client
+	// Reports holds the history of completed runs.
+	Reports *ReportLog `json:"-"`
+	// Display renders the progress of each operation.
+	Display display.Display `json:"-"`
+	// Gates are the checks images must pass before they are mirrored.
+	Gates []Gate `json:"-"`
+	// hooks are the commands run around synchronizations, keyed by their name.
+	hooks map[string]*hook
+	// providers prepare each of the Targets for pushes, nil for plain registries.
+	providers []provider.Provider
+	// Layout is the OCI layout images are written to, when the registry is a directory.
+	Layout *bundle.Writer `json:"-"`
+	// State records the images mirrored by previous runs.
+	State *state.Registry `json:"-"`
+	// Webhook maps the events of registry webhooks to the job, when set.
+	Webhook *pkg.WebhookConfig `json:"-"`
+	client  *client.Client
+
+	// runMu keeps runs of the job, scheduled or triggered by webhooks, from overlapping.
+	runMu mutex.Mutex
+
+	pruneGrace      time.Duration
+	reconcilePeriod time.Duration
+
+	progressMu mutex.RWMutex
+	progress   pkg.Progress
+
+	clientsMu mutex.Mutex
+	clients   map[string]*registry.Client
 }
 
-func BuildRegistrySyncer(ctx context.Context, cancel context.CancelFunc, registry pkg.Registry) (*Syncer, string, error) {
+func BuildRegistrySyncer(ctx context.Context, cancel context.CancelFunc, registry pkg.Registry, disp display.Display) (*Syncer, string, error) {
 	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return &Syncer{}, "", fmt.Errorf("could not create docker client for registry %s: %w", registry.Hostname, err)
 	}
-	tag := pkg.BuildCronJobTag(registry.Hostname)
+	gates, err := BuildGates(registry)
+	if err != nil {
+		return &Syncer{}, "", fmt.Errorf("could not set up registry %s: %w", registry.Hostname, err)
+	}
+	hooks, err := buildHooks(registry.Hooks)
+	if err != nil {
+		return &Syncer{}, "", fmt.Errorf("could not set up registry %s: %w", registry.Hostname, err)
+	}
+	var layout *bundle.Writer
+	if registry.Layout != "" {
+		if registry.CopyArtifacts {
+			return &Syncer{}, "", fmt.Errorf("could not set up registry %s: copyArtifacts is not supported for layouts", registry.Hostname)
+		}
+		if layout, err = bundle.OpenLayout(registry.Layout); err != nil {
+			return &Syncer{}, "", fmt.Errorf("could not set up registry %s: %w", registry.Hostname, err)
+		}
+	}
+	sources, err := pkg.NewSources(registry)
+	if err != nil {
+		return &Syncer{}, "", fmt.Errorf("could not set up registry %s: %w", registry.Hostname, err)
+	}
+	targets, err := buildTargets(registry)
+	if err != nil {
+		return &Syncer{}, "", fmt.Errorf("could not set up registry %s: %w", registry.Hostname, err)
+	}
+	providers, err := buildProviders(registry, targets)
+	if err != nil {
+		return &Syncer{}, "", fmt.Errorf("could not set up registry %s: %w", registry.Hostname, err)
+	}
+	var diskBudget int64
+	if registry.DiskBudget != "" {
+		if registry.DeleteLocalImages {
+			return &Syncer{}, "", fmt.Errorf("could not set up registry %s: deleteLocalImages and diskBudget can't be used together", registry.Hostname)
+		}
+		if diskBudget, err = pkg.ParseSize(registry.DiskBudget); err != nil {
+			return &Syncer{}, "", fmt.Errorf("could not set up registry %s: invalid disk budget %s: %w", registry.Hostname, registry.DiskBudget, err)
+		}
+	}
+	pruneGrace, err := pruneGracePeriod(registry.Prune, targets, registry.Layout)
+	if err != nil {
+		return &Syncer{}, "", fmt.Errorf("could not set up registry %s: %w", registry.Hostname, err)
+	}
+	var reconcilePeriod time.Duration
+	if registry.ReconcilePeriod != "" {
+		if reconcilePeriod, err = time.ParseDuration(registry.ReconcilePeriod); err != nil || reconcilePeriod <= 0 {
+			return &Syncer{}, "", fmt.Errorf("could not set up registry %s: invalid reconcile period %s", registry.Hostname, registry.ReconcilePeriod)
+		}
+	}
+	if registry.Webhook != nil && registry.Webhook.Secret == "" {
+		return &Syncer{}, "", fmt.Errorf("could not set up registry %s: webhooks require a secret", registry.Hostname)
+	}
+	registryState, err := state.Load(viper.GetString("state.dir"), registry.JobName())
+	if err != nil {
+		return &Syncer{}, "", fmt.Errorf("could not load the state of registry %s: %w", registry.Hostname, err)
+	}
+	tag := pkg.BuildCronJobTag(registry.JobName())
 	syncer := Syncer{
 		Context:    ctx,
 		CancelFunc: cancel,
@@ -38,23 +128,98 @@ func BuildRegistrySyncer(ctx context.Context, cancel context.CancelFunc, registr
 			Details: pkg.Details{
 				Created: time.Now(),
 			},
+			Name:              registry.JobName(),
 			JobTag:            tag,
-			RemoveLocalImages: registry.DeleteLocalImages,
+			RemoveLocalImages: registry.DeleteLocalImages && layout == nil,
+			DiskBudget:        diskBudget,
+			CopyArtifacts:     registry.CopyArtifacts,
+			Prune:             registry.Prune,
+			Targets:           targets,
 			RegistryHostName:  registry.Hostname,
 			Repository:        registry.Repository,
 			PullAuth:          registry.PullAuthConfig,
 			PushAuth:          registry.PushAuthConfig,
-			Executor: pkg.Executor{
-				File: registry.SyncerScript,
-				Args: registry.SyncerScriptArgs,
-			},
+			Sources:           sources,
 		},
-		client: dockerClient,
+		Reports:         NewReportLog(viper.GetInt("api.historySize")),
+		Display:         disp,
+		Gates:           gates,
+		hooks:           hooks,
+		providers:       providers,
+		Layout:          layout,
+		State:           registryState,
+		Webhook:         registry.Webhook,
+		client:          dockerClient,
+		pruneGrace:      pruneGrace,
+		reconcilePeriod: reconcilePeriod,
 	}
 
 	return &syncer, tag, nil
 }
 
+// buildTargets lists the registries the images of registry are pushed to, filling in the defaults of each.
+func buildTargets(registry pkg.Registry) ([]pkg.Target, error) {
+	targets := []pkg.Target{{
+		Hostname:         registry.Hostname,
+		Repository:       registry.Repository,
+		PushAuthConfig:   registry.PushAuthConfig,
+		RegistryProvider: registry.RegistryProvider,
+	}}
+	if len(registry.Targets) > 0 && registry.Layout != "" {
+		return nil, fmt.Errorf("targets are not supported for layouts")
+	}
+	for _, t := range registry.Targets {
+		if t.Hostname == "" {
+			return nil, fmt.Errorf("targets require a hostname")
+		}
+		if t.Repository == "" {
+			t.Repository = registry.Repository
+		}
+		if t.PushAuthConfig == "" {
+			t.PushAuthConfig = registry.PushAuthConfig
+		}
+		if t.RegistryProvider == "" {
+			t.RegistryProvider = registry.RegistryProvider
+		}
+		for _, other := range targets {
+			if other.Hostname == t.Hostname && other.Repository == t.Repository {
+				return nil, fmt.Errorf("%s/%s is a target more than once", t.Hostname, t.Repository)
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// buildProviders creates the registry provider of each target.
+func buildProviders(registry pkg.Registry, targets []pkg.Target) ([]provider.Provider, error) {
+	providers := make([]provider.Provider, len(targets))
+	for i, t := range targets {
+		p, err := provider.New(t.RegistryProvider, registry.Provider, t)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil && registry.Layout != "" {
+			return nil, fmt.Errorf("registryProvider %s is not supported for layouts", t.RegistryProvider)
+		}
+		providers[i] = p
+	}
+	return providers, nil
+}
+
+// ensureRepository lets the provider of target create the repository of reTaggedImage, unless it exists.
+func (d *Syncer) ensureRepository(p provider.Provider, t pkg.Target, reTaggedImage string) error {
+	repository := pkg.ImageWithoutHost(reTaggedImage, t.Hostname)
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository = repository[:i]
+	}
+	repository, _ = pkg.GetImageAndTag(repository)
+	if err := p.EnsureRepository(d.Context, repository); err != nil {
+		return fmt.Errorf("%s could not create %s: %w", p.Name(), repository, err)
+	}
+	return nil
+}
+
 func (d *Syncer) EndContext() {
 	d.CancelFunc()
 }
@@ -68,17 +233,20 @@ func (d *Syncer) GetContext() (context.Context, context.CancelFunc) {
 	return d.Context, d.CancelFunc
 }
 
-// ImageExistsOnRegistry checks if the given image already exists on the host being pushed to.
+// ImageExistsOnRegistry checks if the given image already exists on the target being pushed to.
 // if the image tag is 'latest', or is empty, an image will always be processed.
-func (d *Syncer) ImageExistsOnRegistry(image string) (bool, error) {
+func (d *Syncer) ImageExistsOnRegistry(t pkg.Target, image string) (bool, error) {
 	if image == "" {
 		return false, fmt.Errorf("encountered an empty image name")
 	}
+	if d.Layout != nil {
+		return d.ImageExistsInLayout(image)
+	}
 
 	// we retag first to append the specified repository
 	// we then strip the hostname since it will be specified in the URL built later
 	// we then separate the image name and tag to use later
-	imgWithoutTag, tag := pkg.GetImageAndTag(pkg.ImageWithoutHost(pkg.ReTag(image, d.RegistryHostName, d.Repository), d.RegistryHostName))
+	imgWithoutTag, tag := pkg.GetImageAndTag(pkg.ImageWithoutHost(d.reTag(image, t), t.Hostname))
 
 	// latest tags will have their manifests updated
 	// regularly, so we should always try to pull and push
@@ -90,23 +258,23 @@ func (d *Syncer) ImageExistsOnRegistry(image string) (bool, error) {
 
 	// making an HTTP request to the registry being pushed to is easier than
 	// creating a whole new docker client for this.
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/v2/%s/tags/list", d.RegistryHostName, imgWithoutTag), nil)
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/v2/%s/tags/list", t.Hostname, imgWithoutTag), nil)
 	if err != nil {
 		return false, err
 	}
 
 	// setup basic auth
-	if d.PushAuth != "" {
-		auths := strings.Split(d.PushAuth, ":")
+	if t.PushAuthConfig != "" {
+		auths := strings.Split(t.PushAuthConfig, ":")
 		if len(auths) != 2 {
-			return false, fmt.Errorf("pushConfig for %s is improperly formatted, expected format is 'username:password'", d.RegistryHostName)
+			return false, fmt.Errorf("pushConfig for %s is improperly formatted, expected format is 'username:password'", t.Hostname)
 		}
 		req.Header.Add("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", auths[0], auths[1]))))
 	}
 
-	r, err := http.DefaultClient.Do(req)
+	r, err := ratelimit.Client.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("error encountered making HTTP request to %s: %v", d.RegistryHostName, err)
+		return false, fmt.Errorf("error encountered making HTTP request to %s: %v", t.Hostname, err)
 	}
 
 	// don't bother reading the response body if we get a 404
@@ -115,7 +283,7 @@ func (d *Syncer) ImageExistsOnRegistry(image string) (bool, error) {
 	}
 
 	if r.StatusCode == http.StatusUnauthorized {
-		return false, fmt.Errorf("pushAuthConfig for %s is invalid", d.RegistryHostName)
+		return false, fmt.Errorf("pushAuthConfig for %s is invalid", t.Hostname)
 	}
 
 	var RegistryResponse struct {
@@ -126,7 +294,7 @@ func (d *Syncer) ImageExistsOnRegistry(image string) (bool, error) {
 	defer r.Body.Close()
 	out, err := io.ReadAll(r.Body)
 	if err != nil {
-		return false, fmt.Errorf("error encountered reading HTTP response from %s: %v", d.RegistryHostName, err)
+		return false, fmt.Errorf("error encountered reading HTTP response from %s: %v", t.Hostname, err)
 	}
 
 	// since the json response body varies in format we want to
@@ -135,7 +303,7 @@ func (d *Syncer) ImageExistsOnRegistry(image string) (bool, error) {
 	unstructuredResponse := make(map[string]interface{})
 	err = json.NewDecoder(bytes.NewReader(out)).Decode(&unstructuredResponse)
 	if err != nil {
-		return false, fmt.Errorf("error encountered reading HTTP response from %s: %v", d.RegistryHostName, err)
+		return false, fmt.Errorf("error encountered reading HTTP response from %s: %v", t.Hostname, err)
 	}
 
 	if _, ok := unstructuredResponse["errors"]; ok {
@@ -158,55 +326,69 @@ func (d *Syncer) ImageExistsOnRegistry(image string) (bool, error) {
 }
 
 func (d *Syncer) Pull(image string) error {
-	switch viper.GetString("display") {
-	case "spinner":
-		return PullWithDisplayFunc(d.Context, d.client, image, d.RegistryHostName, d.PullAuth, PushPullSpinner)
-	default:
-		return PullWithDisplayFunc(d.Context, d.client, image, d.RegistryHostName, d.PullAuth, PushPullStdDisplay)
-	}
+	return PullWithDisplay(d.Context, d.client, func(host string) *registry.Client { return d.registryClient(host, d.PullAuth) },
+		image, d.RegistryHostName, d.PullAuth, d.Display)
 }
 
-func (d *Syncer) Push(image string) error {
-	switch viper.GetString("display") {
-	case "spinner":
-		return PushWithDisplayFunc(d.Context, d.client, image, d.RegistryHostName, d.PullAuth, PushPullSpinner)
-	default:
-		return PushWithDisplayFunc(d.Context, d.client, image, d.RegistryHostName, d.PullAuth, PushPullStdDisplay)
-	}
+func (d *Syncer) Push(image string, t pkg.Target) error {
+	return PushWithDisplay(d.Context, d.client, image, t.Hostname, t.PushAuthConfig, d.Display)
 }
 
-func (d *Syncer) RemoveImage(image, retagged string) error {
-	// get the image so we have its ID
-	switch viper.GetString("display") {
-	case "spinner":
-		spinner, _ := yacspin.New(cfg)
-		spinner.Suffix(fmt.Sprintf("[%s] Removing locally held images %s, %s", time.Now().Format(pkg.TimeFormat), image, retagged))
-		spinner.Start()
-		defer spinner.Stop()
-		return RemoveImage(d.Context, d.client, image)
-	default:
-		pkg.Logger.Infof("Removing locally held images %s, %s", image, retagged)
-		return RemoveImage(d.Context, d.client, image)
+// pushedDigest returns the digest the target registry assigned to a pushed image, as recorded by the docker
+// daemon, or an empty string when it is not known.
+func (d *Syncer) pushedDigest(reTaggedImage string) string {
+	inspect, _, err := d.client.ImageInspectWithRaw(d.Context, reTaggedImage)
+	if err != nil {
+		return ""
+	}
+	repository := reTaggedImage
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
 	}
+	for _, repoDigest := range inspect.RepoDigests {
+		if strings.HasPrefix(repoDigest, repository+"@") {
+			return strings.TrimPrefix(repoDigest, repository+"@")
+		}
+	}
+	return ""
 }
 
-func (d *Syncer) Retag(ctx context.Context, image string) (string, error) {
-	reTaggedImage := pkg.ReTag(image, d.RegistryHostName, d.Repository)
-	switch viper.GetString("display") {
-	case "spinner":
-		spinner, _ := yacspin.New(cfg)
-		spinner.Suffix(fmt.Sprintf("[%s] Retagging %s -> %s: ", time.Now().Format(pkg.TimeFormat), image, reTaggedImage))
-		spinner.Start()
-		defer spinner.Stop()
-		return Retag(ctx, d.client, image, reTaggedImage)
-	default:
-		pkg.Logger.Infof("Retagging %s -> %s", image, reTaggedImage)
-		return Retag(ctx, d.client, image, reTaggedImage)
+// RemoveImage removes the retagged images from the local docker storage, as well as image when owned, i.e. picture-book pulled it.
+func (d *Syncer) RemoveImage(image string, retagged []string, owned bool) error {
+	references := retagged
+	if owned {
+		references = append([]string{image}, retagged...)
 	}
+	op := d.Display.Start(d.RegistryHostName, "Removing", fmt.Sprintf("locally held images %s", strings.Join(references, ", ")))
+	err := RemoveImage(d.Context, d.client, references...)
+	op.Done(err)
+	if err == nil {
+		d.State.UpdateLocal(func(local map[string]*state.LocalImage) {
+			delete(local, image)
+		})
+	}
+	return err
+}
+
+func (d *Syncer) Retag(ctx context.Context, image string, t pkg.Target) (string, error) {
+	reTaggedImage := d.reTag(image, t)
+	op := d.Display.Start(t.Hostname, "Retagging", fmt.Sprintf("%s -> %s", image, reTaggedImage))
+	_, err := Retag(ctx, d.client, image, reTaggedImage)
+	op.Done(err)
+	return reTaggedImage, err
 }
 
-func (d *Syncer) ExecScript() ([]string, error) {
-	return d.Executor.ExecScript()
+// reTag names image on target t. Sources implementing pkg.Renamer choose the name their images are retagged from.
+func (d *Syncer) reTag(image string, t pkg.Target) string {
+	for _, s := range d.Sources {
+		if r, ok := s.(pkg.Renamer); ok {
+			if renamed, ok := r.Rename(image); ok {
+				image = renamed
+				break
+			}
+		}
+	}
+	return pkg.ReTag(image, t.Hostname, t.Repository)
 }
 
 func (d *Syncer) ChangePeriod(cron string) {
@@ -219,6 +401,34 @@ func (d *Syncer) ChangePeriod(cron string) {
 	return
 }
 
+// Progress returns a snapshot of the run currently being processed.
+func (d *Syncer) Progress() pkg.Progress {
+	d.progressMu.RLock()
+	defer d.progressMu.RUnlock()
+	return d.progress
+}
+
+func (d *Syncer) setProgress(f func(p *pkg.Progress)) {
+	d.progressMu.Lock()
+	defer d.progressMu.Unlock()
+	f(&d.progress)
+}
+
+// setStage records the stage of the current run and publishes it on the event bus.
+func (d *Syncer) setStage(stage string) {
+	var image string
+	d.setProgress(func(p *pkg.Progress) {
+		p.Stage = stage
+		image = p.Image
+	})
+	events.Publish(events.Event{
+		Registry: d.RegistryHostName,
+		Job:      d.Name,
+		Image:    image,
+		Stage:    stage,
+	})
+}
+
 func (d *Syncer) Tag() string {
 	return d.JobTag
 }
@@ -228,13 +438,3 @@ func (d *Syncer) Info() []byte {
 	j, _ := json.MarshalIndent(d, "", " ")
 	return j
 }
-
-type DockerStatusOutput struct {
-	Status         string `json:"status"`
-	ProgressDetail struct {
-		Current int `json:"current"`
-		Total   int `json:"total"`
-	} `json:"progressDetail"`
-	Progress string `json:"progress"`
-	ID       string `json:"id"`
-}
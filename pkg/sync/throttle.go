@@ -0,0 +1,176 @@
+package sync
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+)
+
+// LoadWithDisplay pulls image from src into the docker daemon without the daemon contacting the registry: the image
+// is streamed to docker load as a docker-archive, so its layers are subject to the bandwidth limit of the registry.
+// Indexes are resolved to the platform of the daemon.
+func LoadWithDisplay(ctx context.Context, client *client.Client, src *registry.Client, image, hostname string, disp display.Display) error {
+	op := disp.Start(hostname, "Pulling", image)
+	err := loadImage(ctx, client, src, image, hostname, op)
+	op.Done(err)
+	return err
+}
+
+func loadImage(ctx context.Context, client *client.Client, src *registry.Client, image, hostname string, op display.Operation) error {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return err
+	}
+	version, err := client.ServerVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("could not determine the platform of the docker daemon: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := writeImageArchive(ctx, pw, src, ref, image, registry.Platform{OS: version.Os, Architecture: version.Arch})
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	resp, err := client.ImageLoad(ctx, pr, true)
+	if err == nil {
+		_, err = streamStatus(bufio.NewScanner(resp.Body), "Pulling", image, hostname, op)
+		resp.Body.Close()
+	}
+	// the daemon may stop reading before the end of the archive, unblocking the writer
+	pr.Close()
+	// errors of the registry explain why the daemon could not load the archive
+	if werr := <-written; werr != nil && !errors.Is(werr, io.ErrClosedPipe) {
+		if errors.Is(werr, registry.ErrNotFound) {
+			return pkg.ImageNotFound
+		}
+		return werr
+	}
+	return err
+}
+
+// archiveEntry is an entry of the manifest.json of a docker-archive.
+type archiveEntry struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// writeImageArchive writes the image ref refers to as a docker-archive naming it name, choosing
+// the manifest of platform if ref is an index. Layers are written as they are stored by the registry,
+// docker load decompresses them.
+func writeImageArchive(ctx context.Context, w io.Writer, src *registry.Client, ref registry.Reference, name string, platform registry.Platform) error {
+	b, desc, err := src.GetManifest(ctx, ref.Repository, ref.Reference())
+	if err != nil {
+		return err
+	}
+	m, err := registry.ParseManifest(b)
+	if err != nil {
+		return fmt.Errorf("could not parse manifest of %s: %w", name, err)
+	}
+	if registry.IsIndex(desc.MediaType) {
+		child, ok := platformManifest(m, platform)
+		if !ok {
+			return fmt.Errorf("%s has no image for %s/%s", name, platform.OS, platform.Architecture)
+		}
+		if b, _, err = src.GetManifest(ctx, ref.Repository, child.Digest); err != nil {
+			return err
+		}
+		if m, err = registry.ParseManifest(b); err != nil {
+			return fmt.Errorf("could not parse manifest %s of %s: %w", child.Digest, name, err)
+		}
+	}
+	if m.Config == nil {
+		return fmt.Errorf("%s is not an image", name)
+	}
+
+	entry := archiveEntry{Config: archiveName(m.Config.Digest) + ".json", RepoTags: []string{name}}
+	files := []registry.Descriptor{*m.Config}
+	for _, layer := range m.Layers {
+		entry.Layers = append(entry.Layers, archiveName(layer.Digest)+".tar")
+		files = append(files, layer)
+	}
+	manifest, err := json.Marshal([]archiveEntry{entry})
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(manifest))}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+	for i, blob := range files {
+		file := entry.Config
+		if i > 0 {
+			file = entry.Layers[i-1]
+		}
+		if err := writeArchiveBlob(ctx, tw, src, ref.Repository, blob, file); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeArchiveBlob(ctx context.Context, tw *tar.Writer, src *registry.Client, repo string, blob registry.Descriptor, name string) error {
+	r, size, err := src.GetBlob(ctx, repo, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if blob.Size > 0 {
+		size = blob.Size
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("could not read %s: %w", blob.Digest, err)
+	}
+	return nil
+}
+
+// platformManifest returns the manifest of an index matching platform.
+func platformManifest(index registry.Manifest, platform registry.Platform) (registry.Descriptor, bool) {
+	for _, m := range index.Manifests {
+		if m.Platform != nil && m.Platform.OS == platform.OS && m.Platform.Architecture == platform.Architecture {
+			return m, true
+		}
+	}
+	return registry.Descriptor{}, false
+}
+
+// archiveName names the file of a blob in a docker-archive after the hex of its digest.
+func archiveName(digest string) string {
+	return digest[strings.Index(digest, ":")+1:]
+}
+
+// CopyWithDisplay copies image from its source registry to reTaggedImage on target t, instead of the docker daemon
+// pushing it, so its layers are subject to the bandwidth limit of the target. The digest of the image is returned.
+func (d *Syncer) CopyWithDisplay(image, reTaggedImage string, t pkg.Target) (string, error) {
+	op := d.Display.Start(t.Hostname, "Pushing", reTaggedImage)
+	var desc registry.Descriptor
+	srcRef, err := registry.ParseReference(image)
+	if err == nil {
+		var dstRef registry.Reference
+		if dstRef, err = registry.ParseReference(reTaggedImage); err == nil {
+			desc, err = registry.Copy(d.Context, d.registryClient(srcRef.Registry, d.PullAuth), srcRef.Repository, srcRef.Reference(),
+				d.registryClient(t.Hostname, t.PushAuthConfig), dstRef.Repository, dstRef.Tag)
+		}
+	}
+	op.Done(err)
+	return desc.Digest, err
+}
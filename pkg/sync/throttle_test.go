@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/provider"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/ratelimit"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestWriteImageArchive(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	amd64 := src.PushImage("rancher/shell", "", "base layer", "amd64 layer")
+	arm64 := src.PushImage("rancher/shell", "", "base layer", "arm64 layer")
+	amd64.Platform = &registry.Platform{OS: "linux", Architecture: "amd64"}
+	arm64.Platform = &registry.Platform{OS: "linux", Architecture: "arm64"}
+	src.PutManifest("rancher/shell", "v0.1.19", registry.Manifest{SchemaVersion: 2, MediaType: registry.MediaTypeOCIIndex, Manifests: []registry.Descriptor{amd64, arm64}})
+
+	image := src.Host + "/rancher/shell:v0.1.19"
+	ref, _ := registry.ParseReference(image)
+	var b bytes.Buffer
+	err := writeImageArchive(context.Background(), &b, src.Client(""), ref, image, registry.Platform{OS: "linux", Architecture: "arm64"})
+	assert.Equal(t, err, nil)
+
+	files := make(map[string]string)
+	tr := tar.NewReader(&b)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Equal(t, err, nil)
+		content, _ := io.ReadAll(tr)
+		files[hdr.Name] = string(content)
+	}
+	var entries []archiveEntry
+	assert.Equal(t, json.Unmarshal([]byte(files["manifest.json"]), &entries), nil)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].RepoTags, []string{image})
+	// the layers of the platform of the daemon are written in order
+	assert.Equal(t, files[entries[0].Layers[0]], "base layer")
+	assert.Equal(t, files[entries[0].Layers[1]], "arm64 layer")
+	assert.Equal(t, len(files), 4)
+
+	err = writeImageArchive(context.Background(), io.Discard, src.Client(""), ref, image, registry.Platform{OS: "windows", Architecture: "amd64"})
+	assert.Equal(t, err != nil, true)
+}
+
+func TestPushThrottledTarget(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	dst := registrytest.NewServer()
+	defer dst.Close()
+	desc := src.PushImage("rancher/shell", "v0.1.19", "base layer", "shell layer")
+
+	// pushes to targets whose bandwidth is limited are copied through the throttled registry client
+	assert.Equal(t, ratelimit.Configure([]ratelimit.Config{{Registry: dst.Host, Bandwidth: "1GB"}}), nil)
+	defer ratelimit.Configure(nil)
+	d := &Syncer{Context: context.Background(), Display: &display.Logs{}, providers: []provider.Provider{nil}}
+	d.Targets = []pkg.Target{{Hostname: dst.Host, Repository: "mirror"}}
+	d.registryClient(src.Host, "").Scheme = "http"
+	d.registryClient(dst.Host, "").Scheme = "http"
+
+	image := src.Host + "/rancher/shell:v0.1.19"
+	results := d.pushTargets(image, []int{0}, []string{dst.Host + "/mirror/" + image})
+	assert.Equal(t, results[0].err, nil)
+	assert.Equal(t, results[0].digest, desc.Digest)
+	assert.Equal(t, dst.Tags("mirror/"+src.Host+"/rancher/shell"), []string{"v0.1.19"})
+}
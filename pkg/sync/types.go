@@ -4,18 +4,25 @@ import (
 	"context"
 	mutex "sync"
 
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/display"
 	"github.com/go-co-op/gocron"
 )
 
 // SyncerPool holds a reference to each running Syncer
 // and ensures that multiple Syncers cannot be started for
-// a single registry. It also sets up global contexts for
+// a single job. It also sets up global contexts for
 // graceful termination. There can only ever be 1 SyncerPool.
 type SyncerPool struct {
-	// Syncers is a mapping between a remote registry
+	// Syncers is a mapping between a job name
 	// and its Syncer.
 	Syncers map[string]*Syncer
+	// Reports is a mapping between a job name and
+	// its run history. Entries are created once on startup
+	// and survive pausing and resuming a Syncer.
+	Reports map[string]*ReportLog
 	mutex.RWMutex
 	context.Context
 	CronJobScheduler *gocron.Scheduler
+	// Display is shared by all Syncers in the pool.
+	Display display.Display
 }
@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/webhook"
+)
+
+// maxWebhookBody limits the size of the events read by the webhook endpoint.
+const maxWebhookBody = 1 << 20
+
+// WebhookTrigger lists the pushed images of a webhook event which are synchronized by a job.
+type WebhookTrigger struct {
+	Job    string
+	Images []string
+	syncer *Syncer
+}
+
+// Webhook accepts the push events of registry webhooks. The provider query parameter selects the format of the
+// event: dockerhub, harbor, gitlab, or distribution. Events are mapped to the jobs whose webhook secret was sent
+// along, or only to the job named by the sync query parameter, and the pushed images matching the webhook of
+// each job are synchronized right away. The jobs and their images are returned.
+func (h *Handler) Webhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	images, err := webhook.Parse(q.Get("provider"), body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	secret := webhook.Secret(r)
+	job := q.Get("sync")
+	var authorized bool
+	triggers := []WebhookTrigger{}
+	h.Pool.RLock()
+	for name, s := range h.Pool.Syncers {
+		if s.Webhook == nil || (job != "" && name != job) || !webhook.Valid(secret, s.Webhook.Secret) {
+			continue
+		}
+		authorized = true
+		if matched := s.webhookImages(images); len(matched) > 0 {
+			triggers = append(triggers, WebhookTrigger{Job: name, Images: matched, syncer: s})
+		}
+	}
+	h.Pool.RUnlock()
+	if !authorized {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	sort.Slice(triggers, func(i, j int) bool {
+		return triggers[i].Job < triggers[j].Job
+	})
+	for _, t := range triggers {
+		pkg.Logger.WithField("job", t.Job).Infof("Webhook reported %d pushed images for %s, synchronizing them", len(t.Images), t.Job)
+		go t.syncer.ProcessImages(t.Images)
+	}
+
+	j, err := json.MarshalIndent(triggers, "", " ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(j)
+}
+
+// webhookImages lists the images which match the webhook patterns of the job.
+func (d *Syncer) webhookImages(images []string) []string {
+	if len(d.Webhook.Images) == 0 {
+		return images
+	}
+	var matched []string
+	for _, image := range images {
+		ref, err := registry.ParseReference(image)
+		if err != nil {
+			continue
+		}
+		if pkg.MatchAnyGlob(d.Webhook.Images, ref.Registry+"/"+ref.Repository) {
+			matched = append(matched, image)
+		}
+	}
+	return matched
+}
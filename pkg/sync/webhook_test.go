@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry/registrytest"
+	"github.com/magiconair/properties/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	src := registrytest.NewServer()
+	defer src.Close()
+	src.PushImage("team/app", "v1", "app layer")
+	src.PushImage("team/app", "v2", "app v2 layer")
+	src.PushImage("other/tool", "v1", "tool layer")
+
+	d := newTestSyncer(t, src, pkg.Registry{
+		Hostname:   "edge.local",
+		Repository: "mirror",
+		Layout:     filepath.Join(t.TempDir(), "layout"),
+		Webhook:    &pkg.WebhookConfig{Secret: "s3cret", Images: []string{src.Host + "/team/**"}},
+	}, src.Host+"/team/app:v1")
+	d.Name = "edge"
+	h := Handler{Pool: &SyncerPool{Syncers: map[string]*Syncer{"edge": d}}}
+
+	event := `{"events": [
+		{"action": "push", "target": {"repository": "team/app", "tag": "v2"}, "request": {"host": "` + src.Host + `"}},
+		{"action": "push", "target": {"repository": "other/tool", "tag": "v1"}, "request": {"host": "` + src.Host + `"}}
+	]}`
+	send := func(url, secret string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(event))
+		r.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		h.Webhook(w, r)
+		return w
+	}
+
+	assert.Equal(t, send("/webhook?provider=distribution", "guess").Code, http.StatusUnauthorized)
+	assert.Equal(t, send("/webhook?provider=distribution&sync=other", "s3cret").Code, http.StatusUnauthorized)
+	assert.Equal(t, send("/webhook?provider=quay", "s3cret").Code, http.StatusBadRequest)
+
+	w := send("/webhook?provider=distribution", "s3cret")
+	assert.Equal(t, w.Code, http.StatusAccepted)
+	var triggers []WebhookTrigger
+	assert.Equal(t, json.Unmarshal(w.Body.Bytes(), &triggers), nil)
+	assert.Equal(t, triggers, []WebhookTrigger{{Job: "edge", Images: []string{src.Host + "/team/app:v2"}}})
+
+	// only the pushed image matching the webhook is synchronized, not the images listed by the sources
+	var report pkg.RunReport
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var ok bool
+		if report, ok = d.Reports.Latest(); ok {
+			break
+		}
+	}
+	assert.Equal(t, report.Trigger, "webhook")
+	assert.Equal(t, statuses(report), map[string]pkg.ImageStatus{
+		"edge.local/mirror/" + src.Host + "/team/app:v2": pkg.ImagePushed,
+	})
+}
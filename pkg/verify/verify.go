@@ -0,0 +1,243 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/HarrisonWAffel/playground/picture-book/pkg/registry"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultTimeout = 2 * time.Minute
+
+// TrustPolicy maps image patterns to the keys which must have signed them.
+// The first policy with a matching pattern is used.
+type TrustPolicy struct {
+	Policies []Policy `yaml:"policies"`
+}
+
+type Policy struct {
+	Name string `yaml:"name"`
+	// Images are glob patterns (see pkg.MatchGlob) matched against the image name, without its tag
+	Images []string `yaml:"images"`
+	// Keys are paths to cosign public keys, any one of which may have signed the image
+	Keys []string `yaml:"keys"`
+	// Skip disables verification for matching images
+	Skip bool `yaml:"skip"`
+}
+
+func LoadTrustPolicy(path string) (*TrustPolicy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read trust policy: %w", err)
+	}
+	var p TrustPolicy
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("could not parse trust policy %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Find returns the first policy matching image, if any.
+func (t *TrustPolicy) Find(image string) (Policy, bool) {
+	name, _ := pkg.GetImageAndTag(strings.SplitN(image, "@", 2)[0])
+	for _, p := range t.Policies {
+		if pkg.MatchAnyGlob(p.Images, name) {
+			return p, true
+		}
+	}
+	return Policy{}, false
+}
+
+// runFunc executes a command with env added to its environment, and returns its combined output.
+type runFunc func(ctx context.Context, env []string, name string, args ...string) ([]byte, error)
+
+func execRun(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.Bytes(), err
+}
+
+// Verifier checks image signatures by invoking cosign or notation.
+type Verifier struct {
+	tool    string
+	binary  string
+	keys    []string
+	policy  *TrustPolicy
+	block   bool
+	timeout time.Duration
+	run     runFunc
+}
+
+// New builds a Verifier from the registries configuration. A nil Verifier
+// is returned when verification is disabled.
+func New(conf pkg.VerifyConfig) (*Verifier, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+
+	v := &Verifier{
+		tool:    conf.Tool,
+		binary:  conf.Binary,
+		keys:    conf.Keys,
+		timeout: defaultTimeout,
+		run:     execRun,
+	}
+	if v.tool == "" {
+		v.tool = "cosign"
+	}
+	if v.binary == "" {
+		v.binary = v.tool
+	}
+
+	switch conf.OnFailure {
+	case "", "skip":
+	case "block":
+		v.block = true
+	default:
+		return nil, fmt.Errorf("invalid verify.onFailure %q, expected skip or block", conf.OnFailure)
+	}
+
+	if conf.Timeout != "" {
+		d, err := time.ParseDuration(conf.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verify.timeout: %w", err)
+		}
+		v.timeout = d
+	}
+
+	switch v.tool {
+	case "cosign":
+		if conf.TrustPolicy != "" {
+			p, err := LoadTrustPolicy(conf.TrustPolicy)
+			if err != nil {
+				return nil, err
+			}
+			v.policy = p
+		}
+		if len(v.keys) == 0 && v.policy == nil {
+			return nil, fmt.Errorf("cosign verification requires either keys or a trustPolicy")
+		}
+	case "notation":
+	default:
+		return nil, fmt.Errorf("unknown verification tool %q, expected cosign or notation", v.tool)
+	}
+	return v, nil
+}
+
+// Blocks reports if a failed verification should stop the synchronization entirely.
+func (v *Verifier) Blocks() bool {
+	return v.block
+}
+
+// Verify checks the signature of image, using auth (username:password) to access
+// the source registry if provided. A nil error means the image is trusted.
+func (v *Verifier) Verify(ctx context.Context, image, auth string) error {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	var username, password string
+	if parts := strings.SplitN(auth, ":", 2); auth != "" && len(parts) == 2 {
+		username, password = parts[0], parts[1]
+	}
+
+	// credentials are passed through the environment, the arguments of a process can be read by any user
+	if v.tool == "notation" {
+		var env []string
+		if username != "" {
+			env = []string{"NOTATION_USERNAME=" + username, "NOTATION_PASSWORD=" + password}
+		}
+		return v.exec(ctx, env, "verify", image)
+	}
+
+	keys := v.keys
+	if v.policy != nil {
+		p, ok := v.policy.Find(image)
+		switch {
+		case !ok && len(keys) == 0:
+			return fmt.Errorf("no trust policy matches %s", image)
+		case ok && p.Skip:
+			return nil
+		case ok:
+			keys = p.Keys
+		}
+	}
+
+	var env []string
+	if username != "" {
+		dir, err := dockerConfig(image, username, password)
+		if err != nil {
+			return fmt.Errorf("could not write the registry credentials for cosign: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		env = []string{"DOCKER_CONFIG=" + dir}
+	}
+
+	var failures []string
+	for _, key := range keys {
+		err := v.exec(ctx, env, "verify", "--key", key, image)
+		if err == nil {
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", key, err))
+	}
+	return fmt.Errorf("image is not signed by any trusted key: %s", strings.Join(failures, "; "))
+}
+
+// dockerConfig writes a docker configuration directory holding the credentials of the registry of image, which
+// only the current user can read. The caller removes it once done.
+func dockerConfig(image, username, password string) (string, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	host := ref.Registry
+	if host == registry.DockerHub {
+		host = "https://index.docker.io/v1/"
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	b, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{host: map[string]string{"auth": auth}},
+	})
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "picture-book-cosign")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), b, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+func (v *Verifier) exec(ctx context.Context, env []string, args ...string) error {
+	out, err := v.run(ctx, env, v.binary, args...)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s did not complete: %w", v.tool, ctx.Err())
+	}
+	// the last line of output from cosign and notation explains why verification failed
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if reason := strings.TrimSpace(lines[len(lines)-1]); reason != "" {
+		return fmt.Errorf("%s verify failed: %s", v.tool, reason)
+	}
+	return fmt.Errorf("%s verify failed: %w", v.tool, err)
+}
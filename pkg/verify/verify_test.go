@@ -0,0 +1,99 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HarrisonWAffel/playground/picture-book/pkg"
+	"github.com/magiconair/properties/assert"
+)
+
+// fakeCosign accepts signatures made by trusted.pub only, and records each invocation along with the
+// docker configuration it was given.
+func fakeCosign(calls *[]string) runFunc {
+	return func(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+		call := name + " " + strings.Join(args, " ")
+		for _, e := range env {
+			if strings.HasPrefix(e, "DOCKER_CONFIG=") {
+				config, _ := os.ReadFile(filepath.Join(strings.TrimPrefix(e, "DOCKER_CONFIG="), "config.json"))
+				call += " with " + string(config)
+			}
+		}
+		*calls = append(*calls, call)
+		for i, a := range args {
+			if a == "--key" && args[i+1] == "trusted.pub" {
+				return []byte("Verification for image --\nThe following checks were performed"), nil
+			}
+		}
+		return []byte("Error: no matching signatures:\nerror during command execution: no matching signatures"), errors.New("exit status 1")
+	}
+}
+
+func TestVerifyWithKeys(t *testing.T) {
+	v, err := New(pkg.VerifyConfig{Enabled: true, Keys: []string{"other.pub", "trusted.pub"}})
+	assert.Equal(t, err, nil)
+	var calls []string
+	v.run = fakeCosign(&calls)
+
+	assert.Equal(t, v.Verify(context.Background(), "rancher/shell:v0.1.19", "user:pass"), nil)
+	assert.Equal(t, len(calls), 2)
+	// credentials are passed in a docker configuration, never as arguments
+	assert.Equal(t, calls[1], `cosign verify --key trusted.pub rancher/shell:v0.1.19 with {"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"}}}`)
+	assert.Equal(t, v.Blocks(), false)
+}
+
+func TestVerifyWithTrustPolicy(t *testing.T) {
+	policy := filepath.Join(t.TempDir(), "policy.yaml")
+	os.WriteFile(policy, []byte(`
+policies:
+  - name: internal
+    images: ["registry.internal/**"]
+    skip: true
+  - name: rancher
+    images: ["rancher/*"]
+    keys: ["untrusted.pub"]
+`), 0644)
+
+	v, err := New(pkg.VerifyConfig{Enabled: true, TrustPolicy: policy, OnFailure: "block"})
+	assert.Equal(t, err, nil)
+	var calls []string
+	v.run = fakeCosign(&calls)
+
+	assert.Equal(t, v.Verify(context.Background(), "registry.internal/team/app:v1", ""), nil)
+	assert.Equal(t, len(calls), 0)
+
+	err = v.Verify(context.Background(), "rancher/shell:v0.1.19", "")
+	assert.Equal(t, strings.Contains(err.Error(), "no matching signatures"), true)
+
+	err = v.Verify(context.Background(), "library/nginx:1.23", "")
+	assert.Equal(t, err.Error(), "no trust policy matches library/nginx:1.23")
+	assert.Equal(t, v.Blocks(), true)
+}
+
+func TestNewDisabledOrInvalid(t *testing.T) {
+	v, err := New(pkg.VerifyConfig{})
+	assert.Equal(t, v == nil, true)
+	assert.Equal(t, err, nil)
+
+	_, err = New(pkg.VerifyConfig{Enabled: true})
+	assert.Equal(t, err != nil, true)
+	_, err = New(pkg.VerifyConfig{Enabled: true, Tool: "gpg"})
+	assert.Equal(t, err != nil, true)
+}
+
+func TestVerifyNotationCredentials(t *testing.T) {
+	v, err := New(pkg.VerifyConfig{Enabled: true, Tool: "notation"})
+	assert.Equal(t, err, nil)
+	var args, env []string
+	v.run = func(ctx context.Context, e []string, name string, a ...string) ([]byte, error) {
+		args, env = a, e
+		return nil, nil
+	}
+	assert.Equal(t, v.Verify(context.Background(), "registry.internal/team/app:v1", "user:pass"), nil)
+	assert.Equal(t, args, []string{"verify", "registry.internal/team/app:v1"})
+	assert.Equal(t, env, []string{"NOTATION_USERNAME=user", "NOTATION_PASSWORD=pass"})
+}
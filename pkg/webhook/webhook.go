@@ -0,0 +1,153 @@
+// Package webhook parses the push events registries send to webhooks into the images which were pushed.
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// The providers whose events can be parsed.
+const (
+	DockerHub    = "dockerhub"
+	Harbor       = "harbor"
+	GitLab       = "gitlab"
+	Distribution = "distribution"
+)
+
+// Providers lists the providers whose events can be parsed.
+var Providers = []string{DockerHub, Harbor, GitLab, Distribution}
+
+// Parse returns the images an event sent by provider reports as pushed, each including its tag.
+// Events which are not pushes, such as deletions or pulls, report no images.
+func Parse(provider string, body []byte) ([]string, error) {
+	var images []string
+	var err error
+	switch provider {
+	case DockerHub:
+		images, err = parseDockerHub(body)
+	case Harbor:
+		images, err = parseHarbor(body)
+	case GitLab, Distribution:
+		// the GitLab container registry sends the notifications of the distribution registry it is built on
+		images, err = parseDistribution(body)
+	default:
+		return nil, fmt.Errorf("unknown webhook provider %q, valid providers are %v", provider, Providers)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s event: %w", provider, err)
+	}
+	return dedupe(images), nil
+}
+
+// parseDockerHub parses the payload Docker Hub sends for each pushed tag.
+func parseDockerHub(body []byte) ([]string, error) {
+	var event struct {
+		PushData struct {
+			Tag string `json:"tag"`
+		} `json:"push_data"`
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	if event.Repository.RepoName == "" || event.PushData.Tag == "" {
+		return nil, fmt.Errorf("the repository and tag are required")
+	}
+	return []string{event.Repository.RepoName + ":" + event.PushData.Tag}, nil
+}
+
+// parseHarbor parses the PUSH_ARTIFACT events of Harbor, whose resource URLs name the pushed images.
+func parseHarbor(body []byte) ([]string, error) {
+	var event struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				Tag         string `json:"tag"`
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	if event.Type != "PUSH_ARTIFACT" && event.Type != "pushImage" {
+		return nil, nil
+	}
+	var images []string
+	for _, r := range event.EventData.Resources {
+		// artifacts pushed by digest only, such as signatures, have no tag to synchronize
+		if r.ResourceURL != "" && r.Tag != "" {
+			images = append(images, r.ResourceURL)
+		}
+	}
+	return images, nil
+}
+
+// parseDistribution parses an envelope of distribution registry notifications, keeping the pushes of tagged manifests.
+func parseDistribution(body []byte) ([]string, error) {
+	var envelope struct {
+		Events []struct {
+			Action string `json:"action"`
+			Target struct {
+				MediaType  string `json:"mediaType"`
+				Repository string `json:"repository"`
+				Tag        string `json:"tag"`
+			} `json:"target"`
+			Request struct {
+				Host string `json:"host"`
+			} `json:"request"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, e := range envelope.Events {
+		if e.Action != "push" || e.Target.Tag == "" || e.Target.Repository == "" || strings.Contains(e.Target.MediaType, "layer") {
+			continue
+		}
+		image := e.Target.Repository + ":" + e.Target.Tag
+		if e.Request.Host != "" {
+			image = e.Request.Host + "/" + image
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+func dedupe(images []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, image := range images {
+		if !seen[image] {
+			seen[image] = true
+			unique = append(unique, image)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// Secret returns the shared secret sent with a webhook request. Registries send it in different places: GitLab
+// in the X-Gitlab-Token header, Harbor and distribution in the Authorization header, optionally as a bearer token,
+// and Docker Hub, which can't send headers, in the secret query parameter.
+func Secret(r *http.Request) string {
+	if s := r.Header.Get("X-Gitlab-Token"); s != "" {
+		return s
+	}
+	if s := r.Header.Get("Authorization"); s != "" {
+		return strings.TrimPrefix(s, "Bearer ")
+	}
+	return r.URL.Query().Get("secret")
+}
+
+// Valid reports if the secret sent with a request is the expected one, in constant time.
+func Valid(sent, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) == 1
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		provider string
+		body     string
+		images   []string
+	}{
+		{
+			provider: DockerHub,
+			body:     `{"push_data": {"tag": "v0.1.19", "pusher": "rancher"}, "repository": {"repo_name": "rancher/shell", "namespace": "rancher", "name": "shell"}}`,
+			images:   []string{"rancher/shell:v0.1.19"},
+		},
+		{
+			provider: Harbor,
+			body: `{"type": "PUSH_ARTIFACT", "event_data": {"resources": [
+				{"digest": "sha256:1a2b", "tag": "v1", "resource_url": "harbor.example.com/library/nginx:v1"},
+				{"digest": "sha256:3c4d", "tag": "", "resource_url": "harbor.example.com/library/nginx@sha256:3c4d"}
+			], "repository": {"name": "nginx", "namespace": "library", "repo_full_name": "library/nginx"}}}`,
+			images: []string{"harbor.example.com/library/nginx:v1"},
+		},
+		{
+			provider: Harbor,
+			body:     `{"type": "DELETE_ARTIFACT", "event_data": {"resources": [{"tag": "v1", "resource_url": "harbor.example.com/library/nginx:v1"}]}}`,
+		},
+		{
+			provider: Distribution,
+			body: `{"events": [
+				{"action": "push", "target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "repository": "team/app", "tag": "v2"}, "request": {"host": "registry.example.com:5000"}},
+				{"action": "push", "target": {"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip", "repository": "team/app"}, "request": {"host": "registry.example.com:5000"}},
+				{"action": "pull", "target": {"repository": "team/app", "tag": "v1"}, "request": {"host": "registry.example.com:5000"}},
+				{"action": "push", "target": {"repository": "team/app", "tag": "v2"}, "request": {"host": "registry.example.com:5000"}}
+			]}`,
+			images: []string{"registry.example.com:5000/team/app:v2"},
+		},
+		{
+			provider: GitLab,
+			body:     `{"events": [{"action": "push", "target": {"repository": "group/project", "tag": "1.0"}, "request": {"host": "registry.gitlab.com"}}]}`,
+			images:   []string{"registry.gitlab.com/group/project:1.0"},
+		},
+	} {
+		images, err := Parse(tc.provider, []byte(tc.body))
+		assert.Equal(t, err, nil, tc.provider)
+		assert.Equal(t, images, tc.images, tc.provider)
+	}
+
+	_, err := Parse(DockerHub, []byte(`{"repository": {"repo_name": "rancher/shell"}}`))
+	assert.Equal(t, err.Error(), "invalid dockerhub event: the repository and tag are required")
+	_, err = Parse("quay", []byte(`{}`))
+	assert.Equal(t, err.Error(), `unknown webhook provider "quay", valid providers are [dockerhub harbor gitlab distribution]`)
+}
+
+func TestSecret(t *testing.T) {
+	r := httptest.NewRequest("POST", "/webhook?provider=dockerhub&secret=s3cret", nil)
+	assert.Equal(t, Secret(r), "s3cret")
+
+	r = httptest.NewRequest("POST", "/webhook?provider=harbor", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	assert.Equal(t, Secret(r), "s3cret")
+
+	r = httptest.NewRequest("POST", "/webhook?provider=gitlab", nil)
+	r.Header.Set("X-Gitlab-Token", "s3cret")
+	assert.Equal(t, Secret(r), "s3cret")
+
+	assert.Equal(t, Valid("s3cret", "s3cret"), true)
+	assert.Equal(t, Valid("guess", "s3cret"), false)
+	// a job without a secret never accepts events
+	assert.Equal(t, Valid("", ""), false)
+}